@@ -2,14 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
 	"letryapi/dbhelper"
 	"letryapi/services"
 	"letryapi/tasks"
 	"log"
 	"os"
+	"time"
 
 	firebase "firebase.google.com/go/v4"
 	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
 )
 
 func NewQuizAlertTask() *asynq.Task {
@@ -28,7 +31,9 @@ func runScheduler() {
 		cron string
 		task *asynq.Task
 		desc string
-	}{}
+	}{
+		{cron: "*/10 * * * *", task: tasks.NewExpireUploadsTask(), desc: "expire unconfirmed uploads"},
+	}
 
 	// Register all tasks
 	for _, t := range tasks {
@@ -54,10 +59,21 @@ func main() {
 		asynq.RedisClientOpt{Addr: os.Getenv("ASYNC_BROKER_ADDRESS")},
 		asynq.Config{Concurrency: 10, Queues: map[string]int{
 			"generate": 7,
-		}},
+		},
+			// a throttled model call is no failure of the task, it is re-queued after the wait without using a retry
+			IsFailure: func(err error) bool {
+				return !errors.Is(err, services.ErrLLMUnavailable)
+			},
+			RetryDelayFunc: func(n int, err error, task *asynq.Task) time.Duration {
+				var unavailable *services.LLMUnavailableError
+				if errors.As(err, &unavailable) {
+					return unavailable.RetryAfter
+				}
+				return asynq.DefaultRetryDelayFunc(n, err, task)
+			},
+		},
 	)
 	awsService := &services.AWSService{}
-	llmProcessor := &services.GoogleLLMProcessor{}
 	err := awsService.InitPresignClient(context.Background())
 	if err != nil {
 		log.Fatal("[Queue] Failed to initialize AWS provider: S3")
@@ -70,6 +86,26 @@ func main() {
 	// Set up task handler
 	mux := asynq.NewServeMux()
 	db := dbhelper.SetupDB()
+	// routes every model to its backend, see services.NewDefaultLLMProviderRegistry, keeps the calls of all
+	// workers within the rate limits of the models, optionally records or replays the calls (LLM_RECORD_MODE),
+	// and records every call in the LLMUsage ledger
+	rateLimits, err := services.LLMRateLimitsFromEnv()
+	if err != nil {
+		log.Fatalf("error reading the LLM rate limits: %v\n", err)
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: os.Getenv("ASYNC_BROKER_ADDRESS")})
+	defer rdb.Close()
+	throttled := services.NewThrottledLLMProcessor(
+		services.NewDefaultLLMProviderRegistry(),
+		services.NewRedisLLMRateLimiter(rdb, rateLimits),
+		services.NewRedisLLMCircuitBreaker(rdb),
+	)
+	recorder, err := services.NewLLMRecorderFromEnv(throttled)
+	if err != nil {
+		log.Fatalf("error setting up the LLM recorder: %v\n", err)
+	}
+	llmProcessor := services.NewMeteredLLMProcessor(recorder, db)
+	llmProcessor.OnRecord = services.LLMBudgetNotifier(app, db)
 	mux.HandleFunc("generate:tryon", func(ctx context.Context, t *asynq.Task) error {
 		return tasks.HandleTryOnGenerationTask(ctx, t, db, llmProcessor, awsService)
 	})
@@ -82,6 +118,9 @@ func main() {
 	mux.HandleFunc("generate:identify_clothing", func(ctx context.Context, t *asynq.Task) error {
 		return tasks.IdentifyClothingTask(ctx, t, db, llmProcessor, awsService, app)
 	})
+	mux.HandleFunc("maintenance:expire_uploads", func(ctx context.Context, t *asynq.Task) error {
+		return tasks.ExpireUploadsTask(ctx, t, db)
+	})
 
 	go runScheduler()
 	// Run the worker
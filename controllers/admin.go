@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"fmt"
+	"letryapi/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type AdminController struct {
+}
+
+// llmUsageGroups are the allowed group_by values of the usage report and the selected column of each
+var llmUsageGroups = map[string]struct{ column, selectExpr string }{
+	"day":     {"day", "TO_CHAR(DATE(created_at), 'YYYY-MM-DD') AS day"},
+	"company": {"company_id", "company_id"},
+	"model":   {"model", "model"},
+}
+
+// maxLLMUsageReportDays bounds the range of one report
+const maxLLMUsageReportDays = 366
+
+func (controller *AdminController) AdminRoutes(g *echo.Group) {
+	// LLM usage and cost per day, company and model. Query: from, to (YYYY-MM-DD, UTC, inclusive, the last 30 days by default),
+	// group_by (comma separated day, company, model, all of them by default), and the company_id, model and operation filters.
+	g.GET("/llm-usage", func(c echo.Context) error {
+		db := c.Get("__db").(*gorm.DB)
+
+		to := time.Now().UTC().Truncate(24 * time.Hour)
+		from := to.AddDate(0, 0, -29)
+		var err error
+		if value := c.QueryParam("from"); value != "" {
+			if from, err = time.Parse(time.DateOnly, value); err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "from must be a YYYY-MM-DD date"})
+			}
+		}
+		if value := c.QueryParam("to"); value != "" {
+			if to, err = time.Parse(time.DateOnly, value); err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "to must be a YYYY-MM-DD date"})
+			}
+		}
+		if to.Before(from) || to.Sub(from) > maxLLMUsageReportDays*24*time.Hour {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("the range must be between 1 and %d days", maxLLMUsageReportDays)})
+		}
+
+		groupBy := []string{"day", "company", "model"}
+		if value := c.QueryParam("group_by"); value != "" {
+			groupBy = strings.Split(value, ",")
+		}
+		selects := []string{
+			"COUNT(*) AS calls",
+			"COUNT(*) FILTER (WHERE NOT success) AS failed_calls",
+			"COALESCE(SUM(input_token_count), 0) AS input_token_count",
+			"COALESCE(SUM(output_token_count), 0) AS output_token_count",
+			"COALESCE(SUM(thoughts_token_count), 0) AS thoughts_token_count",
+			"COALESCE(SUM(image_count), 0) AS image_count",
+			"COALESCE(AVG(latency_ms), 0) AS avg_latency_ms",
+			"COALESCE(SUM(cost_usd), 0) AS cost_usd",
+		}
+		var groupColumns []string
+		for _, group := range groupBy {
+			usageGroup, ok := llmUsageGroups[strings.TrimSpace(group)]
+			if !ok {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "group_by accepts day, company and model"})
+			}
+			groupColumns = append(groupColumns, usageGroup.column)
+			selects = append(selects, usageGroup.selectExpr)
+		}
+
+		query := db.Model(&models.LLMUsage{}).
+			Where("created_at >= ? AND created_at < ?", from, to.AddDate(0, 0, 1))
+		if value := c.QueryParam("company_id"); value != "" {
+			companyID, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "company_id must be a number"})
+			}
+			query = query.Where("company_id = ?", companyID)
+		}
+		if value := c.QueryParam("model"); value != "" {
+			query = query.Where("model = ?", value)
+		}
+		if value := c.QueryParam("operation"); value != "" {
+			query = query.Where("operation = ?", value)
+		}
+
+		var rows []models.LLMUsageReportRow
+		query = query.Select(strings.Join(selects, ", "))
+		if len(groupColumns) > 0 {
+			query = query.Group(strings.Join(groupColumns, ", ")).Order(strings.Join(groupColumns, ", "))
+		}
+		if err := query.Scan(&rows).Error; err != nil {
+			fmt.Println("Error on loading LLM usage report", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load the LLM usage"})
+		}
+		if rows == nil {
+			rows = []models.LLMUsageReportRow{}
+		}
+		return c.JSON(http.StatusOK, rows)
+	})
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"encoding/json"
+	"letryapi/dbhelper"
+	"letryapi/models"
+	"letryapi/test"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLLMUsageReport(t *testing.T) {
+	db := dbhelper.SetupTestDB()
+	cleaner := dbhelper.SetupCleaner(db)
+	defer cleaner()
+	e := SetupServer(db, test.GoogleServiceMock{}, &test.AWSProviderMock{}, nil, nil, nil, &test.URLCacheMock{})
+
+	adminCompany := &models.Company{Name: "Admin Company", Subscription: "free", FullAdminAccess: true}
+	db.Create(adminCompany)
+	admin := test.FakeUser(db, adminCompany)
+	user := test.FakeUser(db, nil)
+	companyID := user.Memberships[0].CompanyID
+
+	db.Create(&[]models.LLMUsage{
+		{CompanyID: &companyID, Operation: "tryon", Model: "gemini-2.5-flash-image", OutputTokenCount: 1290, ImageCount: 1, Success: true, CostUSD: 0.039},
+		{CompanyID: &companyID, Operation: "tryon", Model: "gemini-2.5-flash-image", OutputTokenCount: 1290, ImageCount: 1, Success: true, CostUSD: 0.039},
+		{CompanyID: &companyID, Operation: "identify_clothing", Model: "gemini-2.5-pro", InputTokenCount: 1200, Success: false},
+	})
+
+	req := test.NewJSONAuthRequest("GET", "/general/admin/llm-usage?group_by=company,model", strconv.FormatUint(uint64(admin.ID), 10), "")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var rows []models.LLMUsageReportRow
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rows))
+	assert.Len(t, rows, 2)
+	for _, row := range rows {
+		assert.Equal(t, companyID, *row.CompanyID)
+		switch row.Model {
+		case "gemini-2.5-flash-image":
+			assert.Equal(t, int64(2), row.Calls)
+			assert.Equal(t, int64(2), row.ImageCount)
+			assert.InDelta(t, 0.078, row.CostUSD, 0.0001)
+		case "gemini-2.5-pro":
+			assert.Equal(t, int64(1), row.FailedCalls)
+		default:
+			t.Fatalf("unexpected model %s", row.Model)
+		}
+	}
+
+	// members of companies without full admin access can't see the report
+	req = test.NewJSONAuthRequest("GET", "/general/admin/llm-usage", strconv.FormatUint(uint64(user.ID), 10), "")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req = test.NewJSONAuthRequest("GET", "/general/admin/llm-usage?group_by=operation", strconv.FormatUint(uint64(admin.ID), 10), "")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -760,6 +760,17 @@ func (m *AuthController) ProfileRoutes(g *echo.Group) {
 			}
 			fullbodyAvatarUrl = &avatarR2URL
 		}
+		var fullbodyTransparentAvatarUrl *string
+		if user.UserFullBodyTransparentImageURL != nil {
+			bucketName := services.GetEnv("R2_BUCKET_NAME", "")
+			transparentR2URL, err := m.AWSService.GetPresignedR2FileReadURL(c.Request().Context(), bucketName, *user.UserFullBodyTransparentImageURL)
+			if err != nil {
+				log.Printf("R2 transparent avatar could not fetch for key '%s': %v", *user.UserFullBodyTransparentImageURL, err)
+				sentry.CaptureException(err)
+			} else {
+				fullbodyTransparentAvatarUrl = &transparentR2URL
+			}
+		}
 		return c.JSON(http.StatusOK, models.UserMeInfoV2Out{
 			Name:                                 user.Name,
 			MyCompanies:                          companies,
@@ -767,6 +778,7 @@ func (m *AuthController) ProfileRoutes(g *echo.Group) {
 			Status:                               user.Status,
 			AvatarURL:                            user.AvatarURL,
 			FullBodyAvatarUrl:                    fullbodyAvatarUrl,
+			FullBodyTransparentAvatarUrl:         fullbodyTransparentAvatarUrl,
 			FullBodyAvatarSet:                    user.FullBodyAvatarSet,
 			FullBodyAvatarStatus:                 user.FullBodyAvatarStatus,
 			FullBodyAvatarProcessingErrorMessage: user.FullBodyAvatarProcessingErrorMessage,
@@ -780,6 +792,8 @@ func (m *AuthController) ProfileRoutes(g *echo.Group) {
 			Weight:         user.Weight,
 			Height:         user.Height,
 			WaistSize:      user.WaistSize,
+
+			Characteristics: user.CharacteristicsOut(),
 		})
 	}, echojwt.JWT([]byte(os.Getenv("JWT_SECRET"))), UserOnlyMiddleware)
 
@@ -933,11 +947,6 @@ func (m *AuthController) ProfileRoutes(g *echo.Group) {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Our service is not available, please try again a bit later"})
 		}
 
-		asynqClient, ok := c.Get("__asynqclient").(*asynq.Client)
-		if !ok {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Service is not available, please try again a bit later"})
-		}
-
 		// Find note and verify ownership
 		// Return success response
 		var bucketName = services.GetEnv("R2_BUCKET_NAME", "")
@@ -955,11 +964,101 @@ func (m *AuthController) ProfileRoutes(g *echo.Group) {
 				"message": "Error while uploading your avatar, please try again",
 			})
 		}
-		user.UserFullBodyImageURL = &safeFileName
-		user.FullBodyAvatarStatus = "processing"
+		// every upload is kept as a saved avatar and becomes the default one,
+		// it is processed once the app confirms the upload. An upload never confirmed
+		// gives the default back to the last completed avatar, see tasks.ExpireUploadsTask
+		uploadExpiresAt := time.Now().Add(tasks.UploadConfirmWindow)
+		avatar := models.UserAvatar{
+			UserAccountID:   user.ID,
+			SourceImageURL:  safeFileName,
+			Status:          "processing",
+			IsDefault:       true,
+			ImageStatus:     "draft",
+			UploadExpiresAt: &uploadExpiresAt,
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.UserAvatar{}).Where("user_account_id = ?", user.ID).Update("is_default", false).Error; err != nil {
+				return err
+			}
+			return tx.Create(&avatar).Error
+		})
+		if err != nil {
+			sentry.CaptureException(err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to save your avatar"})
+		}
+		avatar.ApplyToUser(&user)
 		fmt.Println("Presetting user avatar url to ", safeFileName)
 
-		task, err := tasks.NewFullBodyAvatarGenerateTask(user.ID)
+		if err := db.Save(&user).Error; err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to save your avatar"})
+		}
+		return c.JSON(http.StatusOK, echo.Map{"message": "Avatar is updated successfully", "upload_url": uploadUrl, "processing_status": user.FullBodyAvatarStatus, "file_name": *req.FileName, "avatar_id": avatar.ID})
+	}, echojwt.JWT([]byte(os.Getenv("JWT_SECRET"))), UserOnlyMiddleware)
+
+	g.GET("/avatars", func(c echo.Context) error {
+		user := c.Get("currentUser").(models.UserAccount)
+		db := c.Get("__db").(*gorm.DB)
+		var avatars []models.UserAvatar
+		if err := db.Where("user_account_id = ?", user.ID).Order("created_at desc").Find(&avatars).Error; err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get avatars"})
+		}
+		bucketName := services.GetEnv("R2_BUCKET_NAME", "")
+		out := make([]models.UserAvatarOut, 0, len(avatars))
+		for _, avatar := range avatars {
+			item := models.UserAvatarOut{UserAvatar: avatar}
+			if avatar.ImageURL != nil {
+				imageUrl, err := m.AWSService.GetPresignedR2FileReadURL(c.Request().Context(), bucketName, *avatar.ImageURL)
+				if err != nil {
+					log.Printf("R2 avatar could not be presigned for key '%s': %v", *avatar.ImageURL, err)
+					sentry.CaptureException(err)
+				} else {
+					item.ImageURL = &imageUrl
+				}
+			}
+			if avatar.TransparentImageURL != nil {
+				transparentUrl, err := m.AWSService.GetPresignedR2FileReadURL(c.Request().Context(), bucketName, *avatar.TransparentImageURL)
+				if err == nil {
+					item.TransparentImageURL = &transparentUrl
+				}
+			}
+			out = append(out, item)
+		}
+		return c.JSON(http.StatusOK, echo.Map{"avatars": out})
+	}, echojwt.JWT([]byte(os.Getenv("JWT_SECRET"))), UserOnlyMiddleware)
+
+	g.POST("/avatars/:id/confirm-upload", func(c echo.Context) error {
+		user := c.Get("currentUser").(models.UserAccount)
+		db := c.Get("__db").(*gorm.DB)
+		asynqClient, ok := c.Get("__asynqclient").(*asynq.Client)
+		if !ok {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Service is not available, please try again a bit later"})
+		}
+		avatar, err := findUserAvatar(db, user.ID, c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Avatar not found"})
+		}
+		if avatar.ImageStatus == "uploaded" {
+			return c.JSON(http.StatusOK, avatar)
+		}
+		if avatar.ImageStatus != "draft" || (avatar.UploadExpiresAt != nil && time.Now().After(*avatar.UploadExpiresAt)) {
+			return c.JSON(http.StatusGone, map[string]string{"error": "Upload has expired, please set your avatar again"})
+		}
+		bucketName := services.GetEnv("R2_BUCKET_NAME", "")
+		if _, err := services.VerifyImageUpload(c.Request().Context(), m.AWSService, bucketName, avatar.SourceImageURL); err != nil {
+			return confirmUploadError(c, err)
+		}
+		// flip the status first, a concurrent confirm then finds nothing to update and does not queue twice
+		res := db.Model(&models.UserAvatar{}).Where("id = ? AND image_status = ?", avatar.ID, "draft").Update("image_status", "uploaded")
+		if res.Error != nil {
+			sentry.CaptureException(res.Error)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to confirm upload, please try again"})
+		}
+		avatar.ImageStatus = "uploaded"
+		if res.RowsAffected == 0 {
+			return c.JSON(http.StatusOK, avatar)
+		}
+
+		task, err := tasks.NewFullBodyAvatarGenerateTask(user.ID, avatar.ID)
 		if err != nil {
 			sentry.CaptureException(err)
 			return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Sorry, could not process avatar, please try again"})
@@ -967,13 +1066,82 @@ func (m *AuthController) ProfileRoutes(g *echo.Group) {
 		info, err := asynqClient.Enqueue(task, asynq.MaxRetry(3), asynq.Queue("generate"))
 		if err != nil {
 			sentry.CaptureException(err)
+			// back to draft, so the app can confirm again
+			if revertErr := db.Model(&models.UserAvatar{}).Where("id = ? AND image_status = ?", avatar.ID, "uploaded").Update("image_status", "draft").Error; revertErr != nil {
+				sentry.CaptureException(fmt.Errorf("[Avatar: %v] Error on reverting the confirmed upload: %v", avatar.ID, revertErr))
+			}
 			return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Sorry, could not process avatar, please try again"})
 		}
-		fmt.Printf("[Queue] Process Avatar %s task submitted, User ID: %v Task ID %v ", safeFileName, user.ID, info.ID)
-		if err := db.Save(&user).Error; err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to save your avatar"})
+		fmt.Printf("[Queue] Process Avatar %s task submitted, User ID: %v Avatar ID: %v Task ID %v ", avatar.SourceImageURL, user.ID, avatar.ID, info.ID)
+		return c.JSON(http.StatusOK, avatar)
+	}, echojwt.JWT([]byte(os.Getenv("JWT_SECRET"))), UserOnlyMiddleware)
+
+	g.POST("/avatars/:id/default", func(c echo.Context) error {
+		user := c.Get("currentUser").(models.UserAccount)
+		db := c.Get("__db").(*gorm.DB)
+		avatar, err := findUserAvatar(db, user.ID, c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Avatar not found"})
+		}
+		if avatar.Status != "completed" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Avatar is not ready yet, please wait until it is processed"})
+		}
+		avatar.IsDefault = true
+		avatar.ApplyToUser(&user)
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.UserAvatar{}).Where("user_account_id = ? AND id <> ?", user.ID, avatar.ID).Update("is_default", false).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&avatar).Update("is_default", true).Error; err != nil {
+				return err
+			}
+			return tx.Save(&user).Error
+		})
+		if err != nil {
+			sentry.CaptureException(err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to set default avatar"})
+		}
+		return c.JSON(http.StatusOK, avatar)
+	}, echojwt.JWT([]byte(os.Getenv("JWT_SECRET"))), UserOnlyMiddleware)
+
+	g.POST("/avatars/:id/delete", func(c echo.Context) error {
+		user := c.Get("currentUser").(models.UserAccount)
+		db := c.Get("__db").(*gorm.DB)
+		avatar, err := findUserAvatar(db, user.ID, c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Avatar not found"})
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Delete(&avatar).Error; err != nil {
+				return err
+			}
+			if !avatar.IsDefault {
+				return nil
+			}
+			// the latest ready avatar takes over, without one the user has to set an avatar again
+			var next models.UserAvatar
+			r := tx.Where("user_account_id = ? AND status = ?", user.ID, "completed").Order("created_at desc").Limit(1).Find(&next)
+			if r.Error != nil {
+				return r.Error
+			}
+			if r.RowsAffected == 0 {
+				user.UserFullBodyImageURL = nil
+				user.FullBodyAvatarStatus = "idle"
+				user.FullBodyAvatarProcessingErrorMessage = nil
+				return tx.Save(&user).Error
+			}
+			if err := tx.Model(&next).Update("is_default", true).Error; err != nil {
+				return err
+			}
+			next.ApplyToUser(&user)
+			return tx.Save(&user).Error
+		})
+		if err != nil {
+			sentry.CaptureException(err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete avatar"})
 		}
-		return c.JSON(http.StatusOK, map[string]string{"message": "Avatar is updated successfully", "upload_url": uploadUrl, "processing_status": user.FullBodyAvatarStatus, "file_name": *req.FileName})
+		deleteAvatarImages(c.Request().Context(), db, m.AWSService, avatar)
+		return c.JSON(http.StatusOK, echo.Map{"message": "deleted"})
 	}, echojwt.JWT([]byte(os.Getenv("JWT_SECRET"))), UserOnlyMiddleware)
 
 	g.POST("/body-characteristic", func(c echo.Context) error {
@@ -1000,32 +1168,42 @@ func (m *AuthController) ProfileRoutes(g *echo.Group) {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Our service is not available, please try again a bit later"})
 		}
 
-		// Update user characteristics - only set fields that are provided
+		// Update user characteristics - only set fields that are provided,
+		// they are marked as user entered so avatar processing keeps them
+		now := time.Now()
 		if req.BodyType != nil {
 			user.BodyType = req.BodyType
+			user.MarkUserCharacteristic(models.CharacteristicBodyType, now)
 		}
 		if req.ShoulderType != nil {
 			user.ShoulderType = req.ShoulderType
+			user.MarkUserCharacteristic(models.CharacteristicShoulderType, now)
 		}
 		if req.BodyToLegRatio != nil {
 			user.BodyToLegRatio = req.BodyToLegRatio
+			user.MarkUserCharacteristic(models.CharacteristicBodyToLegRatio, now)
 		}
 		if req.HandType != nil {
 			user.HandType = req.HandType
+			user.MarkUserCharacteristic(models.CharacteristicHandType, now)
 		}
 		if req.UpperLimbType != nil {
 			user.UpperLimbType = req.UpperLimbType
+			user.MarkUserCharacteristic(models.CharacteristicUpperLimbType, now)
 		}
 		if req.Weight != nil {
 			user.Weight = req.Weight
+			user.MarkUserCharacteristic(models.CharacteristicWeight, now)
 		}
 		if req.Height != nil {
 			// Convert float64 to string for storage
 			heightStr := fmt.Sprintf("%.2f", *req.Height)
 			user.Height = &heightStr
+			user.MarkUserCharacteristic(models.CharacteristicHeight, now)
 		}
 		if req.WaistSize != nil {
 			user.WaistSize = req.WaistSize
+			user.MarkUserCharacteristic(models.CharacteristicWaistSize, now)
 		}
 
 		// Save to database
@@ -1036,3 +1214,45 @@ func (m *AuthController) ProfileRoutes(g *echo.Group) {
 		return c.JSON(http.StatusOK, map[string]string{"message": "Body characteristics updated successfully"})
 	}, echojwt.JWT([]byte(os.Getenv("JWT_SECRET"))), UserOnlyMiddleware)
 }
+
+func findUserAvatar(db *gorm.DB, userID uint, rawID string) (models.UserAvatar, error) {
+	var avatar models.UserAvatar
+	avatarID, err := strconv.ParseUint(rawID, 10, 32)
+	if err != nil {
+		return avatar, err
+	}
+	err = db.Where("id = ? AND user_account_id = ?", avatarID, userID).First(&avatar).Error
+	return avatar, err
+}
+
+// deleteAvatarImages removes the source, generated and transparent images of a deleted avatar from R2.
+// Uploads reuse the app's file name, so a key still used by another avatar of the user is kept.
+// Failures are only reported, the avatar is already gone for the user.
+func deleteAvatarImages(ctx context.Context, db *gorm.DB, awsService services.AWSServiceProvider, avatar models.UserAvatar) {
+	bucketName := services.GetEnv("R2_BUCKET_NAME", "")
+	keys := []string{avatar.SourceImageURL}
+	for _, key := range []*string{avatar.ImageURL, avatar.TransparentImageURL} {
+		if key != nil {
+			keys = append(keys, *key)
+		}
+	}
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		var references int64
+		if err := db.Model(&models.UserAvatar{}).
+			Where("user_account_id = ? AND (source_image_url = ? OR image_url = ? OR transparent_image_url = ?)", avatar.UserAccountID, key, key, key).
+			Count(&references).Error; err != nil {
+			sentry.CaptureException(fmt.Errorf("[Avatar: %v] Error on checking other avatars using %s: %v", avatar.ID, key, err))
+			continue
+		}
+		if references > 0 {
+			continue
+		}
+		if err := awsService.DeleteR2Object(ctx, bucketName, key); err != nil {
+			fmt.Printf("[Avatar: %v] Error on deleting %s from R2: %v\n", avatar.ID, key, err)
+			sentry.CaptureException(fmt.Errorf("[Avatar: %v] Error on deleting %s from R2: %v", avatar.ID, key, err))
+		}
+	}
+}
@@ -173,3 +173,118 @@ func TestAcceptInvitation(t *testing.T) {
 	assert.Equal(t, true, newMembership.Active)
 
 }
+
+func TestSetDefaultAndDeleteAvatar(t *testing.T) {
+	db := dbhelper.SetupTestDB()
+	cleaner := dbhelper.SetupCleaner(db)
+	defer cleaner()
+	var deletedKeys []string
+	e := SetupServer(db, test.GoogleServiceMock{}, &test.AWSProviderMock{MockUrl: "https://fakebucketurl.com/avatar.png", DeletedKeys: &deletedKeys}, nil, nil, nil, &test.URLCacheMock{})
+	user := test.FakeUser(db, nil)
+	userID := strconv.FormatUint(uint64(user.ID), 10)
+
+	glassesURL := "/user/avatars/1/generation.png"
+	summerURL := "/user/avatars/2/generation.png"
+	summerTransparentURL := "/user/avatars/2/transparent.png"
+	glasses := models.UserAvatar{UserAccountID: user.ID, SourceImageURL: "fullbodyavatars/glasses.png", ImageURL: &glassesURL, Status: "completed", IsDefault: true}
+	summer := models.UserAvatar{UserAccountID: user.ID, SourceImageURL: "fullbodyavatars/summer.png", ImageURL: &summerURL, TransparentImageURL: &summerTransparentURL, Status: "completed"}
+	db.Create(&glasses)
+	db.Create(&summer)
+
+	req := test.NewJSONAuthRequest("GET", "/auth/avatars", userID, nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var listResponse struct {
+		Avatars []models.UserAvatarOut `json:"avatars"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listResponse))
+	assert.Len(t, listResponse.Avatars, 2)
+
+	req = test.NewJSONAuthRequest("POST", fmt.Sprintf("/auth/avatars/%v/default", summer.ID), userID, nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var updatedUser models.UserAccount
+	db.First(&updatedUser, user.ID)
+	assert.Equal(t, summerURL, *updatedUser.UserFullBodyImageURL)
+	db.First(&glasses, glasses.ID)
+	assert.False(t, glasses.IsDefault)
+
+	// uploaded again under the same file name, the photo must stay in R2
+	summerAgain := models.UserAvatar{UserAccountID: user.ID, SourceImageURL: "fullbodyavatars/summer.png", Status: "failed"}
+	db.Create(&summerAgain)
+
+	// deleting the default avatar promotes the remaining ready one and removes its images
+	req = test.NewJSONAuthRequest("POST", fmt.Sprintf("/auth/avatars/%v/delete", summer.ID), userID, nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	db.First(&updatedUser, user.ID)
+	assert.Equal(t, glassesURL, *updatedUser.UserFullBodyImageURL)
+	db.First(&glasses, glasses.ID)
+	assert.True(t, glasses.IsDefault)
+	assert.Equal(t, []string{summerURL, summerTransparentURL}, deletedKeys)
+}
+
+func TestConfirmAvatarUploadEnqueueFails(t *testing.T) {
+	db := dbhelper.SetupTestDB()
+	cleaner := dbhelper.SetupCleaner(db)
+	defer cleaner()
+	e := SetupServer(db, test.GoogleServiceMock{}, &test.AWSProviderMock{}, nil, unreachableAsynqClient(t), nil, &test.URLCacheMock{})
+	user := test.FakeUser(db, nil)
+
+	validUntil := time.Now().Add(time.Minute)
+	avatar := models.UserAvatar{UserAccountID: user.ID, SourceImageURL: "fullbodyavatars/photo.png", Status: "processing", IsDefault: true, ImageStatus: "draft", UploadExpiresAt: &validUntil}
+	db.Create(&avatar)
+
+	req := test.NewJSONAuthRequest("POST", fmt.Sprintf("/auth/avatars/%v/confirm-upload", avatar.ID), strconv.FormatUint(uint64(user.ID), 10), nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// nothing was queued, the upload stays a draft so the app can confirm again
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	db.First(&avatar, avatar.ID)
+	assert.Equal(t, "draft", avatar.ImageStatus)
+}
+
+func TestAICharacteristicsKeepUserValues(t *testing.T) {
+	db := dbhelper.SetupTestDB()
+	cleaner := dbhelper.SetupCleaner(db)
+	defer cleaner()
+	e := SetupServer(db, test.GoogleServiceMock{}, &test.AWSProviderMock{MockUrl: "https://fakebucketurl.com/avatar.png"}, nil, nil, nil, &test.URLCacheMock{})
+	user := test.FakeUser(db, nil)
+	userID := strconv.FormatUint(uint64(user.ID), 10)
+
+	req := test.NewJSONAuthRequest("POST", "/auth/body-characteristic", userID, map[string]interface{}{"weight": 70})
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	imageURL := "/user/avatars/1/generation.png"
+	aiWeight := 82
+	aiBodyType := "athletic"
+	avatar := models.UserAvatar{UserAccountID: user.ID, SourceImageURL: "fullbodyavatars/1.png", ImageURL: &imageURL, Status: "completed", Weight: &aiWeight, BodyType: &aiBodyType}
+	db.Create(&avatar)
+	req = test.NewJSONAuthRequest("POST", fmt.Sprintf("/auth/avatars/%v/default", avatar.ID), userID, nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	req = test.NewJSONAuthRequest("GET", "/auth/me", userID, nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var me models.UserMeInfoV2Out
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &me))
+	assert.Equal(t, 70, *me.Weight)
+	assert.Equal(t, "athletic", *me.BodyType)
+
+	weight := me.Characteristics[models.CharacteristicWeight]
+	assert.Equal(t, models.CharacteristicSourceUser, weight.Source)
+	assert.Equal(t, "82", *weight.AISuggestion)
+	bodyType := me.Characteristics[models.CharacteristicBodyType]
+	assert.Equal(t, models.CharacteristicSourceAI, bodyType.Source)
+}
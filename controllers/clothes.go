@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -48,6 +49,20 @@ type GenerateTryOnIn struct {
 	BottomClothingID *uint `json:"bottom_clothing_id"`
 	ShoesClothingID  *uint `json:"shoes_clothing_id"`
 	AccessoryID      *uint `json:"accessory_id"`
+	// saved avatar to try the clothes on, the default avatar is used when empty
+	AvatarID *uint `json:"avatar_id"`
+	// presentation presets, empty values fall back to studio_white, relaxed and 9:16
+	Scene       string `json:"scene" validate:"omitempty,oneof=studio_white street beach office custom"`
+	Pose        string `json:"pose" validate:"omitempty,oneof=relaxed walking hands_in_pockets three_quarter"`
+	AspectRatio string `json:"aspect_ratio" validate:"omitempty,oneof=9:16 3:4 4:5 1:1"`
+	// background image to upload when scene is custom, only its extension is used for the R2 key
+	BackgroundFileName *string `json:"background_file_name" validate:"omitempty,max=200"`
+	// skip the cached result of identical previous try-on and generate a new one
+	Regenerate bool `json:"regenerate"`
+}
+
+type CompareTryOnsIn struct {
+	TryOnIDs []uint `json:"try_on_ids" validate:"required,min=2,max=4"`
 }
 
 // Removed ClothingUploadFileRequest and CreateFolderRequest - not needed
@@ -64,6 +79,7 @@ type ClothingResponse struct {
 	ClothingType        string  `json:"clothing_type"`
 	Status              string  `json:"status"`
 	ProcessingStatus    string  `json:"processing_status"`
+	ImageStatus         string  `json:"image_status"`
 	ProcessErrorMessage *string `json:"process_error_message,omitempty"`
 	Uri                 *string `json:"uri,omitempty"`
 	CreatedAt           string  `json:"created_at"`
@@ -81,10 +97,15 @@ type ClothingDetailResponse struct {
 	Style                *string  `json:"style"`           // casual, formal, sporty, vintage, bohemian, chic, business, streetwear
 	IdentifyStatus       string   `json:"identify_status"` // idle, generating, completed, failed
 	IdentifyErrorMessage *string  `json:"identify_error_message,omitempty"`
+	// garment with whitened background, once processed
+	WhiteUri *string `json:"white_uri,omitempty"`
+	// garment with transparent background, once processed
+	TransparentUri *string `json:"transparent_uri,omitempty"`
 }
 type ClothingCreatedResponse struct {
 	ClothingResponse ClothingResponse `json:"clothes"`
 	FileUploadUrl    string           `json:"file_upload_url"`
+	BudgetWarning    *string          `json:"budget_warning,omitempty"`
 }
 
 type TryOnGenerationCreatedResponse struct {
@@ -92,6 +113,13 @@ type TryOnGenerationCreatedResponse struct {
 	Status                 string  `json:"status"`
 	TryOnPreviewImageURL   *string `json:"try_on_preview_image_url,omitempty"`
 	ProcessingErrorMessage *string `json:"processing_error_message,omitempty"`
+	Cached                 bool    `json:"cached"`
+	BackgroundUploadUrl    *string `json:"background_upload_url,omitempty"`
+	BudgetWarning          *string `json:"budget_warning,omitempty"`
+}
+
+type TryOnComparisonResponse struct {
+	CollageImageURL string `json:"collage_image_url"`
 }
 
 type ClothesListResponse struct {
@@ -108,11 +136,35 @@ type ClothesController struct {
 	URLCache    services.URLCacheServiceProvider
 }
 
+// checkLLMBudget returns the warning shown to the user near the monthly LLM budget of the company,
+// and whether new LLM work is refused because the budget is used up.
+func (controller *ClothesController) checkLLMBudget(db *gorm.DB, company models.Company) (*string, bool) {
+	status, err := services.GetLLMBudgetStatus(db, company, time.Now())
+	if err != nil {
+		// the ledger must not block the user
+		sentry.CaptureException(fmt.Errorf("[Company: %v] Error on loading the LLM budget: %v", company.ID, err))
+		return nil, false
+	}
+	if status == nil || !status.Warning() {
+		return nil, false
+	}
+	services.NotifyLLMBudget(controller.FirebaseApp, db, company, status)
+	if status.Exceeded() && company.LLMBudgetAction != services.LLMBudgetActionDowngrade {
+		return nil, true
+	}
+	return services.StrPointer(status.Message()), false
+}
+
 func (controller *ClothesController) ClothingRoutes(g *echo.Group) {
 	g.POST("/create", controller.CreateClothing)
 	g.POST("/identify", controller.IdentifyClothing)
 	g.POST("/tryon", controller.GenerateTryOn)
 	g.GET("/tryon/:id", controller.RetrieveTryOnGeneration)
+	g.POST("/tryon/compare", controller.CompareTryOns)
+	g.POST("/tryon/:id/cancel", controller.CancelTryOnGeneration)
+	g.POST("/tryon/:id/confirm-background-upload", controller.ConfirmTryOnBackgroundUpload)
+	g.POST("/:id/cancel", controller.CancelClothingProcessing)
+	g.POST("/:id/confirm-upload", controller.ConfirmClothingUpload)
 	g.GET("/list", controller.ListClothes)
 	g.GET("/:id", controller.GetClothingByID)
 }
@@ -138,10 +190,8 @@ func (controller *ClothesController) CreateClothing(c echo.Context) error {
 	if !ok {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database connection error"})
 	}
-	asynqClient, ok := c.Get("__asynqclient").(*asynq.Client)
-	if !ok {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Service is not available, please try again a bit later"})
-	}
+	// the app uploads the image and calls confirm-upload within this window
+	uploadExpiresAt := time.Now().Add(tasks.UploadConfirmWindow)
 
 	if req.FileName == nil || *req.FileName == "" {
 		sentry.CaptureException(fmt.Errorf("Image was not provided when creating clothing %s, user %v", req.Name, user.ID))
@@ -172,6 +222,10 @@ func (controller *ClothesController) CreateClothing(c echo.Context) error {
 			return c.JSON(http.StatusForbidden, map[string]string{"error": fmt.Sprintf("You have reached the limit of %v daily clothes. Please wait for the next day.", dailyClothingCount)})
 		}
 	}
+	budgetWarning, budgetExceeded := controller.checkLLMBudget(db, company)
+	if budgetExceeded {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Your company has used its monthly AI budget, please contact the company owner"})
+	}
 	clothing := models.Clothing{
 		Name:             req.Name,
 		Description:      req.Description,
@@ -181,6 +235,8 @@ func (controller *ClothesController) CreateClothing(c echo.Context) error {
 		Status:           "temporary",
 		CompanyID:        user.Memberships[0].CompanyID,
 		// Company:    user.Memberships[0].Company,
+		ImageStatus:     "draft",
+		UploadExpiresAt: &uploadExpiresAt,
 	}
 	var bucketName = services.GetEnv("R2_BUCKET_NAME", "")
 	var uploadUrl string
@@ -202,6 +258,7 @@ func (controller *ClothesController) CreateClothing(c echo.Context) error {
 		sentry.CaptureException(err)
 		return err
 	}
+	// processing is queued by confirm-upload once the image is in R2
 	if req.AddToCloset != nil && *req.AddToCloset {
 		clothing.Status = "in_closet"
 		clothing.ProcessingStatus = "pending"
@@ -209,17 +266,6 @@ func (controller *ClothesController) CreateClothing(c echo.Context) error {
 			sentry.CaptureException(err)
 			return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to update clothe status, please try again"})
 		}
-		task, err := tasks.NewClothingProcessingTask(clothing.ID)
-		if err != nil {
-			sentry.CaptureException(err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Sorry, could not process clothing, please try again"})
-		}
-		info, err := asynqClient.Enqueue(task, asynq.MaxRetry(3), asynq.Queue("generate"))
-		if err != nil {
-			sentry.CaptureException(err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Sorry, could not process clothing, please try again"})
-		}
-		fmt.Println("[Queue] Process clothing task submitted, Clothing ID: ", clothing.ID, " Task ID: ", info.ID)
 	}
 
 	// Prepare response
@@ -231,10 +277,12 @@ func (controller *ClothesController) CreateClothing(c echo.Context) error {
 			ClothingType:     clothing.ClothingType,
 			Status:           clothing.Status,
 			ProcessingStatus: clothing.ProcessingStatus,
+			ImageStatus:      clothing.ImageStatus,
 			CreatedAt:        clothing.CreatedAt.Format("2006-01-02T15:04:05Z"),
 			UpdatedAt:        clothing.UpdatedAt.Format("2006-01-02T15:04:05Z"),
 		},
 		FileUploadUrl: uploadUrl,
+		BudgetWarning: budgetWarning,
 	}
 
 	return c.JSON(http.StatusCreated, response)
@@ -261,10 +309,8 @@ func (controller *ClothesController) IdentifyClothing(c echo.Context) error {
 	if !ok {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database connection error"})
 	}
-	asynqClient, ok := c.Get("__asynqclient").(*asynq.Client)
-	if !ok {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Service is not available, please try again a bit later"})
-	}
+	// the app uploads the image and calls confirm-upload within this window
+	uploadExpiresAt := time.Now().Add(tasks.UploadConfirmWindow)
 
 	if req.FileName == nil || *req.FileName == "" {
 		sentry.CaptureException(fmt.Errorf("Image was not provided when identifying clothing, user %v", user.ID))
@@ -293,6 +339,10 @@ func (controller *ClothesController) IdentifyClothing(c echo.Context) error {
 			return c.JSON(http.StatusForbidden, map[string]string{"error": fmt.Sprintf("You have reached the limit of %v daily clothes. Please wait for the next day.", dailyClothingCount)})
 		}
 	}
+	budgetWarning, budgetExceeded := controller.checkLLMBudget(db, company)
+	if budgetExceeded {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Your company has used its monthly AI budget, please contact the company owner"})
+	}
 
 	clothing := models.Clothing{
 		Name:             "",          // Will be identified by LLM
@@ -302,6 +352,8 @@ func (controller *ClothesController) IdentifyClothing(c echo.Context) error {
 		Status:           "temporary",
 		CompanyID:        user.Memberships[0].CompanyID,
 		IdentifyStatus:   "pending",
+		ImageStatus:      "draft",
+		UploadExpiresAt:  &uploadExpiresAt,
 	}
 
 	var bucketName = services.GetEnv("R2_BUCKET_NAME", "")
@@ -324,18 +376,7 @@ func (controller *ClothesController) IdentifyClothing(c echo.Context) error {
 		return err
 	}
 
-	// Create identify task
-	task, err := tasks.NewIdentifyClothingTask(clothing.ID)
-	if err != nil {
-		sentry.CaptureException(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Sorry, could not start clothing identification, please try again"})
-	}
-	info, err := asynqClient.Enqueue(task, asynq.MaxRetry(3), asynq.Queue("generate"), asynq.ProcessIn(5*time.Second))
-	if err != nil {
-		sentry.CaptureException(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Sorry, could not start clothing identification, please try again"})
-	}
-	fmt.Println("[Queue] Identify clothing task submitted, Clothing ID: ", clothing.ID, " Task ID: ", info.ID)
+	// identification is queued by confirm-upload once the image is in R2
 
 	// Prepare response
 	response := ClothingCreatedResponse{
@@ -346,10 +387,12 @@ func (controller *ClothesController) IdentifyClothing(c echo.Context) error {
 			ClothingType:     clothing.ClothingType,
 			Status:           clothing.Status,
 			ProcessingStatus: clothing.ProcessingStatus,
+			ImageStatus:      clothing.ImageStatus,
 			CreatedAt:        clothing.CreatedAt.Format("2006-01-02T15:04:05Z"),
 			UpdatedAt:        clothing.UpdatedAt.Format("2006-01-02T15:04:05Z"),
 		},
 		FileUploadUrl: uploadUrl,
+		BudgetWarning: budgetWarning,
 	}
 
 	return c.JSON(http.StatusCreated, response)
@@ -376,14 +419,89 @@ func (controller *ClothesController) GenerateTryOn(c echo.Context) error {
 	if !ok {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database connection error"})
 	}
+	if req.AvatarID != nil {
+		var avatar models.UserAvatar
+		r := db.Where("id = ? AND user_account_id = ?", *req.AvatarID, user.ID).Limit(1).Find(&avatar)
+		if r.Error != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get avatar data"})
+		}
+		if r.RowsAffected == 0 {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Avatar not found"})
+		}
+		if avatar.Status != "completed" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Avatar is not ready yet, please wait until it is processed"})
+		}
+		// the rest of the request works with the chosen avatar as if it was the default one
+		avatar.ApplyToUser(&user)
+	}
 	if user.UserFullBodyImageURL == nil || *user.UserFullBodyImageURL == "" {
 		return c.JSON(http.StatusForbidden, map[string]string{"error": "You have to set your avatar first before generating try-on"})
 	}
+	if req.Scene == string(services.SceneCustom) && (req.BackgroundFileName == nil || *req.BackgroundFileName == "") {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Background image is required for custom scene"})
+	}
+	company := user.Memberships[0].Company
+
+	clothingImageKeys, err := tryOnClothingImageKeys(db, company.ID, req)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Clothing not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get clothe data"})
+	}
+	options := services.TryOnOptions{
+		Scene:       services.TryOnScene(req.Scene),
+		Pose:        services.TryOnPose(req.Pose),
+		AspectRatio: services.TryOnAspectRatio(req.AspectRatio),
+	}
+	if options.Scene == "" {
+		options.Scene = services.SceneStudioWhite
+	}
+	if options.Pose == "" {
+		options.Pose = services.PoseRelaxed
+	}
+	if options.AspectRatio == "" {
+		options.AspectRatio = services.AspectRatio9x16
+	}
+	// the version is part of the cache key, a random pick would miss the cache half of the time under a split
+	promptVersion := services.NewPromptRegistry(db).AssignForUser(services.PromptTryOn, user.ID)
+	cacheKey := services.TryOnCacheKey(
+		clothingImageKeys,
+		*user.UserFullBodyImageURL,
+		services.UserCharacteristicsDescription(user),
+		options,
+		promptVersion,
+	)
+	// custom backgrounds are uploaded again on every request, so they are never reused
+	if !req.Regenerate && options.Scene != services.SceneCustom {
+		var cachedGeneration models.ClothingTryonGeneration
+		r := db.Where("cache_key = ? AND user_account_id = ? AND status = ?", cacheKey, user.ID, "completed").Order("created_at desc").Limit(1).Find(&cachedGeneration)
+		if r.Error != nil {
+			sentry.CaptureException(r.Error)
+		}
+		if r.Error == nil && r.RowsAffected > 0 && cachedGeneration.TryOnPreviewImageURL != nil {
+			fmt.Printf("[User %v] Try on cache hit, returning generation %v\n", user.ID, cachedGeneration.ID)
+			bucketName := services.GetEnv("R2_BUCKET_NAME", "")
+			generationUrl, err := controller.AWSService.GetPresignedR2FileReadURL(c.Request().Context(), bucketName, *cachedGeneration.TryOnPreviewImageURL)
+			if err == nil {
+				return c.JSON(http.StatusOK, TryOnGenerationCreatedResponse{
+					TryOnID:              cachedGeneration.ID,
+					Status:               cachedGeneration.Status,
+					TryOnPreviewImageURL: &generationUrl,
+					Cached:               true,
+				})
+			}
+			// fall through and generate again rather than failing the request
+			log.Printf("Unable to presign cached try on %v: %v", cachedGeneration.ID, err)
+			sentry.CaptureException(err)
+		}
+	}
+
 	asynqClient, ok := c.Get("__asynqclient").(*asynq.Client)
 	if !ok {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Service is not available, please try again a bit later"})
 	}
-	company := user.Memberships[0].Company
+
 	if string(company.Subscription) == "free" {
 		var totalClothingCount int64
 		// if currentCompany.EnforcedDailyClothingLimit == nil {
@@ -408,6 +526,10 @@ func (controller *ClothesController) GenerateTryOn(c echo.Context) error {
 			return c.JSON(http.StatusForbidden, map[string]string{"error": fmt.Sprintf("You have reached the limit of %v daily generations. Please wait for the next day.", dailyClothingCount)})
 		}
 	}
+	budgetWarning, budgetExceeded := controller.checkLLMBudget(db, company)
+	if budgetExceeded {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Your company has used its monthly AI budget, please contact the company owner"})
+	}
 	// TODO check R2 head request for all clothes too see whether files were uploaded maximum for 2 seconds!
 	try_on_generation := models.ClothingTryonGeneration{
 		TopClothingID:          req.TopClothingID,
@@ -417,9 +539,34 @@ func (controller *ClothesController) GenerateTryOn(c echo.Context) error {
 		UserAccountID:          user.ID,
 		CompanyID:              company.ID,
 		GeneratedWithAvatarURL: *user.UserFullBodyImageURL,
+		AvatarID:               req.AvatarID,
+		CacheKey:               &cacheKey,
+		PromptVersion:          &promptVersion,
+		Scene:                  string(options.Scene),
+		Pose:                   string(options.Pose),
+		AspectRatio:            string(options.AspectRatio),
 		Status:                 "pending",
 	}
 
+	var backgroundUploadUrl *string
+	if options.Scene == services.SceneCustom {
+		var bucketName = services.GetEnv("R2_BUCKET_NAME", "")
+		backgroundFileName, err := randomUploadKey(fmt.Sprintf("tryon-backgrounds/%v", user.ID), *req.BackgroundFileName)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		uploadUrl, presignErr := controller.AWSService.PresignLink(context.Background(), bucketName, backgroundFileName)
+		if presignErr != nil {
+			log.Printf("Unable to presign background for try on of user %v!, %s", user.ID, presignErr)
+			sentry.CaptureException(presignErr)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate try-on, please try again"})
+		}
+		try_on_generation.BackgroundImageURL = &backgroundFileName
+		// generation is queued by confirm-background-upload once the background is in R2
+		try_on_generation.Status = "awaiting_background"
+		backgroundUploadUrl = &uploadUrl
+	}
+
 	// Save to database
 	if err := db.Create(&try_on_generation).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate try-on, please try again"})
@@ -430,6 +577,11 @@ func (controller *ClothesController) GenerateTryOn(c echo.Context) error {
 		TryOnID:              try_on_generation.ID,
 		Status:               try_on_generation.Status,
 		TryOnPreviewImageURL: try_on_generation.TryOnPreviewImageURL,
+		BackgroundUploadUrl:  backgroundUploadUrl,
+		BudgetWarning:        budgetWarning,
+	}
+	if try_on_generation.Status == "awaiting_background" {
+		return c.JSON(http.StatusCreated, response)
 	}
 
 	task, err := tasks.NewTryOnGenerationTask(user.ID, try_on_generation.ID)
@@ -447,6 +599,406 @@ func (controller *ClothesController) GenerateTryOn(c echo.Context) error {
 	return c.JSON(http.StatusCreated, response)
 }
 
+// ConfirmTryOnBackgroundUpload checks the uploaded background of a custom scene try-on in R2 and queues
+// the generation that was waiting for it. Confirming an already queued try-on returns it as is.
+func (controller *ClothesController) ConfirmTryOnBackgroundUpload(c echo.Context) error {
+	user, ok := c.Get("currentUser").(models.UserAccount)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+	db, ok := c.Get("__db").(*gorm.DB)
+	if !ok {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database connection error"})
+	}
+	asynqClient, ok := c.Get("__asynqclient").(*asynq.Client)
+	if !ok {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Service is not available, please try again a bit later"})
+	}
+
+	var tryOnGeneration models.ClothingTryonGeneration
+	if err := db.First(&tryOnGeneration, "id = ? AND user_account_id = ?", c.Param("id"), user.ID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Try-on generation not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Couldn't find generated image"})
+	}
+	response := func() error {
+		return c.JSON(http.StatusOK, TryOnGenerationCreatedResponse{
+			TryOnID: tryOnGeneration.ID,
+			Status:  tryOnGeneration.Status,
+		})
+	}
+	if tryOnGeneration.Status != "awaiting_background" {
+		if tryOnGeneration.Status == "failed" || tryOnGeneration.Status == "cancelled" {
+			return c.JSON(http.StatusGone, map[string]string{"error": "Upload has expired, please generate the try-on again"})
+		}
+		return response()
+	}
+
+	bucketName := services.GetEnv("R2_BUCKET_NAME", "")
+	if _, err := services.VerifyImageUpload(c.Request().Context(), controller.AWSService, bucketName, *tryOnGeneration.BackgroundImageURL); err != nil {
+		return confirmUploadError(c, err)
+	}
+	// flip the status first, a concurrent confirm then finds nothing to update and does not queue twice
+	res := db.Model(&models.ClothingTryonGeneration{}).Where("id = ? AND status = ?", tryOnGeneration.ID, "awaiting_background").Update("status", "pending")
+	if res.Error != nil {
+		sentry.CaptureException(res.Error)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to confirm upload, please try again"})
+	}
+	tryOnGeneration.Status = "pending"
+	if res.RowsAffected == 0 {
+		return response()
+	}
+
+	task, err := tasks.NewTryOnGenerationTask(user.ID, tryOnGeneration.ID)
+	if err == nil {
+		_, err = asynqClient.Enqueue(task, asynq.MaxRetry(3), asynq.Queue("generate"))
+	}
+	if err != nil {
+		sentry.CaptureException(err)
+		// back to waiting, so confirming again queues the generation
+		db.Model(&models.ClothingTryonGeneration{}).Where("id = ? AND status = ?", tryOnGeneration.ID, "pending").Update("status", "awaiting_background")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Sorry, could not start generation, please try again"})
+	}
+	fmt.Println("[Queue] Try on generation task submitted after background upload, Try ID: ", tryOnGeneration.ID)
+	return response()
+}
+
+// CancelTryOnGeneration removes a pending try-on from the queue, or stops it if it is already running.
+func (controller *ClothesController) CancelTryOnGeneration(c echo.Context) error {
+	// Get user and db from context
+	user, ok := c.Get("currentUser").(models.UserAccount)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+	db, ok := c.Get("__db").(*gorm.DB)
+	if !ok {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database connection error"})
+	}
+
+	var tryOnGeneration models.ClothingTryonGeneration
+	if err := db.First(&tryOnGeneration, "id = ? AND user_account_id = ?", c.Param("id"), user.ID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Try-on generation not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Couldn't find generated image"})
+	}
+	if tryOnGeneration.Status != "pending" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Only pending try-ons can be cancelled"})
+	}
+
+	asynqInspector, ok := c.Get("__asynqinspector").(*asynq.Inspector)
+	if !ok {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Service is not available, please try again a bit later"})
+	}
+	if err := tasks.CancelQueuedTask(asynqInspector, "generate", tasks.TryOnTaskID(tryOnGeneration.ID)); err != nil {
+		sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] Error on cancelling task: %v", tryOnGeneration.ID, err))
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to cancel try-on, please try again"})
+	}
+
+	// the worker may have finished while the task was being cancelled, its result is kept then
+	res := db.Model(&models.ClothingTryonGeneration{}).Where("id = ? AND status = ?", tryOnGeneration.ID, "pending").Update("status", "cancelled")
+	if res.Error != nil {
+		sentry.CaptureException(res.Error)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to cancel try-on, please try again"})
+	}
+	if res.RowsAffected == 0 {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Try-on has already finished"})
+	}
+	tryOnGeneration.Status = "cancelled"
+	fmt.Println("[Queue] Try on generation task cancelled, Try ID: ", tryOnGeneration.ID)
+
+	return c.JSON(http.StatusOK, TryOnGenerationCreatedResponse{
+		TryOnID: tryOnGeneration.ID,
+		Status:  tryOnGeneration.Status,
+	})
+}
+
+// CancelClothingProcessing removes a pending clothing processing from the queue, or stops it if it is already running.
+func (controller *ClothesController) CancelClothingProcessing(c echo.Context) error {
+	// Get user and db from context
+	user, ok := c.Get("currentUser").(models.UserAccount)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+	db, ok := c.Get("__db").(*gorm.DB)
+	if !ok {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database connection error"})
+	}
+
+	var clothing models.Clothing
+	if err := db.Where("owner_id = ? AND company_id = ?", user.ID, user.Memberships[0].CompanyID).First(&clothing, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Clothing not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch clothing"})
+	}
+	if clothing.ProcessingStatus != "pending" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Only pending clothes can be cancelled"})
+	}
+
+	asynqInspector, ok := c.Get("__asynqinspector").(*asynq.Inspector)
+	if !ok {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Service is not available, please try again a bit later"})
+	}
+	if err := tasks.CancelQueuedTask(asynqInspector, "generate", tasks.ClothingProcessingTaskID(clothing.ID)); err != nil {
+		sentry.CaptureException(fmt.Errorf("[Clothing: %v] Error on cancelling task: %v", clothing.ID, err))
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to cancel clothing processing, please try again"})
+	}
+
+	// the worker may have finished while the task was being cancelled, its result is kept then
+	res := db.Model(&models.Clothing{}).Where("id = ? AND processing_status = ?", clothing.ID, "pending").Update("processing_status", "cancelled")
+	if res.Error != nil {
+		sentry.CaptureException(res.Error)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to cancel clothing processing, please try again"})
+	}
+	if res.RowsAffected == 0 {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Clothing processing has already finished"})
+	}
+	clothing.ProcessingStatus = "cancelled"
+	fmt.Println("[Queue] Process clothing task cancelled, Clothing ID: ", clothing.ID)
+
+	return c.JSON(http.StatusOK, ClothingResponse{
+		ID:               clothing.ID,
+		Name:             clothing.Name,
+		Description:      clothing.Description,
+		ClothingType:     clothing.ClothingType,
+		Status:           clothing.Status,
+		ProcessingStatus: clothing.ProcessingStatus,
+		ImageStatus:      clothing.ImageStatus,
+		CreatedAt:        clothing.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		UpdatedAt:        clothing.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+	})
+}
+
+// ConfirmClothingUpload checks the uploaded image in R2 and queues the identification and processing
+// that were waiting for it. Confirming an already confirmed upload returns the clothing as is.
+func (controller *ClothesController) ConfirmClothingUpload(c echo.Context) error {
+	user, ok := c.Get("currentUser").(models.UserAccount)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+	db, ok := c.Get("__db").(*gorm.DB)
+	if !ok {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database connection error"})
+	}
+	asynqClient, ok := c.Get("__asynqclient").(*asynq.Client)
+	if !ok {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Service is not available, please try again a bit later"})
+	}
+
+	var clothing models.Clothing
+	if err := db.Where("owner_id = ? AND company_id = ?", user.ID, user.Memberships[0].CompanyID).First(&clothing, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Clothing not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch clothing"})
+	}
+	response := func() error {
+		return c.JSON(http.StatusOK, ClothingResponse{
+			ID:               clothing.ID,
+			Name:             clothing.Name,
+			Description:      clothing.Description,
+			ClothingType:     clothing.ClothingType,
+			Status:           clothing.Status,
+			ProcessingStatus: clothing.ProcessingStatus,
+			ImageStatus:      clothing.ImageStatus,
+			CreatedAt:        clothing.CreatedAt.Format("2006-01-02T15:04:05Z"),
+			UpdatedAt:        clothing.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+		})
+	}
+	// clothes created before confirm-upload have no image status
+	if clothing.ImageStatus == "uploaded" || clothing.ImageStatus == "" {
+		return response()
+	}
+	if clothing.ImageStatus != "draft" || (clothing.UploadExpiresAt != nil && time.Now().After(*clothing.UploadExpiresAt)) {
+		return c.JSON(http.StatusGone, map[string]string{"error": "Upload has expired, please add the clothing again"})
+	}
+
+	bucketName := services.GetEnv("R2_BUCKET_NAME", "")
+	if _, err := services.VerifyImageUpload(c.Request().Context(), controller.AWSService, bucketName, *clothing.ImageURL); err != nil {
+		return confirmUploadError(c, err)
+	}
+	// flip the status first, a concurrent confirm then finds nothing to update and does not queue twice
+	res := db.Model(&models.Clothing{}).Where("id = ? AND image_status = ?", clothing.ID, "draft").Update("image_status", "uploaded")
+	if res.Error != nil {
+		sentry.CaptureException(res.Error)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to confirm upload, please try again"})
+	}
+	clothing.ImageStatus = "uploaded"
+	if res.RowsAffected == 0 {
+		return response()
+	}
+	// back to draft when a task could not be queued, so the app can confirm again. The tasks have fixed ids,
+	// one that was already queued by the failed attempt conflicts and is not queued twice.
+	enqueueFailed := func(message string, err error) error {
+		sentry.CaptureException(err)
+		if revertErr := db.Model(&models.Clothing{}).Where("id = ? AND image_status = ?", clothing.ID, "uploaded").Update("image_status", "draft").Error; revertErr != nil {
+			sentry.CaptureException(fmt.Errorf("[Clothing: %v] Error on reverting the confirmed upload: %v", clothing.ID, revertErr))
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": message})
+	}
+
+	if clothing.IdentifyStatus == "pending" {
+		task, err := tasks.NewIdentifyClothingTask(clothing.ID)
+		if err != nil {
+			return enqueueFailed("Sorry, could not start clothing identification, please try again", err)
+		}
+		info, err := asynqClient.Enqueue(task, asynq.MaxRetry(3), asynq.Queue("generate"))
+		if err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+			return enqueueFailed("Sorry, could not start clothing identification, please try again", err)
+		}
+		if err == nil {
+			fmt.Println("[Queue] Identify clothing task submitted, Clothing ID: ", clothing.ID, " Task ID: ", info.ID)
+		}
+	}
+	if clothing.ProcessingStatus == "pending" {
+		task, err := tasks.NewClothingProcessingTask(clothing.ID)
+		if err != nil {
+			return enqueueFailed("Sorry, could not process clothing, please try again", err)
+		}
+		info, err := asynqClient.Enqueue(task, asynq.MaxRetry(3), asynq.Queue("generate"))
+		if err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+			return enqueueFailed("Sorry, could not process clothing, please try again", err)
+		}
+		if err == nil {
+			fmt.Println("[Queue] Process clothing task submitted, Clothing ID: ", clothing.ID, " Task ID: ", info.ID)
+		}
+	}
+	return response()
+}
+
+// CompareTryOns stitches 2 to 4 completed try-ons of the user into one labeled collage.
+func (controller *ClothesController) CompareTryOns(c echo.Context) error {
+	var req CompareTryOnsIn
+	if err := c.Bind(&req); err != nil {
+		fmt.Println(err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	// Validate request
+	if err := c.Validate(req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	// the same image twice would be a collage of one look
+	seenIDs := make(map[uint]bool, len(req.TryOnIDs))
+	for _, tryOnID := range req.TryOnIDs {
+		if seenIDs[tryOnID] {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Each try-on can be compared only once"})
+		}
+		seenIDs[tryOnID] = true
+	}
+
+	// Get user and db from context
+	user, ok := c.Get("currentUser").(models.UserAccount)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+	db, ok := c.Get("__db").(*gorm.DB)
+	if !ok {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database connection error"})
+	}
+
+	var tryOnGenerations []models.ClothingTryonGeneration
+	if err := db.Preload("TopClothing").Preload("BottomClothing").Preload("ShoesClothing").Preload("Accessory").
+		Where("id IN ? AND user_account_id = ?", req.TryOnIDs, user.ID).Find(&tryOnGenerations).Error; err != nil {
+		sentry.CaptureException(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Couldn't find generated images"})
+	}
+	generationsByID := make(map[uint]models.ClothingTryonGeneration, len(tryOnGenerations))
+	for _, tryOnGeneration := range tryOnGenerations {
+		generationsByID[tryOnGeneration.ID] = tryOnGeneration
+	}
+
+	bucketName := services.GetEnv("R2_BUCKET_NAME", "")
+	var items []services.CollageItem
+	// keep the order the user asked for
+	for _, tryOnID := range req.TryOnIDs {
+		tryOnGeneration, ok := generationsByID[tryOnID]
+		if !ok {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Try-on generation not found"})
+		}
+		if tryOnGeneration.Status != "completed" || tryOnGeneration.TryOnPreviewImageURL == nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Only completed try-ons can be compared"})
+		}
+		generationUrl, err := controller.AWSService.GetPresignedR2FileReadURL(c.Request().Context(), bucketName, *tryOnGeneration.TryOnPreviewImageURL)
+		if err != nil {
+			sentry.CaptureException(err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to build comparison, please try again"})
+		}
+		imageBytes, err := services.ReadFileFromUrl(generationUrl)
+		if err != nil {
+			sentry.CaptureException(fmt.Errorf("[Compare: %v] Error on fetching try on %v: %v", user.ID, tryOnGeneration.ID, err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to build comparison, please try again"})
+		}
+		items = append(items, services.CollageItem{
+			ImageBytes: imageBytes,
+			Labels:     tryOnClothingLabels(tryOnGeneration),
+		})
+	}
+
+	collageBytes, err := services.BuildComparisonCollage(items)
+	if err != nil {
+		sentry.CaptureException(fmt.Errorf("[Compare: %v] Error on building collage: %v", user.ID, err))
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to build comparison, please try again"})
+	}
+
+	collageFileName := fmt.Sprintf("/tryon/compare/%v/%v.png", user.ID, time.Now().UnixMilli())
+	uploadUrl, err := controller.AWSService.PresignLink(c.Request().Context(), bucketName, collageFileName)
+	if err != nil {
+		sentry.CaptureException(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to build comparison, please try again"})
+	}
+	respBody, statusCode, err := controller.AWSService.UploadToPresignedURL(c.Request().Context(), bucketName, uploadUrl, collageBytes)
+	if err != nil || statusCode > 299 {
+		sentry.CaptureException(fmt.Errorf("[Compare: %v] Error on uploading collage %s: %v %s", user.ID, collageFileName, err, respBody))
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to build comparison, please try again"})
+	}
+	collageUrl, err := controller.AWSService.GetPresignedR2FileReadURL(c.Request().Context(), bucketName, collageFileName)
+	if err != nil {
+		sentry.CaptureException(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to build comparison, please try again"})
+	}
+
+	return c.JSON(http.StatusCreated, TryOnComparisonResponse{CollageImageURL: collageUrl})
+}
+
+// tryOnClothingLabels returns the names of the worn clothes, falling back to the clothing type.
+func tryOnClothingLabels(tryOnGeneration models.ClothingTryonGeneration) []string {
+	var labels []string
+	for _, clothing := range []*models.Clothing{tryOnGeneration.TopClothing, tryOnGeneration.BottomClothing, tryOnGeneration.ShoesClothing, tryOnGeneration.Accessory} {
+		if clothing == nil {
+			continue
+		}
+		if clothing.Name != "" {
+			labels = append(labels, clothing.Name)
+		} else {
+			labels = append(labels, clothing.ClothingType)
+		}
+	}
+	return labels
+}
+
+// tryOnClothingImageKeys resolves the R2 image keys of the requested clothes in
+// top, bottom, shoes, accessory order, keeping "" for slots that were not selected.
+func tryOnClothingImageKeys(db *gorm.DB, companyID uint, req GenerateTryOnIn) ([]string, error) {
+	slots := []*uint{req.TopClothingID, req.BottomClothingID, req.ShoesClothingID, req.AccessoryID}
+	keys := make([]string, len(slots))
+	for i, clothingID := range slots {
+		if clothingID == nil {
+			continue
+		}
+		var clothing models.Clothing
+		if err := db.Where("company_id = ?", companyID).First(&clothing, *clothingID).Error; err != nil {
+			return nil, err
+		}
+		if clothing.ImageURL != nil {
+			keys[i] = *clothing.ImageURL
+		}
+	}
+	return keys, nil
+}
+
 func (controller *ClothesController) RetrieveTryOnGeneration(c echo.Context) error {
 	// get id from url.
 
@@ -580,7 +1132,8 @@ func (controller *ClothesController) ListClothes(c echo.Context) error {
 
 	// Get all clothes for the user
 	var clothes []models.Clothing
-	if err := db.Order("created_at desc").Where("owner_id = ? AND company_id = ?", user.ID, user.Memberships[0].CompanyID).Find(&clothes).Error; err != nil {
+	// drafts whose upload was never confirmed are hidden
+	if err := db.Order("created_at desc").Where("owner_id = ? AND company_id = ? AND image_status <> ?", user.ID, user.Memberships[0].CompanyID, "expired").Find(&clothes).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch clothes"})
 	}
 	// --- 3. Delegate all complex processing to our new helper function ---
@@ -646,6 +1199,22 @@ func (controller *ClothesController) GetClothingByID(c echo.Context) error {
 		}
 	}
 
+	var whiteUrl *string
+	if clothing.WhiteImageURL != nil {
+		url, err := controller.URLCache.GetReadURL(c.Request().Context(), *clothing.WhiteImageURL)
+		if err == nil {
+			whiteUrl = &url
+		}
+	}
+
+	var transparentUrl *string
+	if clothing.TransparentImageURL != nil {
+		url, err := controller.URLCache.GetReadURL(c.Request().Context(), *clothing.TransparentImageURL)
+		if err == nil {
+			transparentUrl = &url
+		}
+	}
+
 	// Prepare response (excluding retry times)
 	response := ClothingDetailResponse{
 		ClothingResponse: ClothingResponse{
@@ -669,6 +1238,8 @@ func (controller *ClothesController) GetClothingByID(c echo.Context) error {
 		Style:                clothing.Style,
 		IdentifyStatus:       clothing.IdentifyStatus,
 		IdentifyErrorMessage: clothing.IdentifyErrorMessage,
+		WhiteUri:             whiteUrl,
+		TransparentUri:       transparentUrl,
 	}
 
 	return c.JSON(http.StatusOK, response)
@@ -1,17 +1,23 @@
 package controllers
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
 	"letryapi/dbhelper"
 	"letryapi/models"
+	"letryapi/services"
 	"letryapi/test"
 
+	"github.com/hibiken/asynq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -240,3 +246,316 @@ func TestListClothesWithMultipleTypes(t *testing.T) {
 func stringPtr(s string) *string {
 	return &s
 }
+
+func TestGenerateTryOnReturnsCachedGeneration(t *testing.T) {
+	db := dbhelper.SetupTestDB()
+	cleaner := dbhelper.SetupCleaner(db)
+	defer cleaner()
+	e := SetupServer(db, test.GoogleServiceMock{}, &test.AWSProviderMock{MockUrl: "https://example.com/generation.png"}, nil, nil, nil, &test.URLCacheMock{})
+	user := test.FakeUser(db, nil)
+
+	top := models.Clothing{
+		Name:         "Test Top",
+		ClothingType: "top",
+		ImageURL:     stringPtr("clothes/top.jpg"),
+		OwnerID:      user.ID,
+		CompanyID:    user.Memberships[0].CompanyID,
+		Status:       "in_closet",
+	}
+	require.NoError(t, db.Create(&top).Error)
+
+	cacheKey := services.TryOnCacheKey(
+		[]string{"clothes/top.jpg", "", "", ""},
+		*user.UserFullBodyImageURL,
+		services.UserCharacteristicsDescription(*user),
+		services.TryOnOptions{Scene: services.SceneStudioWhite, Pose: services.PoseRelaxed, AspectRatio: services.AspectRatio9x16},
+		services.DefaultPromptVersion,
+	)
+	generation := models.ClothingTryonGeneration{
+		TopClothingID:          &top.ID,
+		UserAccountID:          user.ID,
+		CompanyID:              user.Memberships[0].CompanyID,
+		GeneratedWithAvatarURL: *user.UserFullBodyImageURL,
+		CacheKey:               &cacheKey,
+		TryOnPreviewImageURL:   stringPtr("/tryon/1/generation/generation.png"),
+		Status:                 "completed",
+	}
+	require.NoError(t, db.Create(&generation).Error)
+
+	reqBody := GenerateTryOnIn{TopClothingID: &top.ID}
+	req := test.NewJSONAuthRequest("POST", fmt.Sprintf("/company/%v/clothes/tryon", user.Memberships[0].CompanyID), strconv.FormatUint(uint64(user.ID), 10), reqBody)
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, "Expected status code 200 OK, got %d: %s", rec.Code, rec.Body.String())
+
+	var response TryOnGenerationCreatedResponse
+	err := json.Unmarshal(rec.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.True(t, response.Cached)
+	require.Equal(t, generation.ID, response.TryOnID)
+	require.Equal(t, "https://example.com/generation.png", *response.TryOnPreviewImageURL)
+
+	var count int64
+	require.NoError(t, db.Model(&models.ClothingTryonGeneration{}).Count(&count).Error)
+	require.Equal(t, int64(1), count)
+}
+
+// unreachableAsynqClient fails every Enqueue, like a queue that is down
+func unreachableAsynqClient(t *testing.T) *asynq.Client {
+	client := asynq.NewClient(asynq.RedisClientOpt{Addr: "127.0.0.1:1"})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestGenerateTryOnCustomSceneWaitsForBackground(t *testing.T) {
+	db := dbhelper.SetupTestDB()
+	cleaner := dbhelper.SetupCleaner(db)
+	defer cleaner()
+	e := SetupServer(db, test.GoogleServiceMock{}, &test.AWSProviderMock{}, nil, unreachableAsynqClient(t), nil, &test.URLCacheMock{})
+	user := test.FakeUser(db, nil)
+
+	top := models.Clothing{
+		Name:         "Test Top",
+		ClothingType: "top",
+		ImageURL:     stringPtr("clothes/top.jpg"),
+		OwnerID:      user.ID,
+		CompanyID:    user.Memberships[0].CompanyID,
+		Status:       "in_closet",
+	}
+	require.NoError(t, db.Create(&top).Error)
+
+	reqBody := GenerateTryOnIn{TopClothingID: &top.ID, Scene: "custom", BackgroundFileName: stringPtr("../../clothes/top.PNG")}
+	req := test.NewJSONAuthRequest("POST", fmt.Sprintf("/company/%v/clothes/tryon", user.Memberships[0].CompanyID), strconv.FormatUint(uint64(user.ID), 10), reqBody)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// nothing is queued before the background is confirmed, so the unreachable queue does not fail the request
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var response TryOnGenerationCreatedResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "awaiting_background", response.Status)
+
+	var generation models.ClothingTryonGeneration
+	require.NoError(t, db.First(&generation, response.TryOnID).Error)
+	require.NotNil(t, generation.BackgroundImageURL)
+	assert.Regexp(t, fmt.Sprintf(`^tryon-backgrounds/%v/[0-9a-f]{32}\.png$`, user.ID), *generation.BackgroundImageURL)
+
+	// a failed enqueue leaves the try-on waiting, so the app can confirm again
+	req = test.NewJSONAuthRequest("POST", fmt.Sprintf("/company/%v/clothes/tryon/%v/confirm-background-upload", user.Memberships[0].CompanyID, generation.ID), strconv.FormatUint(uint64(user.ID), 10), "")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.NoError(t, db.First(&generation, generation.ID).Error)
+	assert.Equal(t, "awaiting_background", generation.Status)
+
+	reqBody.BackgroundFileName = stringPtr("background.exe")
+	req = test.NewJSONAuthRequest("POST", fmt.Sprintf("/company/%v/clothes/tryon", user.Memberships[0].CompanyID), strconv.FormatUint(uint64(user.ID), 10), reqBody)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestCompareTryOnsOk(t *testing.T) {
+	db := dbhelper.SetupTestDB()
+	cleaner := dbhelper.SetupCleaner(db)
+	defer cleaner()
+
+	var imageBuf bytes.Buffer
+	require.NoError(t, png.Encode(&imageBuf, image.NewRGBA(image.Rect(0, 0, 90, 160))))
+	imageServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(imageBuf.Bytes())
+	}))
+	defer imageServer.Close()
+
+	e := SetupServer(db, test.GoogleServiceMock{}, &test.AWSProviderMock{MockUrl: imageServer.URL}, nil, nil, nil, &test.URLCacheMock{})
+	user := test.FakeUser(db, nil)
+
+	top := models.Clothing{
+		Name:         "Test Top",
+		ClothingType: "top",
+		OwnerID:      user.ID,
+		CompanyID:    user.Memberships[0].CompanyID,
+		Status:       "in_closet",
+	}
+	require.NoError(t, db.Create(&top).Error)
+
+	var tryOnIDs []uint
+	for i := 0; i < 3; i++ {
+		generation := models.ClothingTryonGeneration{
+			TopClothingID:          &top.ID,
+			UserAccountID:          user.ID,
+			CompanyID:              user.Memberships[0].CompanyID,
+			GeneratedWithAvatarURL: *user.UserFullBodyImageURL,
+			TryOnPreviewImageURL:   stringPtr(fmt.Sprintf("/tryon/%v/generation/generation.png", i)),
+			Status:                 "completed",
+		}
+		require.NoError(t, db.Create(&generation).Error)
+		tryOnIDs = append(tryOnIDs, generation.ID)
+	}
+
+	reqBody := CompareTryOnsIn{TryOnIDs: tryOnIDs}
+	req := test.NewJSONAuthRequest("POST", fmt.Sprintf("/company/%v/clothes/tryon/compare", user.Memberships[0].CompanyID), strconv.FormatUint(uint64(user.ID), 10), reqBody)
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusCreated, rec.Code, "Expected status code 201 Created, got %d: %s", rec.Code, rec.Body.String())
+
+	var response TryOnComparisonResponse
+	err := json.Unmarshal(rec.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.Equal(t, imageServer.URL, response.CollageImageURL)
+}
+
+func TestCompareTryOnsTooFew(t *testing.T) {
+	db := dbhelper.SetupTestDB()
+	cleaner := dbhelper.SetupCleaner(db)
+	defer cleaner()
+	e := SetupServer(db, test.GoogleServiceMock{}, &test.AWSProviderMock{}, nil, nil, nil, &test.URLCacheMock{})
+	user := test.FakeUser(db, nil)
+
+	reqBody := CompareTryOnsIn{TryOnIDs: []uint{1}}
+	req := test.NewJSONAuthRequest("POST", fmt.Sprintf("/company/%v/clothes/tryon/compare", user.Memberships[0].CompanyID), strconv.FormatUint(uint64(user.ID), 10), reqBody)
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestCancelTryOnNotPending(t *testing.T) {
+	db := dbhelper.SetupTestDB()
+	cleaner := dbhelper.SetupCleaner(db)
+	defer cleaner()
+	e := SetupServer(db, test.GoogleServiceMock{}, &test.AWSProviderMock{}, nil, nil, nil, &test.URLCacheMock{})
+	user := test.FakeUser(db, nil)
+
+	generation := models.ClothingTryonGeneration{
+		UserAccountID:          user.ID,
+		CompanyID:              user.Memberships[0].CompanyID,
+		GeneratedWithAvatarURL: *user.UserFullBodyImageURL,
+		Status:                 "completed",
+	}
+	require.NoError(t, db.Create(&generation).Error)
+
+	req := test.NewJSONAuthRequest("POST", fmt.Sprintf("/company/%v/clothes/tryon/%v/cancel", user.Memberships[0].CompanyID, generation.ID), strconv.FormatUint(uint64(user.ID), 10), "")
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	var updated models.ClothingTryonGeneration
+	require.NoError(t, db.First(&updated, generation.ID).Error)
+	assert.Equal(t, "completed", updated.Status)
+}
+
+func TestConfirmClothingUploadExpired(t *testing.T) {
+	db := dbhelper.SetupTestDB()
+	cleaner := dbhelper.SetupCleaner(db)
+	defer cleaner()
+	e := SetupServer(db, test.GoogleServiceMock{}, &test.AWSProviderMock{}, nil, nil, nil, &test.URLCacheMock{})
+	user := test.FakeUser(db, nil)
+
+	expiredAt := time.Now().Add(-time.Minute)
+	clothing := models.Clothing{
+		Name:             "Test Clothing",
+		ClothingType:     "top",
+		ImageURL:         stringPtr("clothes/test-image.jpg"),
+		OwnerID:          user.ID,
+		CompanyID:        user.Memberships[0].CompanyID,
+		Status:           "in_closet",
+		ProcessingStatus: "pending",
+		ImageStatus:      "draft",
+		UploadExpiresAt:  &expiredAt,
+	}
+	require.NoError(t, db.Create(&clothing).Error)
+
+	req := test.NewJSONAuthRequest("POST", fmt.Sprintf("/company/%v/clothes/%v/confirm-upload", user.Memberships[0].CompanyID, clothing.ID), strconv.FormatUint(uint64(user.ID), 10), "")
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusGone, rec.Code)
+	var updated models.Clothing
+	require.NoError(t, db.First(&updated, clothing.ID).Error)
+	assert.Equal(t, "draft", updated.ImageStatus)
+	assert.Equal(t, "pending", updated.ProcessingStatus)
+}
+
+func TestConfirmClothingUploadEnqueueFails(t *testing.T) {
+	db := dbhelper.SetupTestDB()
+	cleaner := dbhelper.SetupCleaner(db)
+	defer cleaner()
+	e := SetupServer(db, test.GoogleServiceMock{}, &test.AWSProviderMock{}, nil, unreachableAsynqClient(t), nil, &test.URLCacheMock{})
+	user := test.FakeUser(db, nil)
+
+	validUntil := time.Now().Add(time.Minute)
+	clothing := models.Clothing{
+		Name:             "Test Clothing",
+		ClothingType:     "top",
+		ImageURL:         stringPtr("clothes/test-image.jpg"),
+		OwnerID:          user.ID,
+		CompanyID:        user.Memberships[0].CompanyID,
+		Status:           "in_closet",
+		ProcessingStatus: "pending",
+		ImageStatus:      "draft",
+		UploadExpiresAt:  &validUntil,
+	}
+	require.NoError(t, db.Create(&clothing).Error)
+
+	req := test.NewJSONAuthRequest("POST", fmt.Sprintf("/company/%v/clothes/%v/confirm-upload", user.Memberships[0].CompanyID, clothing.ID), strconv.FormatUint(uint64(user.ID), 10), "")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	// nothing was queued, the upload stays a draft so the app can confirm again
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	var updated models.Clothing
+	require.NoError(t, db.First(&updated, clothing.ID).Error)
+	assert.Equal(t, "draft", updated.ImageStatus)
+	assert.Equal(t, "pending", updated.ProcessingStatus)
+}
+
+func TestCreateClothingOverLLMBudget(t *testing.T) {
+	db := dbhelper.SetupTestDB()
+	cleaner := dbhelper.SetupCleaner(db)
+	defer cleaner()
+	e := SetupServer(db, test.GoogleServiceMock{}, &test.AWSProviderMock{}, nil, nil, nil, &test.URLCacheMock{})
+	user := test.FakeUser(db, nil)
+	companyID := user.Memberships[0].CompanyID
+	require.NoError(t, db.Model(&models.Company{}).Where("id = ?", companyID).Update("monthly_llm_budget_usd", 1.0).Error)
+	require.NoError(t, db.Create(&models.LLMUsage{CompanyID: &companyID, Operation: services.LLMOperationTryOn, Model: services.Flash25Image.String(), Success: true, CostUSD: 0.9}).Error)
+
+	reqBody := CreateClothingIn{
+		Name:         "Test Clothing",
+		ClothingType: "top",
+		FileName:     stringPtr("test-image.jpg"),
+		AddToCloset:  BoolPointer(false),
+	}
+	createClothing := func() *httptest.ResponseRecorder {
+		req := test.NewJSONAuthRequest("POST", fmt.Sprintf("/company/%v/clothes/create", companyID), strconv.FormatUint(uint64(user.ID), 10), reqBody)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// near the budget the clothing is created with a warning
+	rec := createClothing()
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var response ClothingCreatedResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	require.NotNil(t, response.BudgetWarning)
+	var company models.Company
+	require.NoError(t, db.First(&company, companyID).Error)
+	require.Equal(t, 80, company.LLMBudgetNotifiedLevel)
+
+	// over the budget it is refused
+	require.NoError(t, db.Create(&models.LLMUsage{CompanyID: &companyID, Operation: services.LLMOperationTryOn, Model: services.Flash25Image.String(), Success: true, CostUSD: 0.2}).Error)
+	rec = createClothing()
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	require.NoError(t, db.First(&company, companyID).Error)
+	assert.Equal(t, 100, company.LLMBudgetNotifiedLevel)
+}
@@ -50,8 +50,10 @@ func (controller *CompanyController) CompanyRoutes(g *echo.Group) {
 		}
 		// }
 		var enforcedLlmModel *int32
+		var llmFallbackChains map[string][]int32
 		if allowedLLMInfo {
 			enforcedLlmModel = currentCompany.EnforcedLLMModel
+			llmFallbackChains = currentCompany.LLMFallbackChains
 		}
 		return c.JSON(http.StatusOK, &models.CompanyOverviewOut{
 			Name:                   currentCompany.Name,
@@ -67,6 +69,7 @@ func (controller *CompanyController) CompanyRoutes(g *echo.Group) {
 			Currency:               currentCompany.Currency,
 			Language:               currentCompany.Language,
 			LLMModel:               enforcedLlmModel,
+			LLMFallbackChains:      llmFallbackChains,
 			FullAdminAccess:        currentCompany.FullAdminAccess,
 		})
 	})
@@ -110,6 +113,19 @@ func (controller *CompanyController) CompanyRoutes(g *echo.Group) {
 			}
 			currentCompany.EnforcedLLMModel = companyUpdateData.LLMModel
 		}
+		if companyUpdateData.LLMFallbackChains != nil {
+			if !allowedLllmInfo {
+				fmt.Println("User tried to update LLM fallback chains without permission!", user.Email, companyUpdateData.LLMFallbackChains)
+				sentry.CaptureException(fmt.Errorf("User %s tried to update LLM fallback chains to %v without permission!", user.Email, companyUpdateData.LLMFallbackChains))
+				return c.JSON(http.StatusForbidden, echo.Map{
+					"message": "Bad request",
+				})
+			}
+			if err := services.ValidateLLMFallbackChains(companyUpdateData.LLMFallbackChains); err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+			}
+			currentCompany.LLMFallbackChains = companyUpdateData.LLMFallbackChains
+		}
 		// currentCompany.Address = companyUpdateData.Address
 		// currentCompany.BusinessPhone = companyUpdateData.BusinessPhone
 		// currentCompany.WhatsAppNumber = companyUpdateData.WhatsAppNumber
@@ -142,3 +142,18 @@ func UserCompanyMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		return next(c)
 	}
 }
+
+// AdminMiddleware lets through members with the OWNER or ADMIN role of a company with full admin access,
+// it expects UserMiddleware to have loaded the memberships.
+func AdminMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		currentUser := c.Get("currentUser").(models.UserAccount)
+		for _, membership := range currentUser.Memberships {
+			if membership.Active && membership.Company.FullAdminAccess && (membership.Role == models.OWNER || membership.Role == models.ADMIN) {
+				return next(c)
+			}
+		}
+		fmt.Println("Admin access denied for user", currentUser.ID)
+		return echo.ErrForbidden
+	}
+}
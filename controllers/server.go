@@ -119,6 +119,10 @@ func SetupServer(
 	clothingGroup := companyGroup.Group("/clothes")
 	clothingController.ClothingRoutes(clothingGroup)
 
+	adminController := AdminController{}
+	adminGroup := generalGroup.Group("/admin", AdminMiddleware)
+	adminController.AdminRoutes(adminGroup)
+
 	webhooksController := WebhooksController{Google: googleService, FirebaseApp: firebaseApp}
 	webhookGroup := e.Group("/webhooks")
 	webhooksController.SetupRoutes(webhookGroup)
@@ -1,11 +1,21 @@
 package controllers
 
 import (
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"math/rand"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
+	"letryapi/services"
+
+	"github.com/getsentry/sentry-go"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/labstack/echo/v4"
 )
@@ -102,3 +112,35 @@ func RandomInviteCode(n int) string {
 	}
 	return string(b)
 }
+
+// uploadImageExtensions are the file extensions accepted for image uploads with a server-side key
+var uploadImageExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".webp": true, ".heic": true, ".heif": true}
+
+// randomUploadKey builds an R2 key under prefix from random bytes and the extension of fileName, so the name
+// sent by the app never becomes a part of the key. Extensions that are not images are rejected.
+func randomUploadKey(prefix string, fileName string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if !uploadImageExtensions[ext] {
+		return "", fmt.Errorf("unsupported file type %q, please upload a JPEG, PNG, WebP or HEIC image", ext)
+	}
+	b := make([]byte, 16)
+	if _, err := cryptorand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s%s", prefix, hex.EncodeToString(b), ext), nil
+}
+
+// confirmUploadError responds to a failed services.VerifyImageUpload of a confirm-upload request.
+// Missing and rejected uploads can be uploaded again with the same presigned URL while it is valid.
+func confirmUploadError(c echo.Context, err error) error {
+	var rejected *services.UploadRejectedError
+	switch {
+	case errors.Is(err, services.ErrR2ObjectNotFound):
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Image is not uploaded yet, please upload it first"})
+	case errors.As(err, &rejected):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": rejected.Reason})
+	default:
+		sentry.CaptureException(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to confirm upload, please try again"})
+	}
+}
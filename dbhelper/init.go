@@ -53,6 +53,9 @@ func SetupDB() *gorm.DB {
 	Migrate(db, &models.ClothingTryonGeneration{})
 	Migrate(db, &models.Clothing{})
 	Migrate(db, &models.UserPushToken{})
+	Migrate(db, &models.PromptTemplate{})
+	Migrate(db, &models.UserAvatar{})
+	Migrate(db, &models.LLMUsage{})
 
 	return db
 }
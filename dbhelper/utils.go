@@ -12,11 +12,14 @@ func SetupCleaner(db *gorm.DB) func() {
 	return func() {
 
 		db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.ClothingTryonGeneration{})
+		db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.UserAvatar{})
 		db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.Clothing{})
 		db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.UserCompanyRole{})
 		db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.Company{})
 		db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.UserPushToken{})
 		db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.UserAccount{})
+		db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.PromptTemplate{})
+		db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.LLMUsage{})
 
 	}
 }
@@ -82,6 +82,7 @@ type UserMeInfoV2Out struct {
 	AvatarURL                            string                 `json:"avatar_url"`
 	ReceiveSalesNotifications            bool                   `json:"receive_notifications"`
 	FullBodyAvatarUrl                    *string                `json:"user_fullbody_avatar_url"`
+	FullBodyTransparentAvatarUrl         *string                `json:"user_fullbody_transparent_avatar_url"`
 	FullBodyAvatarProcessingErrorMessage *string                `json:"full_body_avatar_processing_error_message"`
 	FullBodyAvatarSet                    bool                   `json:"full_body_avatar_set"`
 	FullBodyAvatarStatus                 string                 `json:"full_body_avatar_status"`
@@ -94,6 +95,8 @@ type UserMeInfoV2Out struct {
 	Weight         *int    `json:"weight"`
 	Height         *string `json:"height"`
 	WaistSize      *int    `json:"waist_size"`
+	// active values with their source and the AI suggestions
+	Characteristics map[string]CharacteristicOut `json:"characteristics"`
 }
 
 type UserInfoOut struct {
@@ -141,6 +144,8 @@ type CompanyOverviewOut struct {
 	DefaulTotalNoteLimit   int32           `json:"default_total_note_limit"`
 	FullAdminAccess        bool            `json:"full_admin_access"`
 	LLMModel               *int32          `json:"llm_model"`
+	// models tried in order per operation, see Company.LLMFallbackChains
+	LLMFallbackChains map[string][]int32 `json:"llm_fallback_chains,omitempty"`
 }
 
 type CompanyInfoOut struct {
@@ -160,6 +165,8 @@ type CompanyUpdateIn struct {
 	Name     *string `json:"name"`
 	LLMModel *int32  `json:"llm_model"`
 	Language *string `json:"language"`
+	// replaces all chains of the company, an empty object goes back to the global chains
+	LLMFallbackChains map[string][]int32 `json:"llm_fallback_chains"`
 }
 
 type MemberAddIn struct {
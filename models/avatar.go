@@ -0,0 +1,80 @@
+package models
+
+import "time"
+
+// UserAvatar is one of the saved full body avatars of a user (hairstyles, glasses, seasons...).
+// The default avatar is mirrored into the UserAccount avatar and characteristics fields.
+type UserAvatar struct {
+	JsonModel
+	UserAccountID uint        `gorm:"index" json:"-"`
+	UserAccount   UserAccount `json:"-"`
+	IsDefault     bool        `gorm:"default:false" json:"is_default"`
+	// photo uploaded by the user
+	SourceImageURL string `json:"-"`
+	// draft until the upload is confirmed, rows created before confirm-upload are uploaded
+	ImageStatus     string     `gorm:"default:uploaded" json:"image_status"` // draft, uploaded, expired
+	UploadExpiresAt *time.Time `json:"upload_expires_at"`
+	// generated e-commerce style avatar used for try ons
+	ImageURL               *string `json:"-"`
+	Status                 string  `gorm:"default:processing" json:"status"` // processing, completed, failed
+	ProcessingErrorMessage *string `json:"processing_error_message"`
+	ProcessRetryTimes      int     `json:"-"`
+
+	// generated avatar with the background as alpha channel
+	TransparentImageURL *string `json:"-"`
+
+	// Person characteristics for avatar generation
+	BodyType       *string `json:"body_type"`
+	ShoulderType   *string `json:"shoulder_type"`
+	BodyToLegRatio *string `json:"body_to_leg_ratio"`
+	HandType       *string `json:"hand_type"`
+	UpperLimbType  *string `json:"upper_limb_type"`
+	Weight         *int    `json:"weight"`
+	Height         *string `json:"height"`
+	WaistSize      *int    `json:"waist_size"`
+
+	PromptVersion                *string `json:"prompt_version"`
+	CharacteristicsPromptVersion *string `json:"characteristics_prompt_version"`
+	QualityCheckFailReason       *string `json:"quality_check_fail_reason"`
+	QualityRegenerations         int     `json:"quality_regenerations"`
+	LLMTotalTokenCount           *int32  `json:"llm_total_token_count"`
+	LLMInputTokenCount           *int32  `json:"llm_input_token_count"`
+	LLMThoughtsTokenCount        *int32  `json:"llm_thoughts_token_count"`
+	LLMOutputTokenCount          *int32  `json:"llm_output_token_count"`
+	LLMThoughts                  *string `json:"llm_thoughts"`
+	LLMModel                     *string `json:"llm_model"`
+}
+
+// ApplyToUser mirrors the avatar into the user fields the rest of the app reads.
+func (a UserAvatar) ApplyToUser(user *UserAccount) {
+	if a.ImageURL != nil {
+		user.UserFullBodyImageURL = a.ImageURL
+	} else {
+		sourceImageURL := a.SourceImageURL
+		user.UserFullBodyImageURL = &sourceImageURL
+	}
+	user.UserFullBodyTransparentImageURL = a.TransparentImageURL
+	user.FullBodyAvatarStatus = a.Status
+	user.FullBodyAvatarProcessingErrorMessage = a.ProcessingErrorMessage
+	// avatar characteristics come from the AI, values the user entered by hand stay
+	user.ApplyAICharacteristics(PersonCharacteristicValues{
+		BodyType:       a.BodyType,
+		ShoulderType:   a.ShoulderType,
+		BodyToLegRatio: a.BodyToLegRatio,
+		HandType:       a.HandType,
+		UpperLimbType:  a.UpperLimbType,
+		Weight:         a.Weight,
+		Height:         a.Height,
+		WaistSize:      a.WaistSize,
+	}, a.UpdatedAt)
+	user.PromptVersion = a.PromptVersion
+	user.CharacteristicsPromptVersion = a.CharacteristicsPromptVersion
+	user.AvatarQualityCheckFailReason = a.QualityCheckFailReason
+	user.AvatarQualityRegenerations = a.QualityRegenerations
+}
+
+type UserAvatarOut struct {
+	UserAvatar
+	ImageURL            *string `json:"image_url"`
+	TransparentImageURL *string `json:"transparent_image_url"`
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+type CharacteristicSource string
+
+const (
+	CharacteristicSourceAI   CharacteristicSource = "ai"
+	CharacteristicSourceUser CharacteristicSource = "user"
+)
+
+// body characteristic attribute names, same as their json names
+const (
+	CharacteristicBodyType       = "body_type"
+	CharacteristicShoulderType   = "shoulder_type"
+	CharacteristicBodyToLegRatio = "body_to_leg_ratio"
+	CharacteristicHandType       = "hand_type"
+	CharacteristicUpperLimbType  = "upper_limb_type"
+	CharacteristicWeight         = "weight"
+	CharacteristicHeight         = "height"
+	CharacteristicWaistSize      = "waist_size"
+)
+
+// CharacteristicProvenance tells where the active value of a body characteristic came from.
+type CharacteristicProvenance struct {
+	Source    CharacteristicSource `json:"source"`
+	UpdatedAt time.Time            `json:"updated_at"`
+	// latest value suggested by the AI, kept even when the user value is active
+	AISuggestion *string `json:"ai_suggestion"`
+}
+
+// CharacteristicsProvenance is keyed by the attribute name, e.g. CharacteristicWeight.
+type CharacteristicsProvenance map[string]CharacteristicProvenance
+
+// PersonCharacteristicValues is the set of body characteristics of a person.
+type PersonCharacteristicValues struct {
+	BodyType       *string
+	ShoulderType   *string
+	BodyToLegRatio *string
+	HandType       *string
+	UpperLimbType  *string
+	Weight         *int
+	Height         *string
+	WaistSize      *int
+}
+
+// ApplyAICharacteristics stores the AI suggestions and makes them active
+// for every attribute the user did not enter by hand.
+func (u *UserAccount) ApplyAICharacteristics(values PersonCharacteristicValues, at time.Time) {
+	if u.CharacteristicsProvenance == nil {
+		u.CharacteristicsProvenance = CharacteristicsProvenance{}
+	}
+	p := u.CharacteristicsProvenance
+	applyAICharacteristic(p, CharacteristicBodyType, &u.BodyType, values.BodyType, at)
+	applyAICharacteristic(p, CharacteristicShoulderType, &u.ShoulderType, values.ShoulderType, at)
+	applyAICharacteristic(p, CharacteristicBodyToLegRatio, &u.BodyToLegRatio, values.BodyToLegRatio, at)
+	applyAICharacteristic(p, CharacteristicHandType, &u.HandType, values.HandType, at)
+	applyAICharacteristic(p, CharacteristicUpperLimbType, &u.UpperLimbType, values.UpperLimbType, at)
+	applyAICharacteristic(p, CharacteristicWeight, &u.Weight, values.Weight, at)
+	applyAICharacteristic(p, CharacteristicHeight, &u.Height, values.Height, at)
+	applyAICharacteristic(p, CharacteristicWaistSize, &u.WaistSize, values.WaistSize, at)
+}
+
+// MarkUserCharacteristic records that the user entered the attribute by hand, AI output will not overwrite it anymore.
+func (u *UserAccount) MarkUserCharacteristic(name string, at time.Time) {
+	if u.CharacteristicsProvenance == nil {
+		u.CharacteristicsProvenance = CharacteristicsProvenance{}
+	}
+	provenance := u.CharacteristicsProvenance[name]
+	provenance.Source = CharacteristicSourceUser
+	provenance.UpdatedAt = at
+	u.CharacteristicsProvenance[name] = provenance
+}
+
+func applyAICharacteristic[T any](p CharacteristicsProvenance, name string, field **T, value *T, at time.Time) {
+	if value == nil {
+		return
+	}
+	provenance := p[name]
+	suggestion := fmt.Sprint(*value)
+	provenance.AISuggestion = &suggestion
+	if provenance.Source != CharacteristicSourceUser {
+		provenance.Source = CharacteristicSourceAI
+		provenance.UpdatedAt = at
+		*field = value
+	}
+	p[name] = provenance
+}
+
+type CharacteristicOut struct {
+	Value        any                  `json:"value"`
+	Source       CharacteristicSource `json:"source"`
+	UpdatedAt    *time.Time           `json:"updated_at"`
+	AISuggestion *string              `json:"ai_suggestion"`
+}
+
+// CharacteristicsOut returns the active value of each attribute together with its source and the AI suggestion.
+func (u UserAccount) CharacteristicsOut() map[string]CharacteristicOut {
+	values := map[string]any{
+		CharacteristicBodyType:       u.BodyType,
+		CharacteristicShoulderType:   u.ShoulderType,
+		CharacteristicBodyToLegRatio: u.BodyToLegRatio,
+		CharacteristicHandType:       u.HandType,
+		CharacteristicUpperLimbType:  u.UpperLimbType,
+		CharacteristicWeight:         u.Weight,
+		CharacteristicHeight:         u.Height,
+		CharacteristicWaistSize:      u.WaistSize,
+	}
+	out := make(map[string]CharacteristicOut, len(values))
+	for name, value := range values {
+		item := CharacteristicOut{Value: value}
+		if provenance, ok := u.CharacteristicsProvenance[name]; ok {
+			item.Source = provenance.Source
+			item.AISuggestion = provenance.AISuggestion
+			if !provenance.UpdatedAt.IsZero() {
+				updatedAt := provenance.UpdatedAt
+				item.UpdatedAt = &updatedAt
+			}
+		}
+		out[name] = item
+	}
+	return out
+}
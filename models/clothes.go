@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type Clothing struct {
 	JsonModel
 	Name        string   `json:"name"`
@@ -22,16 +24,23 @@ type Clothing struct {
 	CompanyID    uint        `json:"-"`
 	Company      Company     `json:"company"`
 	Status       string      `json:"status"`       // temporary, in_closet
-	ImageStatus  string      `json:"image_status"` // draft, uploaded
+	ImageStatus  string      `json:"image_status"` // draft, uploaded, expired
+	// drafts not confirmed with confirm-upload until then are expired
+	UploadExpiresAt *time.Time `json:"upload_expires_at"`
 
 	// Whitening background to make it e-commerce flat image of the garment
-	ProcessingStatus    string  `json:"processing_status"` // idle, generating, completed, failed
+	ProcessingStatus    string  `json:"processing_status"` // idle, pending, completed, failed, cancelled
 	ProcessRetryTimes   int     `json:"process_retry_times"`
 	ProcessErrorMessage *string `json:"process_error_message"`
 	ImageURL            *string `json:"image_url"`
+	// the upload with its background whitened, e-commerce style
+	WhiteImageURL *string `json:"white_image_url"`
+	// same garment with the background as alpha channel, for stickers and outfit boards
+	TransparentImageURL *string `json:"transparent_image_url"`
 
 	LLMTokenUsage         *int    `json:"llm_token_usage"`
 	LLMModel              *string `json:"llm_model"`
+	PromptVersion         *string `json:"prompt_version"` // identify_clothing prompt version
 	LLMInputTokenCount    *int32  `json:"llm_input_token_usage"`
 	LLMOutputTokenCount   *int32  `json:"llm_output_token_usage"`
 	LLMTotalTokenCount    *int32  `json:"llm_total_token_usage"`
@@ -58,17 +67,32 @@ type ClothingTryonGeneration struct {
 
 	// user avatar at the point of generation
 	GeneratedWithAvatarURL string `json:"generated_with_avatar_url"`
+	// saved avatar picked for the generation, nil means the default avatar of the user
+	AvatarID *uint `json:"avatar_id"`
+	// hash of clothing images, avatar, characteristics and prompt version to reuse identical generations
+	CacheKey *string `gorm:"index" json:"cache_key"`
+
+	// presentation presets, see services.TryOnOptions
+	Scene       string `gorm:"default:studio_white" json:"scene"`
+	Pose        string `gorm:"default:relaxed" json:"pose"`
+	AspectRatio string `gorm:"default:9:16" json:"aspect_ratio"`
+	// R2 key of the uploaded background when scene is custom
+	BackgroundImageURL *string `json:"background_image_url"`
 
-	TryOnPreviewImageURL   *string  `json:"try_on_preview_image_url"`
-	Status                 string   `json:"status"`   // pending, completed, failed
-	Duration               *float64 `json:"duration"` // in seconds
-	LLMTokenUsage          *int     `json:"llm_token_usage"`
-	LLMModel               *string  `json:"llm_model"`
-	LLMInputTokenCount     *int32   `json:"llm_input_token_usage"`
-	LLMOutputTokenCount    *int32   `json:"llm_output_token_usage"`
-	LLMTotalTokenCount     *int32   `json:"llm_total_token_usage"`
-	LLMThoughtsTokenCount  *int32   `json:"llm_thoughts_token_count"`
-	LLMThoughts            *string  `json:"llm_thoughts"`
-	GenerationRetryTimes   int      `json:"generation_retry_times"`
-	GenerationErrorMessage *string  `json:"generation_error_message"`
+	TryOnPreviewImageURL *string  `json:"try_on_preview_image_url"`
+	Status               string   `json:"status"`   // awaiting_background, pending, completed, failed, cancelled
+	Duration             *float64 `json:"duration"` // in seconds
+	LLMTokenUsage        *int     `json:"llm_token_usage"`
+	LLMModel             *string  `json:"llm_model"`
+	PromptVersion        *string  `json:"prompt_version"` // tryon prompt version
+	// last reason the generated image failed the quality gate and how many times it was regenerated
+	QualityCheckFailReason *string `json:"quality_check_fail_reason"`
+	QualityRegenerations   int     `json:"quality_regenerations"`
+	LLMInputTokenCount     *int32  `json:"llm_input_token_usage"`
+	LLMOutputTokenCount    *int32  `json:"llm_output_token_usage"`
+	LLMTotalTokenCount     *int32  `json:"llm_total_token_usage"`
+	LLMThoughtsTokenCount  *int32  `json:"llm_thoughts_token_count"`
+	LLMThoughts            *string `json:"llm_thoughts"`
+	GenerationRetryTimes   int     `json:"generation_retry_times"`
+	GenerationErrorMessage *string `json:"generation_error_message"`
 }
@@ -0,0 +1,36 @@
+package models
+
+// LLMUsage is one call to a model. Rows are only appended, retries and every pass of a task get their own row.
+type LLMUsage struct {
+	JsonModel
+	CompanyID     *uint  `gorm:"index" json:"company_id"`
+	UserAccountID *uint  `gorm:"index" json:"user_account_id"`
+	Operation     string `gorm:"index" json:"operation"` // tryon, avatar, person_characteristics, identify_clothing
+	// id of the try-on, clothing or avatar the call was made for
+	EntityID           *uint   `json:"entity_id"`
+	Model              string  `gorm:"index" json:"model"`
+	InputTokenCount    int32   `json:"input_token_count"`
+	OutputTokenCount   int32   `json:"output_token_count"`
+	ThoughtsTokenCount int32   `json:"thoughts_token_count"`
+	TotalTokenCount    int32   `json:"total_token_count"`
+	ImageCount         int     `json:"image_count"`
+	LatencyMs          int64   `json:"latency_ms"`
+	Success            bool    `json:"success"`
+	ErrorMessage       *string `json:"error_message"`
+	CostUSD            float64 `json:"cost_usd"`
+}
+
+// LLMUsageReportRow is the usage of one model by one company on one day
+type LLMUsageReportRow struct {
+	Day                string  `json:"day"`
+	CompanyID          *uint   `json:"company_id"`
+	Model              string  `json:"model"`
+	Calls              int64   `json:"calls"`
+	FailedCalls        int64   `json:"failed_calls"`
+	InputTokenCount    int64   `json:"input_token_count"`
+	OutputTokenCount   int64   `json:"output_token_count"`
+	ThoughtsTokenCount int64   `json:"thoughts_token_count"`
+	ImageCount         int64   `json:"image_count"`
+	AvgLatencyMs       float64 `json:"avg_latency_ms"`
+	CostUSD            float64 `json:"cost_usd"`
+}
@@ -0,0 +1,14 @@
+package models
+
+// PromptTemplate overrides or adds a prompt version without a deploy.
+// Template is a text/template with "system" and/or "user" blocks; when empty,
+// the embedded file of the same name and version is used, so embedded versions can take part in A/B splits.
+type PromptTemplate struct {
+	JsonModel
+	Name     string `gorm:"uniqueIndex:idx_prompt_name_version" json:"name"` // tryon, avatar, avatar_characteristics, person_characteristics, identify_clothing
+	Version  string `gorm:"uniqueIndex:idx_prompt_name_version" json:"version"`
+	Template string `gorm:"type:text" json:"template"`
+	// share of new jobs assigned to this version among the active versions of the same prompt
+	Weight int  `gorm:"default:0" json:"weight"`
+	Active bool `gorm:"default:false" json:"active"`
+}
@@ -42,6 +42,16 @@ type UserAccount struct {
 	LLMOutputTokenCount   *int32  `json:"llm_output_token_count"`
 	LLMThoughts           *string `json:"llm_thoughts"`
 	LLMModel              *string `json:"llm_model"`
+
+	// same full body avatar with a transparent background
+	UserFullBodyTransparentImageURL *string `json:"user_transparent_image_url"`
+
+	// prompt versions used for the full body avatar
+	PromptVersion                *string `json:"prompt_version"`
+	CharacteristicsPromptVersion *string `json:"characteristics_prompt_version"`
+	// last reason the generated avatar failed the quality gate and how many times it was regenerated
+	AvatarQualityCheckFailReason *string `json:"avatar_quality_check_fail_reason"`
+	AvatarQualityRegenerations   int     `json:"avatar_quality_regenerations"`
 	// Person characteristics for avatar generation
 	BodyType       *string `json:"body_type"`
 	ShoulderType   *string `json:"shoulder_type"`
@@ -51,6 +61,8 @@ type UserAccount struct {
 	Weight         *int    `json:"weight"`
 	Height         *string `json:"height"`
 	WaistSize      *int    `json:"waist_size"`
+	// source (ai, user), timestamp and AI suggestion per characteristic
+	CharacteristicsProvenance CharacteristicsProvenance `gorm:"serializer:json" json:"characteristics_provenance"`
 	// Active                    bool `json:"active"`
 }
 
@@ -104,6 +116,15 @@ type Company struct {
 	EnforcedDailyTryOnLimit    *int32            `json:"enforced_daily_try_on_limit"`
 	EnforcedLLMModel           *int32            `json:"enforced_llm_model"`
 	FullAdminAccess            bool              `json:"full_admin_access"`
+	// models tried in order per operation, e.g. {"tryon": [4, 5]}, operations missing here use the global chains
+	LLMFallbackChains map[string][]int32 `gorm:"serializer:json" json:"llm_fallback_chains"`
+	// monthly LLM budget on the LLMUsage ledger, either or both may be set
+	MonthlyLLMBudgetUSD   *float64 `json:"monthly_llm_budget_usd"`
+	MonthlyLLMTokenBudget *int64   `json:"monthly_llm_token_budget"`
+	LLMBudgetAction       string   `gorm:"default:refuse" json:"llm_budget_action"` // refuse, downgrade
+	// last budget notification sent to the owner, e.g. 2025-10 and 80
+	LLMBudgetNotifiedPeriod *string `json:"-"`
+	LLMBudgetNotifiedLevel  int     `json:"-"`
 }
 
 type CompanySubscription struct {
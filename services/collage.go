@@ -0,0 +1,120 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+	"unicode"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	collageCellWidth  = 540
+	collageCellHeight = 960
+	collagePadding    = 20
+	collageLineHeight = 18
+	collageMaxLines   = 4
+)
+
+type CollageItem struct {
+	ImageBytes []byte
+	// lines written under the image, e.g. names of the worn clothes
+	Labels []string
+}
+
+// BuildComparisonCollage lays out 2 to 4 images in a grid (two per row) on a white canvas,
+// writing each item's labels underneath its image, and returns the collage as PNG.
+func BuildComparisonCollage(items []CollageItem) ([]byte, error) {
+	if len(items) < 2 || len(items) > 4 {
+		return nil, fmt.Errorf("collage needs 2 to 4 images, got %d", len(items))
+	}
+	columns := 2
+	rows := (len(items) + columns - 1) / columns
+	labelHeight := collageMaxLines*collageLineHeight + collagePadding
+	cellTotalHeight := collageCellHeight + labelHeight
+
+	canvas := image.NewRGBA(image.Rect(0, 0,
+		columns*collageCellWidth+(columns+1)*collagePadding,
+		rows*cellTotalHeight+(rows+1)*collagePadding,
+	))
+	draw.Draw(canvas, canvas.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+
+	for i, item := range items {
+		img, _, err := image.Decode(bytes.NewReader(item.ImageBytes))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image %d: %w", i, err)
+		}
+		cellX := collagePadding + (i%columns)*(collageCellWidth+collagePadding)
+		cellY := collagePadding + (i/columns)*(cellTotalHeight+collagePadding)
+
+		// fit inside the cell keeping the ratio and center it
+		fitted := imaging.Fit(img, collageCellWidth, collageCellHeight, imaging.Lanczos)
+		offsetX := cellX + (collageCellWidth-fitted.Bounds().Dx())/2
+		offsetY := cellY + (collageCellHeight-fitted.Bounds().Dy())/2
+		draw.Draw(canvas, fitted.Bounds().Add(image.Pt(offsetX, offsetY)), fitted, fitted.Bounds().Min, draw.Over)
+
+		drawCollageLabels(canvas, item.Labels, cellX, cellY+collageCellHeight+collagePadding)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, canvas); err != nil {
+		return nil, fmt.Errorf("failed to encode collage: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func drawCollageLabels(canvas *image.RGBA, labels []string, x int, y int) {
+	face := basicfont.Face7x13
+	maxChars := collageCellWidth / face.Advance
+	drawer := &font.Drawer{
+		Dst:  canvas,
+		Src:  image.NewUniform(color.Black),
+		Face: face,
+	}
+	for i, label := range labels {
+		if i >= collageMaxLines {
+			break
+		}
+		label = asciiLabel(label)
+		if len(label) > maxChars {
+			label = label[:maxChars-3] + "..."
+		}
+		// center the line under the image
+		textWidth := drawer.MeasureString(label).Ceil()
+		drawer.Dot = fixed.P(x+(collageCellWidth-textWidth)/2, y+i*collageLineHeight+face.Ascent)
+		drawer.DrawString(label)
+	}
+}
+
+// letters that don't decompose into an ASCII letter and a mark
+var labelLetters = strings.NewReplacer(
+	"ß", "ss", "æ", "ae", "Æ", "AE", "œ", "oe", "Œ", "OE",
+	"ø", "o", "Ø", "O", "ł", "l", "Ł", "L", "đ", "d", "Đ", "D",
+)
+
+// asciiLabel transliterates a label for basicfont, which only draws ASCII: accents are dropped
+// ("Été" becomes "Ete") and the characters left outside ASCII become "?".
+func asciiLabel(label string) string {
+	stripMarks := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	stripped, _, err := transform.String(stripMarks, labelLetters.Replace(label))
+	if err != nil {
+		stripped = label
+	}
+	return strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return '?'
+		}
+		return r
+	}, stripped)
+}
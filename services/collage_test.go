@@ -0,0 +1,85 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func solidTestImage(t *testing.T, width int, height int, c color.NRGBA) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return encodeTestImage(t, img, "png")
+}
+
+func TestBuildComparisonCollage(t *testing.T) {
+	red := color.NRGBA{R: 255, A: 255}
+	blue := color.NRGBA{B: 255, A: 255}
+	cellTotalHeight := collageCellHeight + collageMaxLines*collageLineHeight + collagePadding
+	width := 2*collageCellWidth + 3*collagePadding
+
+	for _, count := range []int{2, 3, 4} {
+		items := make([]CollageItem, count)
+		for i := range items {
+			c := red
+			if i%2 == 1 {
+				c = blue
+			}
+			// half as wide as tall, fitted to 480x960 in a 540x960 cell
+			items[i] = CollageItem{ImageBytes: solidTestImage(t, 100, 200, c), Labels: []string{"Robe d'été", "Größe M"}}
+		}
+		collage, err := BuildComparisonCollage(items)
+		if err != nil {
+			t.Fatalf("%d items: %v", count, err)
+		}
+		img, err := png.Decode(bytes.NewReader(collage))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := (count + 1) / 2
+		if got, want := img.Bounds(), image.Rect(0, 0, width, rows*cellTotalHeight+(rows+1)*collagePadding); got != want {
+			t.Fatalf("%d items: collage is %v, expected %v", count, got, want)
+		}
+
+		for i := 0; i < count; i++ {
+			cellX := collagePadding + (i%2)*(collageCellWidth+collagePadding)
+			cellY := collagePadding + (i/2)*(cellTotalHeight+collagePadding)
+			r, _, b, _ := img.At(cellX+collageCellWidth/2, cellY+collageCellHeight/2).RGBA()
+			if (i%2 == 0 && r>>8 != 255) || (i%2 == 1 && b>>8 != 255) {
+				t.Errorf("%d items: image %d is not centered in its cell", count, i)
+			}
+			// the fitted image leaves a 30px white margin on both sides of the cell
+			if r, g, b, _ := img.At(cellX+10, cellY+collageCellHeight/2).RGBA(); r>>8 != 255 || g>>8 != 255 || b>>8 != 255 {
+				t.Errorf("%d items: image %d is not fitted to the cell", count, i)
+			}
+		}
+	}
+
+	for _, count := range []int{1, 5} {
+		items := make([]CollageItem, count)
+		if _, err := BuildComparisonCollage(items); err == nil {
+			t.Errorf("expected an error for %d items", count)
+		}
+	}
+}
+
+func TestASCIILabel(t *testing.T) {
+	for label, want := range map[string]string{
+		"Robe d'été":    "Robe d'ete",
+		"Größe M":       "Grosse M",
+		"Łódź jacket":   "Lodz jacket",
+		"Jupe 春":        "Jupe ?",
+		"plain T-shirt": "plain T-shirt",
+	} {
+		if got := asciiLabel(label); got != want {
+			t.Errorf("asciiLabel(%q) = %q, expected %q", label, got, want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"archive/zip"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -77,8 +78,13 @@ func StrPointer(str string) *string {
 }
 
 func ReadFileFromUrl(url string) ([]byte, error) {
+	return ReadFileFromUrlContext(context.Background(), url)
+}
+
+// ReadFileFromUrlContext is ReadFileFromUrl that aborts the download when ctx is done.
+func ReadFileFromUrlContext(ctx context.Context, url string) ([]byte, error) {
 	httpClient := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create HTTP request: %v", err)
 	}
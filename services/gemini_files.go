@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// geminiFileExpiryMargin keeps a cached file from expiring between the lookup and the generate call
+const geminiFileExpiryMargin = 1 * time.Hour
+
+// geminiFileTTL is used when the API does not tell the expiration, Gemini keeps uploads for 48 hours
+const geminiFileTTL = 48 * time.Hour
+
+type imageSourcesKey struct{}
+
+// WithImageSources attaches the R2 key of local image files to ctx. GoogleLLMProcessor uses them together
+// with the content hash to reuse files it already uploaded to Gemini, e.g. the avatar of repeat try-ons.
+func WithImageSources(ctx context.Context, sources map[string]string) context.Context {
+	merged := map[string]string{}
+	if existing, ok := ctx.Value(imageSourcesKey{}).(map[string]string); ok {
+		for path, key := range existing {
+			merged[path] = key
+		}
+	}
+	for path, key := range sources {
+		if path != "" && key != "" {
+			merged[path] = key
+		}
+	}
+	return context.WithValue(ctx, imageSourcesKey{}, merged)
+}
+
+func imageSource(ctx context.Context, filePath string) string {
+	sources, _ := ctx.Value(imageSourcesKey{}).(map[string]string)
+	return sources[filePath]
+}
+
+// GeminiFileCache maps an R2 key and content hash to the file uploaded to Gemini until the file expires.
+type GeminiFileCache struct {
+	mu    sync.Mutex
+	files map[string]*genai.File
+	now   func() time.Time
+}
+
+func NewGeminiFileCache() *GeminiFileCache {
+	return &GeminiFileCache{files: map[string]*genai.File{}, now: time.Now}
+}
+
+func geminiFileCacheKey(source, contentHash string) string {
+	if source == "" {
+		// local files, e.g. the white canvas, are only known by content
+		source = "local"
+	}
+	return source + "#" + contentHash
+}
+
+// Get returns the cached file when it is still usable for at least geminiFileExpiryMargin.
+func (c *GeminiFileCache) Get(key string) (*genai.File, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	file, ok := c.files[key]
+	if !ok {
+		return nil, false
+	}
+	if !file.ExpirationTime.After(c.now().Add(geminiFileExpiryMargin)) {
+		delete(c.files, key)
+		return nil, false
+	}
+	return file, true
+}
+
+func (c *GeminiFileCache) Put(key string, file *genai.File) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if file.ExpirationTime.IsZero() {
+		copied := *file
+		copied.ExpirationTime = now.Add(geminiFileTTL)
+		file = &copied
+	}
+	for cachedKey, cached := range c.files {
+		if !cached.ExpirationTime.After(now) {
+			delete(c.files, cachedKey)
+		}
+	}
+	c.files[key] = file
+}
+
+func fileContentHash(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// genaiClient returns the client shared by all calls of the processor, created on first use.
+func (p *GoogleLLMProcessor) genaiClient(ctx context.Context) (*genai.Client, error) {
+	p.clientOnce.Do(func() {
+		if p.client != nil {
+			return
+		}
+		if os.Getenv("GOOGLE_API_KEY") == "" {
+			p.clientErr = fmt.Errorf("GOOGLE_API_KEY is not set, set LLM_PROVIDER=offline to run without Gemini")
+			return
+		}
+		p.client, p.clientErr = genai.NewClient(ctx, &genai.ClientConfig{
+			APIKey:  os.Getenv("GOOGLE_API_KEY"),
+			Backend: genai.BackendGeminiAPI,
+		})
+	})
+	if p.clientErr != nil {
+		return nil, fmt.Errorf("error creating genai client: %v", p.clientErr)
+	}
+	return p.client, nil
+}
+
+// uploadFile uploads the image to Gemini unless the same content of the same R2 key was uploaded before.
+func (p *GoogleLLMProcessor) uploadFile(ctx context.Context, client *genai.Client, filePath string) (*genai.File, error) {
+	if p.files == nil {
+		return tryUploadGoogleStorage(ctx, client, filePath, nil)
+	}
+	contentHash, err := fileContentHash(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error hashing file %s: %v", filePath, err)
+	}
+	key := geminiFileCacheKey(imageSource(ctx, filePath), contentHash)
+	if file, ok := p.files.Get(key); ok {
+		fmt.Println("Reusing uploaded file:", filePath, file.URI)
+		return file, nil
+	}
+	file, err := tryUploadGoogleStorage(ctx, client, filePath, nil)
+	if err != nil {
+		return nil, err
+	}
+	p.files.Put(key, file)
+	return file, nil
+}
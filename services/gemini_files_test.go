@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+func TestGeminiFileCache(t *testing.T) {
+	now := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewGeminiFileCache()
+	cache.now = func() time.Time { return now }
+
+	avatarKey := geminiFileCacheKey("avatars/1.png", "abc")
+	cache.Put(avatarKey, &genai.File{URI: "files/avatar", ExpirationTime: now.Add(48 * time.Hour)})
+	if file, ok := cache.Get(avatarKey); !ok || file.URI != "files/avatar" {
+		t.Fatalf("expected the avatar to be cached")
+	}
+	if _, ok := cache.Get(geminiFileCacheKey("avatars/1.png", "def")); ok {
+		t.Fatalf("new content under the same key must be uploaded again")
+	}
+
+	// files without expiration get the Gemini default
+	canvasKey := geminiFileCacheKey("", "abc")
+	cache.Put(canvasKey, &genai.File{URI: "files/canvas"})
+	if _, ok := cache.Get(canvasKey); !ok {
+		t.Fatalf("expected the canvas to be cached")
+	}
+
+	now = now.Add(47*time.Hour + 30*time.Minute)
+	if _, ok := cache.Get(avatarKey); ok {
+		t.Fatalf("a file about to expire must not be reused")
+	}
+}
+
+func TestWithImageSources(t *testing.T) {
+	ctx := WithImageSources(context.Background(), map[string]string{"/tmp/a.png": "avatars/a.png"})
+	ctx = WithImageSources(ctx, map[string]string{"/tmp/b.png": "clothes/b.png", "": "ignored"})
+	if imageSource(ctx, "/tmp/a.png") != "avatars/a.png" || imageSource(ctx, "/tmp/b.png") != "clothes/b.png" {
+		t.Fatalf("expected both sources to be kept")
+	}
+	if imageSource(context.Background(), "/tmp/a.png") != "" {
+		t.Fatalf("expected no source without WithImageSources")
+	}
+}
+
+func TestGoogleLLMProcessorUploadRateLimitIsTransient(t *testing.T) {
+	imagePath := filepath.Join(t.TempDir(), "person.png")
+	if err := os.WriteFile(imagePath, []byte("\x89PNG\r\n\x1a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"code":429,"message":"Resource has been exhausted","status":"RESOURCE_EXHAUSTED"}}`))
+	}))
+	defer server.Close()
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		APIKey:      "test-key",
+		Backend:     genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL + "/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	processor := &GoogleLLMProcessor{client: client}
+
+	prompt := &RenderedPrompt{System: "system", User: "user"}
+	if _, err := processor.GenerateTryOn(context.Background(), imagePath, []string{imagePath}, TryOnOptions{}, prompt, Flash25Image); !errors.Is(err, ErrTransientUpstream) {
+		t.Fatalf("expected the 429 of the try-on upload to be transient, got %v", err)
+	}
+	if _, err := processor.AnalyzePersonCharacteristics(context.Background(), imagePath, prompt, Pro25); !errors.Is(err, ErrTransientUpstream) {
+		t.Fatalf("expected the 429 of the characteristics upload to be transient, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := processor.IdentifyClothing(ctx, imagePath, prompt, Pro25); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the cancellation of the task, got %v", err)
+	}
+}
@@ -2,12 +2,13 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"google.golang.org/genai"
 )
@@ -43,11 +44,16 @@ func (t LLMModelName) String() string {
 		return "gemini-2.5-flash-image-preview"
 	case Flash20:
 		return "gemini-2.0-flash"
+	case Seedream40:
+		return "seedream-4-0-250828"
 	default:
 		return "gemini-2.0-flash"
 	}
 }
 
+// whiteCanvasPath is the white background sent along with avatars, it must exist in the working directory of the worker
+const whiteCanvasPath = "./white_540x960.png"
+
 func floatPointer(f float32) *float32 {
 	return &f
 }
@@ -158,16 +164,17 @@ type LLMResponse struct {
 	OutputTokenCount   int32    `json:"output_token_count"`
 	TotalTokenCount    int32    `json:"total_token_count"`
 	IsTest             bool     `json:"is_test"`
-	// to add
+	// Identification is the validated answer of IdentifyClothing
+	Identification *ClothingIdentificationResponse `json:"identification,omitempty"`
+	// Characteristics is the validated answer of AnalyzePersonCharacteristics
+	Characteristics *PersonCharacteristics `json:"characteristics,omitempty"`
 }
 
 type LLMProcessor interface {
-	ProcessClothing(filePath string, modelName LLMModelName) (*LLMResponse, error)
-	ProcessAvatarTask(personAvatarPath string, modelName LLMModelName) (*LLMResponse, error)
-	ProcessAvatarTaskWithCharacteristics(personAvatarPath string, characteristics string, modelName LLMModelName) (*LLMResponse, error)
-	GenerateTryOn(personAvatarPath string, filePaths []string, characteristics string, modelName LLMModelName) (*LLMResponse, error)
-	AnalyzePersonCharacteristics(imagePath string, modelName LLMModelName) (*PersonCharacteristics, error)
-	IdentifyClothing(clothingImagePath string, modelName LLMModelName) (*LLMResponse, error)
+	ProcessAvatarTaskWithCharacteristics(ctx context.Context, personAvatarPath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error)
+	GenerateTryOn(ctx context.Context, personAvatarPath string, filePaths []string, options TryOnOptions, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error)
+	AnalyzePersonCharacteristics(ctx context.Context, imagePath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error)
+	IdentifyClothing(ctx context.Context, clothingImagePath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error)
 }
 
 type QuizObject struct {
@@ -210,7 +217,19 @@ type ClothingIdentificationResponse struct {
 	ClothingType string   `json:"clothing_type"`
 }
 
-type GoogleLLMProcessor struct{}
+// GoogleLLMProcessor runs the models on the Gemini API. One processor should live for the whole worker process,
+// it shares a single genai client and caches the uploaded files, see NewGoogleLLMProcessor.
+type GoogleLLMProcessor struct {
+	client     *genai.Client
+	clientOnce sync.Once
+	clientErr  error
+	files      *GeminiFileCache
+}
+
+// NewGoogleLLMProcessor returns a processor with the uploaded file cache, the zero value uploads every file again.
+func NewGoogleLLMProcessor() *GoogleLLMProcessor {
+	return &GoogleLLMProcessor{files: NewGeminiFileCache()}
+}
 
 func Int64Pointer(i int64) *int64 {
 	return &i
@@ -225,6 +244,12 @@ type ResponseWithThoughts struct {
 	Text     string `json:"text"`
 }
 
+// Limits of a single LLM call. The task ctx usually allows more, these keep a hung call from holding the worker.
+const (
+	LLMUploadTimeout   = 1 * time.Minute
+	LLMGenerateTimeout = 3 * time.Minute
+)
+
 func tryUploadGoogleStorage(ctx context.Context, client *genai.Client, filePath string, newName *string) (*genai.File, error) {
 	var genFile *genai.File
 	var err error
@@ -237,15 +262,29 @@ func tryUploadGoogleStorage(ctx context.Context, client *genai.Client, filePath
 			}
 		}
 
-		genFile, err = client.Files.UploadFromPath(ctx, filePath, config)
+		uploadCtx, cancel := context.WithTimeout(ctx, LLMUploadTimeout)
+		genFile, err = client.Files.UploadFromPath(uploadCtx, filePath, config)
+		cancel()
 		if err == nil {
 
 			fmt.Println("File uploaded successfully:", filePath, "Attempt:", i+1)
 			return genFile, nil
 		}
 		fmt.Printf("Error uploading file %s, attempt %d: %v\n", filePath, i+1, err)
+		// the task was cancelled or ran out of time, another attempt can't succeed
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to upload file to google storage %s: %w", filePath, ctx.Err())
+		}
 	}
-	return nil, fmt.Errorf("failed to upload file to google storage /after %d attempts: %s", maxUploadTimes, filePath)
+	return nil, classifyUpstreamError(fmt.Errorf("failed to upload file to google storage after %d attempts: %s: %w", maxUploadTimes, filePath, err))
+}
+
+// generateContent calls the model with LLMGenerateTimeout on top of the deadline of ctx.
+func generateContent(ctx context.Context, client *genai.Client, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, LLMGenerateTimeout)
+	defer cancel()
+	result, err := client.Models.GenerateContent(ctx, model, contents, config)
+	return result, classifyUpstreamError(err)
 }
 
 func GetAllInlineImages(result *genai.GenerateContentResponse) ([][]byte, error) {
@@ -259,7 +298,7 @@ func GetAllInlineImages(result *genai.GenerateContentResponse) ([][]byte, error)
 		// It's good practice to check safety ratings first.
 		for _, rating := range cand.SafetyRatings {
 			if rating.Blocked {
-				return nil, fmt.Errorf("content blocked by safety setting: %s", rating.Category)
+				return nil, fmt.Errorf("%w: blocked by safety setting %s", ErrContentBlocked, rating.Category)
 			}
 		}
 		if cand.Content == nil || len(cand.Content.Parts) == 0 {
@@ -294,14 +333,14 @@ func GetFirstCandidateTextWithThoughts(result *genai.GenerateContentResponse) (*
 		// fmt.Println("Candidate:", i, c.Content.Parts[0].Text, c.Content.Parts[0].Thought)
 		fmt.Println("Finish reason: ", c.FinishReason, " Finish message: ", c.FinishMessage)
 		if c.FinishReason == genai.FinishReasonImageSafety {
-			return nil, fmt.Errorf("content violation: Couldn't analyze the image, because it was flagged by our safety system.")
+			return nil, fmt.Errorf("%w: Couldn't analyze the image, because it was flagged by our safety system.", ErrContentBlocked)
 		}
 		if len(c.SafetyRatings) > 0 {
 			fmt.Println("[Safety] Safety ratings present:", len(c.SafetyRatings))
 			for _, rating := range c.SafetyRatings {
 				fmt.Println("[Safety] rating:", rating.Category, "Score:", rating.Probability, "Severity score:", rating.SeverityScore, " Blocked:", rating.Blocked)
 				if rating.Blocked {
-					return nil, fmt.Errorf("content violation: Couldn't analyze the image, because it contains %s,", rating.Category)
+					return nil, fmt.Errorf("%w: Couldn't analyze the image, because it contains %s,", ErrContentBlocked, rating.Category)
 				}
 			}
 		}
@@ -325,46 +364,37 @@ func GetFirstCandidateTextWithThoughts(result *genai.GenerateContentResponse) (*
 	}, nil
 }
 
-func (GoogleLLMProcessor) ProcessAvatarTask(personAvatarPath string, modelName LLMModelName) (*LLMResponse, error) {
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  os.Getenv("GOOGLE_API_KEY"),
-		Backend: genai.BackendGeminiAPI,
-	})
+func (p *GoogleLLMProcessor) ProcessAvatarTaskWithCharacteristics(ctx context.Context, personAvatarPath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	client, err := p.genaiClient(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	// This file must exist in the same folder as your executable.
-	const whiteCanvasPath = "./white_540x960.png"
 	_, err = os.Open(whiteCanvasPath)
 	if err != nil {
 		return nil, err
 	}
-	// osf.Re
+
 	var genFiles []*genai.File
 
-	// 1. Upload the user's avatar
-	personAvatarFile, err := tryUploadGoogleStorage(ctx, client, personAvatarPath, nil)
+	personAvatarFile, err := p.uploadFile(ctx, client, personAvatarPath)
 	if err != nil {
 		fmt.Println("Error uploading person avatar file:", personAvatarPath, err)
-		return nil, fmt.Errorf("error uploading person avatar file %s: %v", personAvatarPath, err)
+		return nil, fmt.Errorf("error uploading person avatar file %s: %w", personAvatarPath, err)
 	}
 	genFiles = append(genFiles, personAvatarFile)
 	fmt.Println("Successfully uploaded person avatar:", personAvatarPath)
 
-	whiteCanvasFile, err := tryUploadGoogleStorage(ctx, client, whiteCanvasPath, nil)
+	whiteCanvasFile, err := p.uploadFile(ctx, client, whiteCanvasPath)
 	if err != nil {
 		fmt.Println("Error uploading white canvas file:", whiteCanvasPath, err)
-		return nil, fmt.Errorf("error uploading white canvas file %s: %v", whiteCanvasPath, err)
+		return nil, fmt.Errorf("error uploading white canvas file %s: %w", whiteCanvasPath, err)
 	}
 	genFiles = append(genFiles, whiteCanvasFile)
 	fmt.Println("Successfully uploaded white canvas:", whiteCanvasPath)
 
-	// [Image1, Image2, Text]
 	var parts []*genai.Part
 
-	// First, add all the image file parts.
 	for _, genFile := range genFiles {
 		fmt.Println("Adding image part for:", genFile.URI)
 		parts = append(parts, &genai.Part{
@@ -375,31 +405,23 @@ func (GoogleLLMProcessor) ProcessAvatarTask(personAvatarPath string, modelName L
 		})
 	}
 
-	// Second, add the text prompt part at the end.
-	// The prompt correctly refers to the "second image" as the background.
 	parts = append(parts, &genai.Part{
-		//Generate a hyper-realistic fashion-style full-body commercial head to toe portrait of the  person from first image by keeping his identity, personality, facial identity(100% same) and use solid, flat, unlit, white second image as a new background for person image which will be chromakey. keep user facial identity exactly same, unchanged. User should be standing as in fashion e-commerce photo-shoot  pose with neutral white shirt, white trousers and white neutral shoes.. The lighting on user should be natural and professional, high-resolution. Remove items from hands, position neutrally with slight smile. Clean all background elements, watermarks, other people/objects. If no person detected: return "NO_PERSON", otherwise output only full-body person, with on flat, consistent, all white second image background. Do not apply slight grayish gradients, keep all edges white. Aspect ratio 9:16 portrait size
-		//Generate a hyper-realistic fashion-style full-body commercial head to toe photographer edited portrait of the  person from first image by keeping his identity, personality, facial identity(100% same) and use solid, flat, unlit, white second image as a new background for person image which will be chromakey. keep user facial identity exactly same, unchanged. By keeping same personality, identity and exact same body sizes - person should be standing straight facing the camera in RELAXED cool pose with neutral white shirt, white trousers and white neutral shoes. The lighting on user should be natural, soft and professional, high-resolution and opening the color of person. Remove items from hands, position neutrally with slight smile. Clean all background elements, watermarks, other people/objects. If no person detected: return "NO_PERSON", otherwise output only full-body person, with on flat, consistent, all white second image background. Do not apply slight grayish gradients, keep all edges white. Aspect ratio 9:16 portrait size
-		//Generate a fashion-style full-body commercial head to toe photographer edited portrait of the  person from first image by keeping his identity, personality, facial identity(100% same) and use solid, flat, unlit, white second image as a new background for person image which will be chromakey. keep user facial identity exactly same, unchanged. By keeping same personality, identity and exact same body/hand/head/leg sizes - person should be standing straight facing the camera in RELAXED cool pose with neutral white shirt, white trousers and white neutral shoes. The lighting on user should be natural, soft and professional, high-resolution and opening the color of person. Remove items from hands, position neutrally with slight smile. Clean all background elements, watermarks, other people/objects. If no person detected: return "NO_PERSON", otherwise output only full-body person, with on flat, consistent, all white second image background. Do not apply slight grayish gradients, keep all edges white. Aspect ratio 9:16 portrait size
-		//Generate a fashion-style full-body commercial head to toe photographer edited portrait of the  person from first image by keeping his identity, personality, facial identity(100% same) and use solid, flat, unlit, white second image as a new background for person image which will be chromakey. keep user facial identity exactly same, unchanged. By keeping same personality, identity and exact same body/hand/head/leg sizes - person should be standing straight facing the camera in relaxed, coolest, confident pose with neutral white shirt, white trousers and white neutral shoes. The lighting on user should be natural, soft and professional, high-resolution and opening the color of person. Remove items from hands, position neutrally with slight smile. Clean all background elements, watermarks, other people/objects. If no person detected: return "NO_PERSON", otherwise output only full-body person, with on flat, consistent, all white second image background. Do not apply slight grayish gradients, keep all edges white. Aspect ratio 9:16 portrait size
-		// Generate a fashion-style full-body commercial head to toe photographer edited portrait of the  person from first image by keeping his identity, personality, facial identity(100% same) and use solid, flat, unlit, white second image as a new background for person image which will be chromakey. keep user facial identity exactly same, unchanged. By keeping same personality, identity and exact same body/hand/head/leg/hair sizes - generate the straight facing the camera and relaxed, coolest, confident pose with neutral white shirt, white trousers and white neutral shoes. The lighting on user should be natural, soft and professional, high-resolution and opening the color of person. Remove items from hands, position neutrally with slight smile. Clean all background elements, watermarks, other people/objects. If no person detected: return "NO_PERSON", otherwise output only full-body person, with on flat, consistent, all white second image background. Do not apply slight grayish gradients, keep all edges white. Aspect ratio 9:16 portrait size
-		Text: "Generate a fashion-style full-body commercial head to toe photographer edited portrait of the person from first image by keeping his identity, personality, facial identity(100% same) and use solid, flat, unlit, white second image as a new background for person image which will be chromakey. keep user facial identity exactly same, unchanged. Person should be in center and should take 70% of the image area. By keeping same personality, identity and exact same body/hand/head/leg sizes - generate the straight facing the camera and relaxed, coolest, confident pose with neutral white shirt, white trousers and white neutral shoes. The lighting on user should be natural, soft and professional, high-resolution and opening the color of person. Remove items from hands, position neutrally with slight smile. Clean all background elements, watermarks, other people/objects. If no person detected: return \"NO_PERSON\", otherwise output only full-body person, with on flat, consistent, all white second image background. Do not apply slight grayish gradients, keep all edges white. Aspect ratio 9:16 portrait size",
+		Text: prompt.User,
 	})
 
-	// The rest of your function remains the same...
-	result, err := client.Models.GenerateContent(ctx, modelName.String(), []*genai.Content{{Parts: parts}}, &genai.GenerateContentConfig{
+	result, err := generateContent(ctx, client, modelName.String(), []*genai.Content{{Parts: parts}}, &genai.GenerateContentConfig{
 		MaxOutputTokens: 50000,
 		Temperature:     floatPointer(1),
 		SystemInstruction: &genai.Content{
 			Parts: []*genai.Part{
-				{Text: `If no person detected in the image return NO_PERSON as response. Analyze the image, and provide only an full body avatar.`},
+				{Text: prompt.System},
 			},
 		},
 	})
 
 	if err != nil {
 		fmt.Println("Error in GenerateContent:", err)
-		return nil, fmt.Errorf("%v", err)
+		return nil, err
 	}
 
 	inputTokenCount := result.UsageMetadata.PromptTokenCount
@@ -415,7 +437,7 @@ func (GoogleLLMProcessor) ProcessAvatarTask(personAvatarPath string, modelName L
 		fmt.Println(result.PromptFeedback.BlockReason)
 		fmt.Println(result.PromptFeedback.BlockReasonMessage)
 		fmt.Println(result.PromptFeedback.SafetyRatings)
-		return nil, fmt.Errorf("content violation: %s %s ", personAvatarPath, result.PromptFeedback.BlockReasonMessage)
+		return nil, fmt.Errorf("%w: %s %s ", ErrContentBlocked, personAvatarPath, result.PromptFeedback.BlockReasonMessage)
 	}
 
 	fmt.Println("Number of candidates received:", len(result.Candidates))
@@ -423,7 +445,7 @@ func (GoogleLLMProcessor) ProcessAvatarTask(personAvatarPath string, modelName L
 	if err != nil {
 		fmt.Println("Error getting first candidate image: ", err)
 		fmt.Println(result)
-		return nil, fmt.Errorf("error getting first candidate image: %v", err)
+		return nil, fmt.Errorf("error getting first candidate image: %w", err)
 	}
 
 	fmt.Println("Number of images extracted:", len(llmResponseImagesBytes))
@@ -431,10 +453,10 @@ func (GoogleLLMProcessor) ProcessAvatarTask(personAvatarPath string, modelName L
 	if err != nil {
 		fmt.Println("Error getting first candidate text: ", err)
 		fmt.Println(result.Candidates)
-		return nil, fmt.Errorf("%v", err)
+		return nil, err
 	}
 
-	return &LLMResponse{
+	response := &LLMResponse{
 		Response:           llmResponseText.Text,
 		Images:             llmResponseImagesBytes,
 		Thoughts:           llmResponseText.Thoughts,
@@ -443,135 +465,23 @@ func (GoogleLLMProcessor) ProcessAvatarTask(personAvatarPath string, modelName L
 		OutputTokenCount:   outpuTokenCount,
 		TotalTokenCount:    totalTokenCount,
 		IsTest:             false,
-	}, nil
-}
-
-func (GoogleLLMProcessor) ProcessAvatarTaskWithCharacteristics(personAvatarPath string, characteristics string, modelName LLMModelName) (*LLMResponse, error) {
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  os.Getenv("GOOGLE_API_KEY"),
-		Backend: genai.BackendGeminiAPI,
-	})
-	if err != nil {
-		log.Fatal(err)
 	}
+	return response, checkNoPerson(response)
+}
 
-	const whiteCanvasPath = "./white_540x960.png"
-	_, err = os.Open(whiteCanvasPath)
+func (p *GoogleLLMProcessor) GenerateTryOn(ctx context.Context, personAvatarPath string, filePaths []string, options TryOnOptions, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	client, err := p.genaiClient(ctx)
 	if err != nil {
 		return nil, err
 	}
-
-	var genFiles []*genai.File
-
-	personAvatarFile, err := tryUploadGoogleStorage(ctx, client, personAvatarPath, nil)
-	if err != nil {
-		fmt.Println("Error uploading person avatar file:", personAvatarPath, err)
-		return nil, fmt.Errorf("error uploading person avatar file %s: %v", personAvatarPath, err)
-	}
-	genFiles = append(genFiles, personAvatarFile)
-	fmt.Println("Successfully uploaded person avatar:", personAvatarPath)
-
-	whiteCanvasFile, err := tryUploadGoogleStorage(ctx, client, whiteCanvasPath, nil)
-	if err != nil {
-		fmt.Println("Error uploading white canvas file:", whiteCanvasPath, err)
-		return nil, fmt.Errorf("error uploading white canvas file %s: %v", whiteCanvasPath, err)
-	}
-	genFiles = append(genFiles, whiteCanvasFile)
-	fmt.Println("Successfully uploaded white canvas:", whiteCanvasPath)
-
-	var parts []*genai.Part
-
-	for _, genFile := range genFiles {
-		fmt.Println("Adding image part for:", genFile.URI)
-		parts = append(parts, &genai.Part{
-			FileData: &genai.FileData{
-				FileURI:  genFile.URI,
-				MIMEType: genFile.MIMEType,
-			},
-		})
-	}
-
-	// Updated prompt that uses the characteristics description
-	promptText := fmt.Sprintf(`Generate a fashion-style full-body commercial head to toe photographer edited portrait of the person from first image by keeping his identity, personality, facial identity(100%% same) and use solid, flat, unlit, white second image as a new background for person image which will be chromakey. keep user facial identity exactly same, unchanged. Person should be in center and should take 70%% of the image area. %s - generate the straight facing the camera and relaxed, coolest, confident pose with neutral white shirt, white trousers and white neutral shoes. The lighting on user should be natural, soft and professional, high-resolution and opening the color of person. Remove items from hands, position neutrally with slight smile. Clean all background elements, watermarks, other people/objects. If no person detected: return "NO_PERSON", otherwise output only full-body person, with on flat, consistent, all white second image background. Do not apply slight grayish gradients, keep all edges white. Aspect ratio 9:16 portrait size`, characteristics)
-
-	parts = append(parts, &genai.Part{
-		Text: promptText,
-	})
-
-	result, err := client.Models.GenerateContent(ctx, modelName.String(), []*genai.Content{{Parts: parts}}, &genai.GenerateContentConfig{
-		MaxOutputTokens: 50000,
-		Temperature:     floatPointer(1),
-		SystemInstruction: &genai.Content{
-			Parts: []*genai.Part{
-				{Text: `If no person detected in the image return NO_PERSON as response. Analyze the image, and provide only a full body avatar with the specified characteristics.`},
-			},
-		},
-	})
-
-	if err != nil {
-		fmt.Println("Error in GenerateContent:", err)
-		return nil, fmt.Errorf("%v", err)
-	}
-
-	inputTokenCount := result.UsageMetadata.PromptTokenCount
-	thoughtsTokenCount := result.UsageMetadata.ThoughtsTokenCount
-	outpuTokenCount := result.UsageMetadata.CandidatesTokenCount
-	totalTokenCount := result.UsageMetadata.TotalTokenCount
-	fmt.Println("Input token count:", inputTokenCount)
-	fmt.Println("Output token count:", outpuTokenCount)
-	fmt.Println("Thoughts token count:", thoughtsTokenCount)
-	fmt.Println("Total token count:", totalTokenCount)
-
-	if result.PromptFeedback != nil {
-		fmt.Println(result.PromptFeedback.BlockReason)
-		fmt.Println(result.PromptFeedback.BlockReasonMessage)
-		fmt.Println(result.PromptFeedback.SafetyRatings)
-		return nil, fmt.Errorf("content violation: %s %s ", personAvatarPath, result.PromptFeedback.BlockReasonMessage)
-	}
-
-	fmt.Println("Number of candidates received:", len(result.Candidates))
-	llmResponseImagesBytes, err := GetAllInlineImages(result)
-	if err != nil {
-		fmt.Println("Error getting first candidate image: ", err)
-		fmt.Println(result)
-		return nil, fmt.Errorf("error getting first candidate image: %v", err)
-	}
-
-	fmt.Println("Number of images extracted:", len(llmResponseImagesBytes))
-	llmResponseText, err := GetFirstCandidateTextWithThoughts(result)
-	if err != nil {
-		fmt.Println("Error getting first candidate text: ", err)
-		fmt.Println(result.Candidates)
-		return nil, fmt.Errorf("%v", err)
-	}
-
-	return &LLMResponse{
-		Response:           llmResponseText.Text,
-		Images:             llmResponseImagesBytes,
-		Thoughts:           llmResponseText.Thoughts,
-		InputTokenCount:    inputTokenCount,
-		ThoughtsTokenCount: thoughtsTokenCount,
-		OutputTokenCount:   outpuTokenCount,
-		TotalTokenCount:    totalTokenCount,
-		IsTest:             false,
-	}, nil
-}
-
-func (GoogleLLMProcessor) GenerateTryOn(personAvatarPath string, filePaths []string, characteristics string, modelName LLMModelName) (*LLMResponse, error) {
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  os.Getenv("GOOGLE_API_KEY"),
-		Backend: genai.BackendGeminiAPI,
-	})
 	// filter null and keep only existing images in filePaths,rewrite
 
 	var genFiles []*genai.File
 
-	genFile, err := tryUploadGoogleStorage(ctx, client, personAvatarPath, nil)
+	genFile, err := p.uploadFile(ctx, client, personAvatarPath)
 	if err != nil {
 		fmt.Println("Error uploading person avatar file:", personAvatarPath, err)
-		return nil, fmt.Errorf("error uploading file %s: %v", personAvatarPath, err)
+		return nil, fmt.Errorf("error uploading file %s: %w", personAvatarPath, err)
 	}
 	genFiles = append(genFiles, genFile)
 	// Upload each file and get the URI
@@ -581,10 +491,23 @@ func (GoogleLLMProcessor) GenerateTryOn(personAvatarPath string, filePaths []str
 			continue
 		}
 		// try to upload couple of times if err, default 3
-		genFile, err := tryUploadGoogleStorage(ctx, client, filePath, nil)
+		genFile, err := p.uploadFile(ctx, client, filePath)
 		if err != nil {
 			fmt.Println("Error uploading file:", filePath, err)
-			return nil, fmt.Errorf("error uploading file %s: %v", filePath, err)
+			return nil, fmt.Errorf("error uploading file %s: %w", filePath, err)
+		}
+		genFiles = append(genFiles, genFile)
+	}
+	options, err = options.WithDefaults()
+	if err != nil {
+		return nil, err
+	}
+	if options.Scene == SceneCustom {
+		// background goes last, the prompt refers to it as the last image
+		genFile, err := p.uploadFile(ctx, client, options.BackgroundImagePath)
+		if err != nil {
+			fmt.Println("Error uploading background file:", options.BackgroundImagePath, err)
+			return nil, fmt.Errorf("error uploading file %s: %w", options.BackgroundImagePath, err)
 		}
 		genFiles = append(genFiles, genFile)
 	}
@@ -609,7 +532,7 @@ func (GoogleLLMProcessor) GenerateTryOn(personAvatarPath string, filePaths []str
 	//Return: Note},
 	// result, err := client.Models.GenerateContent(ctx, "gemini-2.5-pro-preview-03-25", []*genai.Content{{Parts: parts}}, nil)
 
-	result, err := client.Models.GenerateContent(ctx, modelName.String(), []*genai.Content{{Parts: parts}}, &genai.GenerateContentConfig{
+	result, err := generateContent(ctx, client, modelName.String(), []*genai.Content{{Parts: parts}}, &genai.GenerateContentConfig{
 		// ResponseMIMEType: "application/json",
 		CandidateCount: 1,
 		// ThinkingConfig: &genai.ThinkingConfig{
@@ -622,7 +545,7 @@ func (GoogleLLMProcessor) GenerateTryOn(personAvatarPath string, filePaths []str
 		// TopK:            floatPointer(0.5),
 		SystemInstruction: &genai.Content{
 			Parts: []*genai.Part{
-				{Text: fmt.Sprintf(`Edit first person image into a fashion-style full-body commercial head to toe photographer edited by keeping his identity, personality, placement in image in center, facial identity(100%% same) and use the same solid, flat, unlit, white first image background including ratio. Take the all images after first one and let the same exact person from the first image wear it. For missing clothing items, keep original ones that user wears. keep user facial identity exactly same, unchanged. Give attention to person body characteristics when wearing. %s - generate the straight facing the camera and relaxed, coolest, confident pose with neutral white shirt, white trousers and white neutral shoes. The lighting on user should be natural, soft and professional, high-resolution and opening the color of person. Remove items from hands, position neutrally with slight smile. Clean all background elements, watermarks, other people/objects. Output only full-body person, with on flat, consistent, all white(#FFFFFF, rgb(255,255,255)) second image background. Do not apply slight grayish gradients, keep all edges white. Aspect ratio 9:16 portrait size`, characteristics)},
+				{Text: prompt.System},
 			},
 		},
 	})
@@ -630,7 +553,7 @@ func (GoogleLLMProcessor) GenerateTryOn(personAvatarPath string, filePaths []str
 
 	if err != nil {
 		fmt.Println("Error in GenerateContent:", err)
-		return nil, fmt.Errorf("%v", err)
+		return nil, err
 	}
 	inputTokenCount := result.UsageMetadata.PromptTokenCount
 	thoughtsTokenCount := result.UsageMetadata.ThoughtsTokenCount
@@ -645,7 +568,7 @@ func (GoogleLLMProcessor) GenerateTryOn(personAvatarPath string, filePaths []str
 		fmt.Println(result.PromptFeedback.BlockReason)
 		fmt.Println(result.PromptFeedback.BlockReasonMessage)
 		fmt.Println(result.PromptFeedback.SafetyRatings)
-		return nil, fmt.Errorf("content violation: %s %s ", filePaths[0], result.PromptFeedback.BlockReasonMessage)
+		return nil, fmt.Errorf("%w: %s %s ", ErrContentBlocked, filePaths[0], result.PromptFeedback.BlockReasonMessage)
 	}
 	fmt.Println("Number of candidates received:", len(result.Candidates))
 	llmResponseImagesBytes, err := GetAllInlineImages(result)
@@ -654,7 +577,7 @@ func (GoogleLLMProcessor) GenerateTryOn(personAvatarPath string, filePaths []str
 
 		fmt.Println(result)
 
-		return nil, fmt.Errorf("error getting first candidate text: %v", err)
+		return nil, fmt.Errorf("error getting first candidate text: %w", err)
 	}
 	fmt.Println("Number of images extracted:", len(llmResponseImagesBytes))
 	llmResponseText, err := GetFirstCandidateTextWithThoughts(result)
@@ -662,10 +585,10 @@ func (GoogleLLMProcessor) GenerateTryOn(personAvatarPath string, filePaths []str
 		fmt.Println("Error getting first candidate text: ", err)
 
 		fmt.Println(result.Candidates)
-		return nil, fmt.Errorf("%v", err)
+		return nil, err
 	}
 	// fmt.Pri
-	return &LLMResponse{
+	response := &LLMResponse{
 		Response:           llmResponseText.Text,
 		Images:             llmResponseImagesBytes,
 		Thoughts:           llmResponseText.Thoughts,
@@ -674,25 +597,22 @@ func (GoogleLLMProcessor) GenerateTryOn(personAvatarPath string, filePaths []str
 		OutputTokenCount:   outpuTokenCount,
 		TotalTokenCount:    totalTokenCount,
 		IsTest:             false,
-	}, nil
+	}
+	return response, checkNoPerson(response)
 
 }
 
 var dashAlphaRule = regexp.MustCompile(`[^a-zA-Z0-9-]`)
 
-func (GoogleLLMProcessor) AnalyzePersonCharacteristics(imagePath string, modelName LLMModelName) (*PersonCharacteristics, error) {
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  os.Getenv("GOOGLE_API_KEY"),
-		Backend: genai.BackendGeminiAPI,
-	})
+func (p *GoogleLLMProcessor) AnalyzePersonCharacteristics(ctx context.Context, imagePath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	client, err := p.genaiClient(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	genFile, err := tryUploadGoogleStorage(ctx, client, imagePath, nil)
+	genFile, err := p.uploadFile(ctx, client, imagePath)
 	if err != nil {
-		return nil, fmt.Errorf("error uploading image for analysis %s: %v", imagePath, err)
+		return nil, fmt.Errorf("error uploading image for analysis %s: %w", imagePath, err)
 	}
 
 	parts := []*genai.Part{
@@ -703,77 +623,28 @@ func (GoogleLLMProcessor) AnalyzePersonCharacteristics(imagePath string, modelNa
 			},
 		},
 		{
-			Text: `Analyze the person in the provided image and determine their body characteristics.
-
-Instructions:
-- Choose exactly one option from each category
-- If a feature is between options, choose the more distinctive edge option
-- Be realistic with weight, height, and waist measurements
-
-Categories:
-1. Body Type: slender (skinny/lean), athletic (average/mesomorphic), robust (large/endomorphic)
-2. Shoulder Type: narrow (sloped/narrow), proportionate (average), broad (wide/muscular)  
-3. Body-to-Leg Ratio: long_legs (tall appearance), balanced (average), long_torso (grounded appearance)
-4. Hand Type: slender (slim/small), proportioned (average), large (broad/big)
-5. Upper Limb Type: slender (thin/wiry), toned (athletic/moderate), muscular (large/heavily muscled)
-6. Weight: realistic weight in kg based on body structure
-7. Height: realistic height in meters (e.g., "1.72")  
-8. Waist Size: realistic waist circumference in cm`,
+			Text: prompt.User,
 		},
 	}
 
-	result, err := client.Models.GenerateContent(ctx, modelName.String(), []*genai.Content{{Parts: parts}}, &genai.GenerateContentConfig{
+	result, err := generateContent(ctx, client, modelName.String(), []*genai.Content{{Parts: parts}}, &genai.GenerateContentConfig{
 		ResponseMIMEType: "application/json",
 		MaxOutputTokens:  4000,
 		Temperature:      floatPointer(0.2),
 		SystemInstruction: &genai.Content{
 			Parts: []*genai.Part{
-				{Text: `You are an expert body analysis AI. Analyze the person carefully and return compact enum values with realistic measurements.`},
-			},
-		},
-		ResponseSchema: &genai.Schema{
-			Type: "object",
-			Properties: map[string]*genai.Schema{
-				"body_type": {
-					Type: "string",
-					Enum: []string{"slender", "athletic", "robust"},
-				},
-				"shoulder_type": {
-					Type: "string",
-					Enum: []string{"narrow", "proportionate", "broad"},
-				},
-				"body_to_leg_ratio": {
-					Type: "string",
-					Enum: []string{"long_legs", "balanced", "long_torso"},
-				},
-				"hand_type": {
-					Type: "string",
-					Enum: []string{"slender", "proportioned", "large"},
-				},
-				"upper_limb_type": {
-					Type: "string",
-					Enum: []string{"slender", "toned", "muscular"},
-				},
-				"weight": {
-					Type: "integer",
-				},
-				"height": {
-					Type: "string",
-				},
-				"waist_size": {
-					Type: "integer",
-				},
+				{Text: prompt.System},
 			},
-			Required: []string{"body_type", "shoulder_type", "body_to_leg_ratio", "hand_type", "upper_limb_type", "weight", "height", "waist_size"},
 		},
+		ResponseSchema: personCharacteristicsSchema(),
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("error analyzing person characteristics: %v", err)
+		return nil, fmt.Errorf("error analyzing person characteristics: %w", err)
 	}
 
 	if result.PromptFeedback != nil {
-		return nil, fmt.Errorf("content violation during person analysis: %s", result.PromptFeedback.BlockReasonMessage)
+		return nil, fmt.Errorf("%w during person analysis: %s", ErrContentBlocked, result.PromptFeedback.BlockReasonMessage)
 	}
 
 	responseText := result.Text()
@@ -781,27 +652,32 @@ Categories:
 		return nil, fmt.Errorf("empty response from person characteristics analysis")
 	}
 
-	var characteristics PersonCharacteristics
-	if err := json.Unmarshal([]byte(responseText), &characteristics); err != nil {
-		return nil, fmt.Errorf("error parsing person characteristics JSON: %v", err)
+	characteristics, err := DecodePersonCharacteristics(responseText)
+	if err != nil {
+		return nil, err
 	}
-
-	return &characteristics, nil
+	response := &LLMResponse{
+		Response:        responseText,
+		Characteristics: characteristics,
+	}
+	if result.UsageMetadata != nil {
+		response.InputTokenCount = result.UsageMetadata.PromptTokenCount
+		response.ThoughtsTokenCount = result.UsageMetadata.ThoughtsTokenCount
+		response.OutputTokenCount = result.UsageMetadata.CandidatesTokenCount
+		response.TotalTokenCount = result.UsageMetadata.TotalTokenCount
+	}
+	return response, nil
 }
 
-func (GoogleLLMProcessor) IdentifyClothing(clothingImagePath string, modelName LLMModelName) (*LLMResponse, error) {
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  os.Getenv("GOOGLE_API_KEY"),
-		Backend: genai.BackendGeminiAPI,
-	})
+func (p *GoogleLLMProcessor) IdentifyClothing(ctx context.Context, clothingImagePath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	client, err := p.genaiClient(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	genFile, err := tryUploadGoogleStorage(ctx, client, clothingImagePath, nil)
+	genFile, err := p.uploadFile(ctx, client, clothingImagePath)
 	if err != nil {
-		return nil, fmt.Errorf("error uploading clothing image for identification %s: %v", clothingImagePath, err)
+		return nil, fmt.Errorf("error uploading clothing image for identification %s: %w", clothingImagePath, err)
 	}
 
 	parts := []*genai.Part{
@@ -812,86 +688,28 @@ func (GoogleLLMProcessor) IdentifyClothing(clothingImagePath string, modelName L
 			},
 		},
 		{
-			Text: `As a fashion clothing, accessory expert, Analyze the clothing item in the provided image and identify its attributes.
-
-Instructions:
-- Examine the clothing item carefully and provide detailed information
-- For optional fields, provide null if the information cannot be determined
-- Be realistic with price estimation based on visible brand, quality, and style
-- Use descriptive but concise terms
-
-Fields to identify:
-1. name: A descriptive name for the clothing item (e.g., "Blue Denim Jacket", "White Cotton T-Shirt")
-2. description: A brief description of the item's features, fit, or notable characteristics
-3. brand: Carefully Identify the brand otherwise null
-4. size: The size if visible on labels, otherwise null
-5. price_usd: Estimated price in USD based on visible quality and style
-6. condition: Condition assessment (new, like new, good, fair, poor)
-7. material: Primary material (cotton, polyester, denim, wool, etc.)
-8. color: Primary color or color combination
-9. style: Style category (casual, formal, sporty, vintage, bohemian, chic, business, streetwear)
-10. clothing_type: Clothing category (top, bottom, shoes, accessory)
-
-Provide realistic and accurate assessments based on what is visible in the image.`,
+			Text: prompt.User,
 		},
 	}
 
-	result, err := client.Models.GenerateContent(ctx, modelName.String(), []*genai.Content{{Parts: parts}}, &genai.GenerateContentConfig{
+	result, err := generateContent(ctx, client, modelName.String(), []*genai.Content{{Parts: parts}}, &genai.GenerateContentConfig{
 		ResponseMIMEType: "application/json",
 		MaxOutputTokens:  4000,
 		Temperature:      floatPointer(0.3),
 		SystemInstruction: &genai.Content{
 			Parts: []*genai.Part{
-				{Text: `You are an expert fashion and clothing analysis AI. Analyze the clothing item in the image and return structured identification data in JSON format. Be accurate and realistic in your assessments.`},
+				{Text: prompt.System},
 			},
 		},
-		ResponseSchema: &genai.Schema{
-			Type: "object",
-			Properties: map[string]*genai.Schema{
-				"name": {
-					Type: "string",
-				},
-				"description": {
-					Type: "string",
-				},
-				"brand": {
-					Type: "string",
-				},
-				"size": {
-					Type: "string",
-				},
-				"price_usd": {
-					Type: "number",
-				},
-				"condition": {
-					Type: "string",
-					Enum: []string{"new", "like new", "good", "fair", "poor"},
-				},
-				"material": {
-					Type: "string",
-				},
-				"color": {
-					Type: "string",
-				},
-				"style": {
-					Type: "string",
-					Enum: []string{"casual", "formal", "sporty", "vintage", "bohemian", "chic", "business", "streetwear"},
-				},
-				"clothing_type": {
-					Type: "string",
-					Enum: []string{"top", "bottom", "shoes", "accessory"},
-				},
-			},
-			Required: []string{"name", "condition", "material", "color", "style", "clothing_type"},
-		},
+		ResponseSchema: clothingIdentificationSchema(),
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("error identifying clothing: %v", err)
+		return nil, fmt.Errorf("error identifying clothing: %w", err)
 	}
 
 	if result.PromptFeedback != nil {
-		return nil, fmt.Errorf("content violation during clothing identification: %s", result.PromptFeedback.BlockReasonMessage)
+		return nil, fmt.Errorf("%w during clothing identification: %s", ErrContentBlocked, result.PromptFeedback.BlockReasonMessage)
 	}
 
 	inputTokenCount := result.UsageMetadata.PromptTokenCount
@@ -901,11 +719,16 @@ Provide realistic and accurate assessments based on what is visible in the image
 
 	llmResponseText, err := GetFirstCandidateTextWithThoughts(result)
 	if err != nil {
-		return nil, fmt.Errorf("error getting clothing identification response: %v", err)
+		return nil, fmt.Errorf("error getting clothing identification response: %w", err)
+	}
+	identification, err := DecodeClothingIdentification(llmResponseText.Text)
+	if err != nil {
+		return nil, err
 	}
 
 	return &LLMResponse{
 		Response:           llmResponseText.Text,
+		Identification:     identification,
 		Thoughts:           llmResponseText.Thoughts,
 		InputTokenCount:    inputTokenCount,
 		ThoughtsTokenCount: thoughtsTokenCount,
@@ -914,160 +737,3 @@ Provide realistic and accurate assessments based on what is visible in the image
 		IsTest:             false,
 	}, nil
 }
-
-func (GoogleLLMProcessor) ProcessClothing(filePath string, modelName LLMModelName) (*LLMResponse, error) {
-	return nil, nil
-	// 	ctx := context.Background()
-	// 	// fileName
-	// 	fmt.Println("File path for image parse:", filePaths)
-	// 	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-	// 		//GOOGLE_API_KEY env
-	// 		APIKey:  os.Getenv("GOOGLE_API_KEY"),
-	// 		Backend: genai.BackendGeminiAPI,
-	// 	})
-	// 	var genFiles []*genai.File
-	// 	// Upload each file and get the URI
-	// 	for _, filePath := range filePaths {
-	// 		// fmt.Println("File path for image parse:", filePath)
-	// 		fileName := filepath.Base(filePath)
-	// 		sanitizedFileName := dashAlphaRule.ReplaceAllString(strings.ReplaceAll(fileName, ".", "-"), "")
-	// 		genFile, err := tryUploadGoogleStorage(ctx, client, filePath, &sanitizedFileName)
-	// 		if err != nil {
-	// 			fmt.Println("Error uploading file:", filePath, err)
-	// 			return nil, fmt.Errorf("error uploading file to google storage %s: %v", filePath, err)
-	// 		}
-	// 		genFiles = append(genFiles, genFile)
-	// 	}
-
-	// 	var parts []*genai.Part
-	// 	// generate pars from for each file then merge it with text
-	// 	for i, genFile := range genFiles {
-	// 		fmt.Println("File path for image parse:", i, " ", genFile.URI, genFile.MIMEType)
-	// 		parts = append(parts, &genai.Part{
-	// 			FileData: &genai.FileData{
-	// 				FileURI:  genFile.URI,
-	// 				MIMEType: genFile.MIMEType,
-	// 			},
-	// 		})
-	// 	}
-	// 	// donot use html elements such as sub sup
-	// 	// Analyze the image text and pay special attention to precision. We need to return:
-	// 	// 1. Proper complete image text with original transcript language (with accompanying illustration explanation in braces if exists). Ensure transcript precision and technical context is consistent and correct and also format it to have correct commas, quotes, parentheses and generally proper readable text, return only transcription, no timestamps. Additionally, For each highly unclear word provide placeholder of possible options and their possibility threshold in form of this example: "  [gone:0.7][done:0.5] " meaning that we are not sure about this word/phrase.
-	// 	// 2. Concise subject name on original text content language only.
-	// 	// 3. Markdown Format Summary in original content language: Start with brief introduction then specify key points, events, facts. You can generate a table for similar key facts.
-	// 	// If image is empty or not understandable, please return only "Unknown note" for the name and keep other fields empty.
-	// 	// 4. Quiz Object: Generate quiz with 10 questions and answers based on the image content and the language of the content. The quiz should be in JSON format. Each question should have a question, answer, and options. The 'options' should be in an array of strings containing four options. The 'answer' should be the correct answer from the options array.
-	// 	// Return the result in JSON format.
-	// 	if len(userTranscript) > 0 {
-	// 		parts = append(parts, &genai.Part{
-	// 			Text: userTranscript,
-	// 		})
-	// 	}
-	// 	if err != nil {
-	// 		log.Fatal(err)
-	// 	}
-	// 	//Please use ONLY the following JSON schema for the response:
-	// 	//Note = {'name': string, 'md_summary': string, 'transcription': string, 'quiz_json': Array<{'question': string, 'answer': string, 'options': Array<string>}>}
-	// 	//Return: Note},
-	// 	// result, err := client.Models.GenerateContent(ctx, "gemini-2.5-pro-preview-03-25", []*genai.Content{{Parts: parts}}, nil)
-
-	// 	languagePrompt := `Detect the language of content and stick to it. Do not assume the language based on the first word or phrase, especially if it appears unusual or out of context. Analyze the first six to seven sentences of each file to accurately detect the primary language of the text.`
-
-	// 	if languageCode != "auto" {
-	// 		languagePrompt = `Transctipion language should be in "` + languageCode + ` code". (ISO 639-1 code). The main transcription text language should be "` + languageCode + `".`
-	// 	}
-	// 	languagePrefix := `identified primary language`
-	// 	if languageCode != "auto" {
-	// 		languagePrefix = `"` + languageCode + ` code language"`
-	// 	}
-	// 	result, err := client.Models.GenerateContent(ctx, modelName.String(), []*genai.Content{{Parts: parts}}, &genai.GenerateContentConfig{
-	// 		ResponseMIMEType: "application/json",
-	// 		CandidateCount:   1,
-	// 		MaxOutputTokens:  50000,
-	// 		Temperature:      floatPointer(0.8),
-	// 		SystemInstruction: &genai.Content{
-	// 			Parts: []*genai.Part{
-	// 				{Text: `You are expert at transcribing and analyzing images, PDFs, audio files, and text content with the proper grammar. ` + languagePrompt + ` Follow the below instructions. Do not deviate from these requirements.  Return the response in JSON format with the specified fields.
-
-	// 1. For audio content, transcribe it exactly in the ` + languagePrefix + `, ensuring absolute precision in nouns. Do not include timestamps. Use complete sentences with correct grammar and punctuation. For multiple audio files, transcribe these files preserving the chronological order as much as possible only based on the timestamp in their filenames or part numbers.
-	// 2. For images and PDFs, transcribe the text while preserving the readable layout and pages order as closely as possible. In case of provided exam/test questions - do not solve them no matter what, only transcribe them. For any illustrations, include a brief description in the  ` + languagePrefix + ` within the transcription.
-	// 3. Return the following JSON fields and make sure "\n" is escaped properly on every fields value as "\\n":
-	//    - **transcription**: A complete, accurate transcription of all material text in Markdown language, using correct grammar, punctuation, and formatting in the ` + languagePrefix + `. Add commas and quotes where needed for clarity. Focus on grammatical correctness and use sentence breaks to represent natural pauses. Use complete sentences and a readable layout with paragraphs and line breaks. Do not alter sentence structure. Use only plain symbols and Markdown for formulas or similar content. Do not use LaTeX, HTML, or illustrate graphics with symbol art or Markdown.
-	//    - **name**: A concise subject name in the ` + languagePrefix + ` only.
-	//    - **md_summary**: A summary in the ` + languagePrefix + ` using Markdown. Begin with a brief introduction, followed by key points, events, and facts. Include a table for related key facts. Use only these Markdown directives if needed: bold, table elements, heading1, heading2, heading3, line breaks, new lines, emphasis, italic, blockquotes, lists (non-nested), code blocks, inline code. Do not use LaTeX, HTML, or nested lists.
-	//    - **language**: The i ` + languagePrefix + ` in ISO 639-1 format (2-letter code, e.g., "en" for English).
-
-	// Ensure all instructions are followed precisely, with no omissions or alterations. The response must be in JSON format, and all fields must be populated correctly based on the provided material.`},
-	// 			},
-	// 		},
-	// 		ResponseSchema: &genai.Schema{
-	// 			Type: "object",
-	// 			// The schema for the AI response.
-	// 			Properties: map[string]*genai.Schema{
-	// 				"name": {
-	// 					Type: "string",
-	// 				},
-	// 				"md_summary": {
-	// 					Type: "string",
-	// 				},
-	// 				"transcription": {
-	// 					Type: "string",
-	// 				},
-	// 				"language": {
-	// 					Type: "string",
-	// 				},
-	// 			},
-	// 			Required: []string{"name", "md_summary", "transcription", "language"},
-	// 		},
-	// 		ThinkingConfig: &genai.ThinkingConfig{
-	// 			IncludeThoughts: true,
-	// 			// ThinkingBudget:  Int32Pointer()
-	// 		},
-	// 	})
-
-	// 	// client.Models.Cou
-
-	// 	if err != nil {
-	// 		fmt.Println("Error in GenerateContent:", err)
-	// 		return nil, fmt.Errorf("%v", err)
-	// 	}
-	// 	var inputTokenCount int32
-	// 	var thoughtsTokenCount int32
-	// 	var outputTokenCount int32
-	// 	var totalTokenCount int32
-	// 	if result.UsageMetadata != nil {
-	// 		inputTokenCount = result.UsageMetadata.PromptTokenCount
-	// 		thoughtsTokenCount = result.UsageMetadata.ThoughtsTokenCount
-	// 		outputTokenCount = result.UsageMetadata.CandidatesTokenCount
-	// 		totalTokenCount = result.UsageMetadata.TotalTokenCount
-	// 		fmt.Println("Input token count:", inputTokenCount)
-	// 		fmt.Println("Output token count:", outputTokenCount)
-	// 		fmt.Println("Thoughts token count:", thoughtsTokenCount)
-	// 		fmt.Println("Total token count:", totalTokenCount)
-	// 	} else {
-	// 		fmt.Println("UsageMetadata is nil!")
-	// 	}
-	// 	llmResponseText, err := GetFirstCandidateTextWithThoughts(result)
-	// 	if err != nil {
-	// 		fmt.Println("Error getting first candidate text: ", err)
-	// 		fmt.Println(result.Candidates)
-	// 		if result.PromptFeedback != nil {
-
-	// 			fmt.Println(result.PromptFeedback.BlockReason)
-	// 			fmt.Println(result.PromptFeedback.BlockReasonMessage)
-	// 			fmt.Println(result.PromptFeedback.SafetyRatings)
-	// 			return nil, fmt.Errorf("content violation: %s ", result.PromptFeedback.BlockReasonMessage)
-	// 		}
-	// 		return nil, fmt.Errorf("error getting first candidate text: %v", err)
-	// 	}
-	// 	return &LLMResponse{
-	// 		Response:           llmResponseText.Text,
-	// 		Thoughts:           llmResponseText.Thoughts,
-	// 		InputTokenCount:    inputTokenCount,
-	// 		ThoughtsTokenCount: thoughtsTokenCount,
-	// 		OutputTokenCount:   outputTokenCount,
-	// 		TotalTokenCount:    totalTokenCount,
-	// 		IsTest:             false,
-	// 	}, nil
-
-}
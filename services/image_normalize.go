@@ -0,0 +1,146 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+	_ "golang.org/x/image/webp" // registers the webp decoder for image.Decode
+)
+
+// MaxLLMImageEdge caps the longest edge of images sent to the LLM, phone photos are usually 4000px and more
+const MaxLLMImageEdge = 2048
+
+// normalizedJPEGQuality is used when re-encoding photos without transparency
+const normalizedJPEGQuality = 90
+
+// UnsupportedImageFormatError is returned for uploads that can't be decoded, e.g. HEIC photos when no converter is installed.
+type UnsupportedImageFormatError struct {
+	Format string
+}
+
+func (e *UnsupportedImageFormatError) Error() string {
+	return fmt.Sprintf("unsupported image format: %s", e.Format)
+}
+
+// Is makes the error match ErrAssetMissing, the upload can't be used
+func (e *UnsupportedImageFormatError) Is(target error) bool {
+	return target == ErrAssetMissing
+}
+
+// heicBrands are the ISO BMFF major brands of HEIC/HEIF files
+var heicBrands = []string{"heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1"}
+
+func isHEIC(imageBytes []byte) bool {
+	// ....ftypheic
+	if len(imageBytes) < 12 || string(imageBytes[4:8]) != "ftyp" {
+		return false
+	}
+	brand := string(imageBytes[8:12])
+	for _, heicBrand := range heicBrands {
+		if brand == heicBrand {
+			return true
+		}
+	}
+	return false
+}
+
+// heicConvertTimeout bounds a single HEIC conversion, a 12MP photo takes about a second
+const heicConvertTimeout = 30 * time.Second
+
+// convertHEIC converts a HEIC photo to jpeg with the command of HEIC_CONVERTER, heif-convert of libheif by default.
+// The command is called as `<converter> -q <quality> <input> <output>`, it applies the HEIC rotation itself.
+func convertHEIC(imageBytes []byte) ([]byte, error) {
+	converter := GetEnv("HEIC_CONVERTER", "heif-convert")
+	dir, err := os.MkdirTemp("", "heic-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create heic temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "input.heic")
+	output := filepath.Join(dir, "output.jpg")
+	if err := os.WriteFile(input, imageBytes, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write heic temp file: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), heicConvertTimeout)
+	defer cancel()
+	combinedOutput, err := exec.CommandContext(ctx, converter, "-q", fmt.Sprint(normalizedJPEGQuality), input, output).CombinedOutput()
+	if err != nil {
+		fmt.Printf("[HEIC] %s failed: %v: %s\n", converter, err, combinedOutput)
+		return nil, &UnsupportedImageFormatError{Format: "heic"}
+	}
+	converted, err := os.ReadFile(output)
+	if err != nil {
+		fmt.Printf("[HEIC] %s wrote no output: %v\n", converter, err)
+		return nil, &UnsupportedImageFormatError{Format: "heic"}
+	}
+	return converted, nil
+}
+
+// NormalizeImageForLLM prepares an uploaded photo before it is sent to the LLM:
+// - applies the EXIF orientation
+// - decodes jpeg, png and webp, HEIC is converted to jpeg first, see convertHEIC
+// - re-encodes the pixels only, so EXIF, GPS and other metadata are dropped
+// - downscales the longest edge to MaxLLMImageEdge
+//
+// Images with transparency are stored as png, everything else as jpeg.
+// The returned file name has the extension of the new format.
+func NormalizeImageForLLM(imageBytes []byte, fileName string) ([]byte, string, error) {
+	if isHEIC(imageBytes) {
+		converted, err := convertHEIC(imageBytes)
+		if err != nil {
+			return nil, "", err
+		}
+		imageBytes = converted
+	}
+	img, err := imaging.Decode(bytes.NewReader(imageBytes), imaging.AutoOrientation(true))
+	if err != nil {
+		if err == image.ErrFormat {
+			return nil, "", &UnsupportedImageFormatError{Format: strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")}
+		}
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	bounds := img.Bounds()
+	if max(bounds.Dx(), bounds.Dy()) > MaxLLMImageEdge {
+		img = imaging.Fit(img, MaxLLMImageEdge, MaxLLMImageEdge, imaging.Lanczos)
+	}
+
+	baseName := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	var buf bytes.Buffer
+	if isOpaque(img) {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: normalizedJPEGQuality}); err != nil {
+			return nil, "", fmt.Errorf("failed to encode image: %w", err)
+		}
+		return buf.Bytes(), baseName + ".jpg", nil
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, "", fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), baseName + ".png", nil
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withEXIFOrientation inserts an APP1 segment with the orientation tag and a GPS marker right after SOI.
+func withEXIFOrientation(t *testing.T, jpegBytes []byte, orientation uint16) []byte {
+	t.Helper()
+	var tiff bytes.Buffer
+	tiff.WriteString("MM\x00\x2a")
+	binary.Write(&tiff, binary.BigEndian, uint32(8)) // offset of the first IFD
+	binary.Write(&tiff, binary.BigEndian, uint16(1)) // one entry
+	binary.Write(&tiff, binary.BigEndian, uint16(0x0112))
+	binary.Write(&tiff, binary.BigEndian, uint16(3)) // SHORT
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, orientation)
+	binary.Write(&tiff, binary.BigEndian, uint16(0))
+	binary.Write(&tiff, binary.BigEndian, uint32(0)) // no next IFD
+	tiff.WriteString("GPS-48.8584,2.2945")
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	var out bytes.Buffer
+	out.Write(jpegBytes[:2])
+	out.Write([]byte{0xff, 0xe1})
+	binary.Write(&out, binary.BigEndian, uint16(len(payload)+2))
+	out.Write(payload)
+	out.Write(jpegBytes[2:])
+	return out.Bytes()
+}
+
+func encodeTestImage(t *testing.T, img image.Image, format string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var err error
+	if format == "png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestNormalizeImageForLLM(t *testing.T) {
+	t.Run("exif orientation and metadata", func(t *testing.T) {
+		photo := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+		for y := 0; y < 20; y++ {
+			for x := 0; x < 40; x++ {
+				photo.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 6), G: 120, B: 80, A: 255})
+			}
+		}
+		input := withEXIFOrientation(t, encodeTestImage(t, photo, "jpeg"), 6)
+
+		output, fileName, err := NormalizeImageForLLM(input, "photo.JPG")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fileName != "photo.jpg" {
+			t.Fatalf("expected photo.jpg, got %s", fileName)
+		}
+		if bytes.Contains(output, []byte("Exif")) || bytes.Contains(output, []byte("GPS")) {
+			t.Fatalf("metadata was not stripped")
+		}
+		img, err := jpeg.Decode(bytes.NewReader(output))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// orientation 6 is rotated 90 degrees clockwise
+		if img.Bounds().Dx() != 20 || img.Bounds().Dy() != 40 {
+			t.Fatalf("expected 20x40 after applying the orientation, got %v", img.Bounds())
+		}
+	})
+
+	t.Run("longest edge is capped", func(t *testing.T) {
+		input := encodeTestImage(t, image.NewGray(image.Rect(0, 0, 3*MaxLLMImageEdge, MaxLLMImageEdge)), "png")
+		output, fileName, err := NormalizeImageForLLM(input, "wide.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fileName != "wide.jpg" {
+			t.Fatalf("expected opaque png to become wide.jpg, got %s", fileName)
+		}
+		config, _, err := image.DecodeConfig(bytes.NewReader(output))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Width != MaxLLMImageEdge || config.Height != MaxLLMImageEdge/3 {
+			t.Fatalf("expected %dx%d, got %dx%d", MaxLLMImageEdge, MaxLLMImageEdge/3, config.Width, config.Height)
+		}
+	})
+
+	t.Run("transparency stays png", func(t *testing.T) {
+		input := encodeTestImage(t, image.NewNRGBA(image.Rect(0, 0, 10, 10)), "png")
+		_, fileName, err := NormalizeImageForLLM(input, "sticker.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fileName != "sticker.png" {
+			t.Fatalf("expected sticker.png, got %s", fileName)
+		}
+	})
+
+	heic := append([]byte{0, 0, 0, 0x18}, []byte("ftypheic\x00\x00\x00\x00mif1heic")...)
+
+	t.Run("heic is converted", func(t *testing.T) {
+		// stands in for heif-convert, it writes a prepared jpeg to the output path given last
+		dir := t.TempDir()
+		converted := filepath.Join(dir, "converted.jpg")
+		if err := os.WriteFile(converted, encodeTestImage(t, image.NewGray(image.Rect(0, 0, 30, 40)), "jpeg"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		converter := filepath.Join(dir, "heif-convert")
+		script := "#!/bin/sh\nfor last; do :; done\ncp " + converted + " \"$last\"\n"
+		if err := os.WriteFile(converter, []byte(script), 0700); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("HEIC_CONVERTER", converter)
+
+		output, fileName, err := NormalizeImageForLLM(heic, "IMG_0001.HEIC")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fileName != "IMG_0001.jpg" {
+			t.Fatalf("expected IMG_0001.jpg, got %s", fileName)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(output))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds() != image.Rect(0, 0, 30, 40) {
+			t.Fatalf("expected the converted 30x40 photo, got %v", img.Bounds())
+		}
+	})
+
+	t.Run("heic without a converter is rejected", func(t *testing.T) {
+		t.Setenv("HEIC_CONVERTER", filepath.Join(t.TempDir(), "missing-heif-convert"))
+		_, _, err := NormalizeImageForLLM(heic, "IMG_0001.HEIC")
+		var formatErr *UnsupportedImageFormatError
+		if !errors.As(err, &formatErr) || formatErr.Format != "heic" {
+			t.Fatalf("expected UnsupportedImageFormatError for heic, got %v", err)
+		}
+	})
+}
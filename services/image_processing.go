@@ -6,6 +6,9 @@ import (
 	"image"
 	"image/color"
 	"image/png"
+	"math"
+	"runtime"
+	"sync"
 
 	"github.com/disintegration/imaging"
 )
@@ -13,8 +16,10 @@ import (
 // WhitenBackgroundSmooth composites the original image over a white background using a blurred mask.
 // This creates a very smooth, professional-looking transition without hard edges or artifacts.
 // - imageBytes: The input image as a byte slice.
-// - threshold: The brightness value (0-255) used to identify the background for the initial mask.
+// - threshold: The brightness value (0-255) used to identify the background for the initial mask, only regions connected to the image borders are replaced.
 // - blurSigma: The strength of the Gaussian blur applied to the mask. Higher values mean a softer, wider transition. A good starting value is 3.0 to 5.0.
+//
+// Pixels are read and written through the Pix slices and row bands are processed in parallel.
 func WhitenBackgroundSmooth(imageBytes []byte, threshold uint8, blurSigma float64) ([]byte, error) {
 	// 1. Decode the original image. We'll need it for the final composite.
 	originalImg, _, err := image.Decode(bytes.NewReader(imageBytes))
@@ -24,79 +29,308 @@ func WhitenBackgroundSmooth(imageBytes []byte, threshold uint8, blurSigma float6
 	bounds := originalImg.Bounds()
 	width, height := bounds.Max.X, bounds.Max.Y
 
-	// 2. GENERATE A HARD MASK
+	// 2. GENERATE THE FEATHERED BACKGROUND MASK (hard luminance mask, then blurred)
+	blurredMask := backgroundMask(originalImg, threshold, blurSigma)
+
+	// 3. COMPOSITE THE FINAL IMAGE
+	// Blending with white is done in the formula, no white canvas is needed.
+	finalImg := image.NewNRGBA(bounds)
+	parallelRows(height, func(minY, maxY int) {
+		row := make([]uint32, 4*width)
+		for y := minY; y < maxY; y++ {
+			// Get the original pixels' colors
+			readRowRGBA(originalImg, y, width, row)
+			maskRow := blurredMask.Pix[blurredMask.PixOffset(0, y):]
+			finalRow := finalImg.Pix[finalImg.PixOffset(0, y):]
+			for x := 0; x < width; x++ {
+				r, g, b, a := row[4*x], row[4*x+1], row[4*x+2], row[4*x+3]
+
+				// The mask's value for this pixel, the same as color.NRGBA.RGBA() gives for the R component.
+				// White on mask (65535) means background -> 0% original image.
+				// Black on mask (0) means foreground -> 100% original image.
+				maskAlpha := uint32(maskRow[4*x])
+				maskAlpha |= maskAlpha << 8
+				maskAlpha *= uint32(maskRow[4*x+3])
+				maskAlpha /= 0xff
+				alpha := 1.0 - float64(maskAlpha)/65535.0
+
+				// Linear interpolation: Final = Original * alpha + White * (1 - alpha)
+				finalR := float64(r)*alpha + 65535.0*(1.0-alpha)
+				finalG := float64(g)*alpha + 65535.0*(1.0-alpha)
+				finalB := float64(b)*alpha + 65535.0*(1.0-alpha)
+
+				finalRow[4*x] = uint8(finalR / 257)
+				finalRow[4*x+1] = uint8(finalG / 257)
+				finalRow[4*x+2] = uint8(finalB / 257)
+				finalRow[4*x+3] = uint8(a / 257)
+			}
+		}
+	})
+
+	// 4. Encode the final, beautifully blended image to PNG bytes
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, finalImg); err != nil {
+		return nil, fmt.Errorf("failed to encode final image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// backgroundMask builds a grayscale mask of the background (white = background, black = foreground),
+// then blurs it so the transition at the edges is feathered.
+// Only near-white regions connected to the image borders count as background, so white garments
+// enclosed by the person's outline are kept even when they are as bright as the background.
+func backgroundMask(originalImg image.Image, threshold uint8, blurSigma float64) *image.NRGBA {
+	bounds := originalImg.Bounds()
+	width, height := bounds.Max.X, bounds.Max.Y
+	// a pixel is close enough to the white background when it is not further away than the threshold gray,
+	// e.g. 244 allows a distance of 11*sqrt(3) in RGB space
+	tolerance := float64(255-int(threshold)) * math.Sqrt(3)
+	toleranceSquared := tolerance * tolerance
+
+	// 1. mark the pixels whose color is within the tolerance of white
+	candidates := make([]bool, width*height)
+	parallelRows(height, func(minY, maxY int) {
+		row := make([]uint32, 4*width)
+		for y := minY; y < maxY; y++ {
+			readRowRGBA(originalImg, y, width, row)
+			for x := 0; x < width; x++ {
+				dr := 255 - float64(uint8(row[4*x]>>8))
+				dg := 255 - float64(uint8(row[4*x+1]>>8))
+				db := 255 - float64(uint8(row[4*x+2]>>8))
+				candidates[y*width+x] = dr*dr+dg*dg+db*db <= toleranceSquared
+			}
+		}
+	})
+
+	// 2. erode the candidates so the fill cannot leak into the person through narrow gaps,
+	// e.g. where a blown out white shirt touches the background without a visible outline
+	seeds := erodeMask(candidates, width, height, backgroundLeakRadius)
+
+	// 3. flood fill the eroded candidates from the borders (4-connected)
+	background := make([]bool, width*height)
+	queue := make([]int, 0, 2*(width+height))
+	visit := func(x, y int) {
+		i := y*width + x
+		if !seeds[i] || background[i] {
+			return
+		}
+		background[i] = true
+		queue = append(queue, i)
+	}
+	for x := 0; x < width; x++ {
+		visit(x, 0)
+		visit(x, height-1)
+	}
+	for y := 0; y < height; y++ {
+		visit(0, y)
+		visit(width-1, y)
+	}
+	for len(queue) > 0 {
+		i := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		x, y := i%width, i/width
+		if x > 0 {
+			visit(x-1, y)
+		}
+		if x < width-1 {
+			visit(x+1, y)
+		}
+		if y > 0 {
+			visit(x, y-1)
+		}
+		if y < height-1 {
+			visit(x, y+1)
+		}
+	}
+
+	// 4. grow the filled region back by the erosion radius, but only over candidate pixels,
+	// the rest is foreground
+	background = dilateMask(background, width, height, backgroundLeakRadius)
 	// The mask is a grayscale image. White = background, Black = foreground.
 	mask := image.NewGray(bounds)
 	for y := 0; y < height; y++ {
+		maskRow := mask.Pix[mask.PixOffset(0, y):]
 		for x := 0; x < width; x++ {
-			c := originalImg.At(x, y)
-			r, g, b, _ := c.RGBA()
-			r8, g8, b8 := uint8(r>>8), uint8(g>>8), uint8(b>>8)
-
-			// Use luminance to determine if a pixel is background.
-			// This is more accurate than a simple RGB check.
-			luminance := 0.299*float64(r8) + 0.587*float64(g8) + 0.114*float64(b8)
-
-			if luminance >= float64(threshold) {
-				mask.SetGray(x, y, color.Gray{Y: 255}) // White: part of the background to be replaced
-			} else {
-				mask.SetGray(x, y, color.Gray{Y: 0}) // Black: part of the foreground to keep
+			if background[y*width+x] && candidates[y*width+x] {
+				maskRow[x] = 255
 			}
 		}
 	}
 
-	// 3. SMOOTH THE MASK
 	// This is the key step. We blur the hard mask to create a soft, feathered transition.
 	// The 'blurSigma' parameter controls how soft the edge becomes.
-	blurredMask := imaging.Blur(mask, blurSigma)
+	return imaging.Blur(mask, blurSigma)
+}
 
-	// 4. COMPOSITE THE FINAL IMAGE
-	// Create a new pure white canvas.
-	whiteBg := image.NewNRGBA(bounds)
-	for y := 0; y < height; y++ {
+// backgroundLeakRadius is the half width of the narrowest gap the background fill can pass through.
+// Blown out garment areas wider than that which touch the background are still treated as background.
+const backgroundLeakRadius = 12
+
+// erodeMask keeps a pixel only when the whole square of the given radius around it is set.
+// Pixels outside the image count as set, so the borders are not eroded.
+func erodeMask(mask []bool, width, height, radius int) []bool {
+	return squareFilter(mask, width, height, radius, true)
+}
+
+// dilateMask sets a pixel when any pixel in the square of the given radius around it is set.
+func dilateMask(mask []bool, width, height, radius int) []bool {
+	return squareFilter(mask, width, height, radius, false)
+}
+
+// squareFilter runs a separable min (erode) or max (dilate) filter over a square window.
+func squareFilter(mask []bool, width, height, radius int, erode bool) []bool {
+	// a pixel of the result differs from the default when any pixel of the window differs from it
+	horizontal := make([]bool, len(mask))
+	parallelRows(height, func(minY, maxY int) {
+		for y := minY; y < maxY; y++ {
+			row := mask[y*width : (y+1)*width]
+			// left to right finds the nearest differing pixel on the left, right to left the one on the right
+			last := -radius - 1
+			for x := 0; x < width; x++ {
+				if row[x] != erode {
+					last = x
+				}
+				horizontal[y*width+x] = x-last <= radius
+			}
+			last = width + radius
+			for x := width - 1; x >= 0; x-- {
+				if row[x] != erode {
+					last = x
+				}
+				if last-x <= radius {
+					horizontal[y*width+x] = true
+				}
+			}
+		}
+	})
+	result := make([]bool, len(mask))
+	parallelRows(height, func(minY, maxY int) {
+		for y := minY; y < maxY; y++ {
+			for x := 0; x < width; x++ {
+				differs := false
+				for dy := max(0, y-radius); dy <= min(height-1, y+radius); dy++ {
+					if horizontal[dy*width+x] {
+						differs = true
+						break
+					}
+				}
+				// horizontal holds "a differing pixel is near", flip it back to the mask value
+				result[y*width+x] = differs != erode
+			}
+		}
+	})
+	return result
+}
+
+// readRowRGBA fills row with the alpha-premultiplied 16-bit r, g, b, a values of the pixels (0, y) to (width-1, y),
+// exactly as image.Image.At(x, y).RGBA() returns them. The common decoded types are read from Pix directly.
+func readRowRGBA(img image.Image, y int, width int, row []uint32) {
+	switch src := img.(type) {
+	case *image.NRGBA:
+		pix := src.Pix[src.PixOffset(0, y):]
 		for x := 0; x < width; x++ {
-			whiteBg.Set(x, y, color.White)
+			a := uint32(pix[4*x+3])
+			for c := 0; c < 3; c++ {
+				v := uint32(pix[4*x+c])
+				v |= v << 8
+				v *= a
+				v /= 0xff
+				row[4*x+c] = v
+			}
+			row[4*x+3] = a | a<<8
+		}
+	case *image.RGBA:
+		pix := src.Pix[src.PixOffset(0, y):]
+		for x := 0; x < width; x++ {
+			for c := 0; c < 4; c++ {
+				v := uint32(pix[4*x+c])
+				row[4*x+c] = v | v<<8
+			}
+		}
+	default:
+		for x := 0; x < width; x++ {
+			row[4*x], row[4*x+1], row[4*x+2], row[4*x+3] = img.At(x, y).RGBA()
 		}
 	}
+}
 
-	// Create the destination image.
-	finalImg := image.NewNRGBA(bounds)
+// parallelRows splits the rows [0, height) into one band per CPU and runs fn on each band concurrently.
+func parallelRows(height int, fn func(minY, maxY int)) {
+	workers := min(runtime.GOMAXPROCS(0), height)
+	if workers <= 1 {
+		fn(0, height)
+		return
+	}
+	bandHeight := (height + workers - 1) / workers
+	var wg sync.WaitGroup
+	for minY := 0; minY < height; minY += bandHeight {
+		maxY := min(minY+bandHeight, height)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(minY, maxY)
+		}()
+	}
+	wg.Wait()
+}
 
-	// Iterate and blend pixel by pixel using the blurred mask.
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			// Get the original pixel's color
-			r, g, b, a := originalImg.At(x, y).RGBA()
-
-			// Get the mask's alpha value for this pixel. The blurred mask is grayscale,
-			// so the R component is the gray value.
-			maskAlpha, _, _, _ := blurredMask.At(x, y).RGBA()
-
-			// Normalize the mask value from 0-65535 to 0.0-1.0
-			// This alpha determines how much of the original image shows through.
-			// Note: We INVERT the mask's logic.
-			// White on mask (65535) means background -> 0% original image.
-			// Black on mask (0) means foreground -> 100% original image.
-			alpha := 1.0 - float64(maskAlpha)/65535.0
-
-			// Linear interpolation: Final = Original * alpha + White * (1 - alpha)
-			finalR := float64(r)*alpha + 65535.0*(1.0-alpha)
-			finalG := float64(g)*alpha + 65535.0*(1.0-alpha)
-			finalB := float64(b)*alpha + 65535.0*(1.0-alpha)
-
-			finalImg.SetNRGBA(x, y, color.NRGBA{
-				R: uint8(finalR / 257),
-				G: uint8(finalG / 257),
-				B: uint8(finalB / 257),
-				A: uint8(a / 257),
-			})
-		}
+// BackgroundToAlpha makes the background of the image transparent instead of white, using the same
+// feathered mask as WhitenBackgroundSmooth, and returns a PNG with a real alpha channel.
+// - imageBytes: The input image as a byte slice.
+// - threshold: The brightness value (0-255) used to identify the background for the initial mask.
+// - blurSigma: The strength of the Gaussian blur applied to the mask, softening the alpha at the edges.
+func BackgroundToAlpha(imageBytes []byte, threshold uint8, blurSigma float64) ([]byte, error) {
+	originalImg, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
+	bounds := originalImg.Bounds()
+	width, height := bounds.Max.X, bounds.Max.Y
+	blurredMask := backgroundMask(originalImg, threshold, blurSigma)
+
+	finalImg := image.NewNRGBA(bounds)
+	parallelRows(height, func(minY, maxY int) {
+		row := make([]uint32, 4*width)
+		for y := minY; y < maxY; y++ {
+			readRowRGBA(originalImg, y, width, row)
+			maskRow := blurredMask.Pix[blurredMask.PixOffset(0, y):]
+			finalRow := finalImg.Pix[finalImg.PixOffset(0, y):]
+			for x := 0; x < width; x++ {
+				// non-premultiplied color, so the RGB stays untouched and only the alpha changes,
+				// the same conversion as color.NRGBAModel
+				c := nrgbaFromPremultiplied(row[4*x], row[4*x+1], row[4*x+2], row[4*x+3])
+				// the mask's R value as color.NRGBA.RGBA() gives it
+				maskAlpha := uint32(maskRow[4*x])
+				maskAlpha |= maskAlpha << 8
+				maskAlpha *= uint32(maskRow[4*x+3])
+				maskAlpha /= 0xff
+				// White on mask means background -> transparent, black means foreground -> keep the original alpha
+				alpha := 1.0 - float64(maskAlpha)/65535.0
+				finalRow[4*x] = c.R
+				finalRow[4*x+1] = c.G
+				finalRow[4*x+2] = c.B
+				finalRow[4*x+3] = uint8(float64(c.A)*alpha + 0.5)
+			}
+		}
+	})
 
-	// 5. Encode the final, beautifully blended image to PNG bytes
 	var buf bytes.Buffer
 	if err := png.Encode(&buf, finalImg); err != nil {
 		return nil, fmt.Errorf("failed to encode final image: %w", err)
 	}
 	return buf.Bytes(), nil
 }
+
+// nrgbaFromPremultiplied converts 16-bit alpha-premultiplied values, as readRowRGBA returns them, like color.NRGBAModel does.
+func nrgbaFromPremultiplied(r, g, b, a uint32) color.NRGBA {
+	if a == 0xffff {
+		return color.NRGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: 0xff}
+	}
+	if a == 0 {
+		return color.NRGBA{}
+	}
+	r = (r * 0xffff) / a
+	g = (g * 0xffff) / a
+	b = (b * 0xffff) / a
+	return color.NRGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: uint8(a >> 8)}
+}
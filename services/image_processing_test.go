@@ -0,0 +1,263 @@
+package services
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden images in testdata")
+
+// luminanceMaskReference is the original background mask: every pixel at or above the luminance threshold,
+// wherever it is in the image, blurred.
+func luminanceMaskReference(originalImg image.Image, threshold uint8, blurSigma float64) *image.NRGBA {
+	bounds := originalImg.Bounds()
+	width, height := bounds.Max.X, bounds.Max.Y
+	mask := image.NewGray(bounds)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := originalImg.At(x, y).RGBA()
+			r8, g8, b8 := uint8(r>>8), uint8(g>>8), uint8(b>>8)
+			luminance := 0.299*float64(r8) + 0.587*float64(g8) + 0.114*float64(b8)
+			if luminance >= float64(threshold) {
+				mask.SetGray(x, y, color.Gray{Y: 255})
+			} else {
+				mask.SetGray(x, y, color.Gray{Y: 0})
+			}
+		}
+	}
+	return imaging.Blur(mask, blurSigma)
+}
+
+// whitenBackgroundSmoothReference is the original At/Set based implementation with the given mask,
+// luminanceMaskReference for the original output and backgroundMask to check that WhitenBackgroundSmooth
+// still composites identically.
+func whitenBackgroundSmoothReference(imageBytes []byte, threshold uint8, blurSigma float64, buildMask func(image.Image, uint8, float64) *image.NRGBA) ([]byte, error) {
+	originalImg, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	bounds := originalImg.Bounds()
+	width, height := bounds.Max.X, bounds.Max.Y
+
+	blurredMask := buildMask(originalImg, threshold, blurSigma)
+
+	whiteBg := image.NewNRGBA(bounds)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			whiteBg.Set(x, y, color.White)
+		}
+	}
+
+	finalImg := image.NewNRGBA(bounds)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, a := originalImg.At(x, y).RGBA()
+			maskAlpha, _, _, _ := blurredMask.At(x, y).RGBA()
+			alpha := 1.0 - float64(maskAlpha)/65535.0
+			finalR := float64(r)*alpha + 65535.0*(1.0-alpha)
+			finalG := float64(g)*alpha + 65535.0*(1.0-alpha)
+			finalB := float64(b)*alpha + 65535.0*(1.0-alpha)
+			finalImg.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(finalR / 257),
+				G: uint8(finalG / 257),
+				B: uint8(finalB / 257),
+				A: uint8(a / 257),
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, finalImg); err != nil {
+		return nil, fmt.Errorf("failed to encode final image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// syntheticWhitenInputs covers the decoded image types: translucent NRGBA, gray and YCbCr (jpeg).
+func syntheticWhitenInputs(t testing.TB) map[string][]byte {
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 97, 131))
+	gray := image.NewGray(image.Rect(0, 0, 97, 131))
+	for y := 0; y < 131; y++ {
+		for x := 0; x < 97; x++ {
+			nrgba.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 3), G: uint8(y * 2), B: uint8(x + y), A: uint8(255 - x)})
+			gray.SetGray(x, y, color.Gray{Y: uint8(200 + (x*y)%56)})
+		}
+	}
+	inputs := map[string][]byte{}
+	for name, img := range map[string]image.Image{"nrgba": nrgba, "gray": gray} {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		inputs[name] = buf.Bytes()
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, nrgba, nil); err != nil {
+		t.Fatal(err)
+	}
+	inputs["jpeg"] = buf.Bytes()
+	return inputs
+}
+
+func TestWhitenBackgroundSmoothMatchesReference(t *testing.T) {
+	inputs := syntheticWhitenInputs(t)
+	inputPng, err := os.ReadFile("../input.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs["input.png"] = inputPng
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			expected, err := whitenBackgroundSmoothReference(input, 244, 4.0, backgroundMask)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, err := WhitenBackgroundSmooth(input, 244, 4.0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(expected, actual) {
+				t.Fatalf("output differs from the reference implementation")
+			}
+		})
+	}
+}
+
+func BenchmarkWhitenBackgroundSmooth(b *testing.B) {
+	input, err := os.ReadFile("../input.png")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := WhitenBackgroundSmooth(input, 244, 4.0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWhitenBackgroundSmoothReference(b *testing.B) {
+	input, err := os.ReadFile("../input.png")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := whitenBackgroundSmoothReference(input, 244, 4.0, luminanceMaskReference); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// checkGolden compares the output with testdata/<name>, run `go test ./services -run Golden -update` to rewrite it.
+func checkGolden(t *testing.T, name string, actual []byte) {
+	t.Helper()
+	goldenPath := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(goldenPath, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("missing golden image %s, run with -update: %v", goldenPath, err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Fatalf("output differs from golden image %s, run with -update if the change is intended", goldenPath)
+	}
+}
+
+func TestBackgroundGolden(t *testing.T) {
+	fixtures := map[string]string{
+		"white_canvas": "../white_540x960.png",
+		"white_outfit": "../output_smooth.png",
+	}
+	for name, fixture := range fixtures {
+		input, err := os.ReadFile(fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(name+"/whiten", func(t *testing.T) {
+			actual, err := WhitenBackgroundSmooth(input, 244, 4.0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, name+"_whiten.golden.png", actual)
+		})
+		t.Run(name+"/alpha", func(t *testing.T) {
+			actual, err := BackgroundToAlpha(input, 244, 4.0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, name+"_alpha.golden.png", actual)
+		})
+	}
+}
+
+func TestBackgroundMaskFloodFill(t *testing.T) {
+	// a white frame around a dark outline that encloses a white square wider than the leak radius
+	const size, outlineMin, outlineMax, thickness = 200, 50, 150, 8
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			c := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+			inOutline := x >= outlineMin && x < outlineMax && y >= outlineMin && y < outlineMax
+			inInterior := x >= outlineMin+thickness && x < outlineMax-thickness && y >= outlineMin+thickness && y < outlineMax-thickness
+			if inOutline && !inInterior {
+				c = color.NRGBA{R: 30, G: 30, B: 30, A: 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	if interior := outlineMax - outlineMin - 2*thickness; interior < 2*backgroundLeakRadius {
+		t.Fatalf("the enclosed region of %dpx must survive the erosion", interior)
+	}
+
+	mask := backgroundMask(img, 244, 1.0)
+	maskAt := func(x, y int) uint8 {
+		return mask.NRGBAAt(x, y).R
+	}
+	// the frame touches the border
+	for _, p := range []image.Point{{0, 0}, {10, 100}, {size - 1, size - 1}, {100, outlineMin - 10}} {
+		if v := maskAt(p.X, p.Y); v != 255 {
+			t.Errorf("frame pixel %v is %d, expected background", p, v)
+		}
+	}
+	// the enclosed white stays foreground, as does the outline
+	for _, p := range []image.Point{{100, 100}, {outlineMin + thickness + 5, 100}, {outlineMin + thickness/2, 100}} {
+		if v := maskAt(p.X, p.Y); v != 0 {
+			t.Errorf("enclosed pixel %v is %d, expected foreground", p, v)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	transparent, err := BackgroundToAlpha(buf.Bytes(), 244, 1.0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := png.Decode(bytes.NewReader(transparent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := decoded.At(10, 10).RGBA(); a != 0 {
+		t.Errorf("frame alpha is %d, expected transparent", a)
+	}
+	if _, _, _, a := decoded.At(100, 100).RGBA(); a != 0xffff {
+		t.Errorf("enclosed alpha is %d, expected opaque", a)
+	}
+}
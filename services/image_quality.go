@@ -0,0 +1,143 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	QualityLowResolution  = "low_resolution"
+	QualityAspectRatio    = "aspect_ratio"
+	QualityBlank          = "blank"
+	QualityGrayBackground = "gray_background"
+	QualityCroppedBody    = "cropped_body"
+)
+
+// ImageQualityError describes why a generated image did not pass CheckGeneratedImage.
+type ImageQualityError struct {
+	Reason string
+	Detail string
+}
+
+func (e *ImageQualityError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Reason, e.Detail)
+}
+
+type ImageQualityOptions struct {
+	AspectRatio TryOnAspectRatio
+	// border checks only make sense for the flat white background
+	WhiteBackground bool
+}
+
+const (
+	qualityMinShortSide = 512
+	// allowed relative difference between requested and generated aspect ratio
+	qualityAspectTolerance = 0.05
+	// luminance below this is not considered white background
+	qualityWhiteLuminance = 235.0
+	// share of the side taken by a border band
+	qualityBorderBand = 0.02
+	// share of non-white pixels allowed in the left and right border bands
+	qualityMaxBorderNonWhite = 0.1
+	// share of non-white pixels allowed in the top and bottom bands, anything of the person there means it is cut
+	qualityMaxEdgeNonWhite = 0.03
+	// luminance standard deviation below this is a single flat color
+	qualityMinLuminanceStdDev = 3.0
+)
+
+// Ratio returns width divided by height, e.g. 0.5625 for 9:16.
+func (a TryOnAspectRatio) Ratio() float64 {
+	parts := strings.Split(string(a), ":")
+	if len(parts) != 2 {
+		return 0
+	}
+	w, errW := strconv.ParseFloat(parts[0], 64)
+	h, errH := strconv.ParseFloat(parts[1], 64)
+	if errW != nil || errH != nil || h == 0 {
+		return 0
+	}
+	return w / h
+}
+
+// CheckGeneratedImage runs cheap local checks on a generated image: minimum resolution,
+// aspect ratio, blank output and, for white backgrounds, gray borders and bodies cut by the top or bottom edge.
+// It returns an *ImageQualityError for the first failed check.
+func CheckGeneratedImage(imageBytes []byte, options ImageQualityOptions) error {
+	img, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return &ImageQualityError{Reason: QualityBlank, Detail: fmt.Sprintf("failed to decode image: %v", err)}
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if min(width, height) < qualityMinShortSide {
+		return &ImageQualityError{Reason: QualityLowResolution, Detail: fmt.Sprintf("%dx%d is below %dpx", width, height, qualityMinShortSide)}
+	}
+
+	if expected := options.AspectRatio.Ratio(); expected > 0 {
+		actual := float64(width) / float64(height)
+		if math.Abs(actual-expected)/expected > qualityAspectTolerance {
+			return &ImageQualityError{Reason: QualityAspectRatio, Detail: fmt.Sprintf("%dx%d does not match %s", width, height, options.AspectRatio)}
+		}
+	}
+
+	luminance := func(x, y int) float64 {
+		r, g, b, _ := img.At(x, y).RGBA()
+		return 0.299*float64(r>>8) + 0.587*float64(g>>8) + 0.114*float64(b>>8)
+	}
+
+	// sample on a grid, enough to tell a flat image apart from a photo
+	step := max(1, min(width, height)/128)
+	var sum, sumSquares, count float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			l := luminance(x, y)
+			sum += l
+			sumSquares += l * l
+			count++
+		}
+	}
+	mean := sum / count
+	if stdDev := math.Sqrt(math.Max(0, sumSquares/count-mean*mean)); stdDev < qualityMinLuminanceStdDev {
+		return &ImageQualityError{Reason: QualityBlank, Detail: fmt.Sprintf("luminance deviation %.2f", stdDev)}
+	}
+
+	if !options.WhiteBackground {
+		return nil
+	}
+	// share of non-white pixels in a border rectangle
+	nonWhiteShare := func(rect image.Rectangle) float64 {
+		var nonWhite, total float64
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				if luminance(x, y) < qualityWhiteLuminance {
+					nonWhite++
+				}
+				total++
+			}
+		}
+		if total == 0 {
+			return 0
+		}
+		return nonWhite / total
+	}
+	bandX := max(1, int(float64(width)*qualityBorderBand))
+	bandY := max(1, int(float64(height)*qualityBorderBand))
+	left := nonWhiteShare(image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Min.X+bandX, bounds.Max.Y))
+	right := nonWhiteShare(image.Rect(bounds.Max.X-bandX, bounds.Min.Y, bounds.Max.X, bounds.Max.Y))
+	top := nonWhiteShare(image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Max.X, bounds.Min.Y+bandY))
+	bottom := nonWhiteShare(image.Rect(bounds.Min.X, bounds.Max.Y-bandY, bounds.Max.X, bounds.Max.Y))
+
+	// the person stands in the center, so gray on the side bands is the background itself
+	if left > qualityMaxBorderNonWhite || right > qualityMaxBorderNonWhite {
+		return &ImageQualityError{Reason: QualityGrayBackground, Detail: fmt.Sprintf("non-white border share left %.2f, right %.2f", left, right)}
+	}
+	if top > qualityMaxEdgeNonWhite || bottom > qualityMaxEdgeNonWhite {
+		return &ImageQualityError{Reason: QualityCroppedBody, Detail: fmt.Sprintf("non-white border share top %.2f, bottom %.2f", top, bottom)}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// syntheticTryOn draws a dark "person" rectangle on a background, the rectangle is given in shares of the image size.
+func syntheticTryOn(width int, height int, background color.Gray, person [4]float64) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	personRect := image.Rect(int(person[0]*float64(width)), int(person[1]*float64(height)), int(person[2]*float64(width)), int(person[3]*float64(height)))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if image.Pt(x, y).In(personRect) {
+				img.SetGray(x, y, color.Gray{Y: 40})
+			} else {
+				img.SetGray(x, y, background)
+			}
+		}
+	}
+	return img
+}
+
+func TestCheckGeneratedImage(t *testing.T) {
+	white := color.Gray{Y: 255}
+	centered := [4]float64{0.3, 0.1, 0.7, 0.9}
+	whiteBackground := ImageQualityOptions{AspectRatio: AspectRatio9x16, WhiteBackground: true}
+
+	tests := []struct {
+		name    string
+		image   image.Image
+		options ImageQualityOptions
+		reason  string
+	}{
+		{"centered person on white", syntheticTryOn(576, 1024, white, centered), whiteBackground, ""},
+		{"small image", syntheticTryOn(288, 512, white, centered), whiteBackground, QualityLowResolution},
+		{"square instead of 9:16", syntheticTryOn(1024, 1024, white, centered), whiteBackground, QualityAspectRatio},
+		{"no requested ratio", syntheticTryOn(1024, 1024, white, centered), ImageQualityOptions{WhiteBackground: true}, ""},
+		{"flat white", syntheticTryOn(576, 1024, white, [4]float64{}), whiteBackground, QualityBlank},
+		{"flat gray", syntheticTryOn(576, 1024, color.Gray{Y: 128}, [4]float64{}), ImageQualityOptions{}, QualityBlank},
+		{"gray background", syntheticTryOn(576, 1024, color.Gray{Y: 200}, centered), whiteBackground, QualityGrayBackground},
+		{"gray background in a scene", syntheticTryOn(576, 1024, color.Gray{Y: 200}, centered), ImageQualityOptions{AspectRatio: AspectRatio9x16}, ""},
+		{"head cut by the top", syntheticTryOn(576, 1024, white, [4]float64{0.3, 0, 0.7, 0.9}), whiteBackground, QualityCroppedBody},
+		{"feet cut by the bottom", syntheticTryOn(576, 1024, white, [4]float64{0.3, 0.1, 0.7, 1}), whiteBackground, QualityCroppedBody},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckGeneratedImage(encodeTestImage(t, test.image, "png"), test.options)
+			if test.reason == "" {
+				if err != nil {
+					t.Fatalf("expected the image to pass, got %v", err)
+				}
+				return
+			}
+			var qualityErr *ImageQualityError
+			if !errors.As(err, &qualityErr) || qualityErr.Reason != test.reason {
+				t.Fatalf("expected %s, got %v", test.reason, err)
+			}
+		})
+	}
+
+	if err := CheckGeneratedImage([]byte("not an image"), whiteBackground); err == nil {
+		t.Fatal("expected an undecodable image to fail")
+	}
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"letryapi/models"
+
+	firebase "firebase.google.com/go/v4"
+	"github.com/getsentry/sentry-go"
+	"gorm.io/gorm"
+)
+
+// LLMBudgetWarnRatio is the share of the monthly budget after which the company is warned and the owner notified
+const LLMBudgetWarnRatio = 0.8
+
+// What happens to new LLM work of a company over its monthly budget
+const (
+	LLMBudgetActionRefuse    = "refuse"
+	LLMBudgetActionDowngrade = "downgrade"
+)
+
+// llmDowngrades is the cheaper model of the same kind (image or text) used over budget with LLMBudgetActionDowngrade
+var llmDowngrades = map[LLMModelName]LLMModelName{
+	Pro25:        Flash25,
+	Flash25:      FlashLite25,
+	Flash25Image: Seedream40,
+}
+
+// DowngradeLLMModel returns the cheaper model for the model, false when there is none.
+func DowngradeLLMModel(model LLMModelName) (LLMModelName, bool) {
+	cheaper, ok := llmDowngrades[model]
+	return cheaper, ok
+}
+
+// LLMBudgetStatus is the LLM usage of a company in the current calendar month (UTC) against its budget.
+type LLMBudgetStatus struct {
+	Period     string
+	SpentUSD   float64
+	UsedTokens int64
+	// Ratio is the larger used share of the cost and the token budget
+	Ratio float64
+}
+
+func (s *LLMBudgetStatus) Warning() bool {
+	return s.Ratio >= LLMBudgetWarnRatio
+}
+
+func (s *LLMBudgetStatus) Exceeded() bool {
+	return s.Ratio >= 1
+}
+
+// Message is the text shown to the members of the company
+func (s *LLMBudgetStatus) Message() string {
+	if s.Exceeded() {
+		return "Your company has used its monthly AI budget"
+	}
+	return fmt.Sprintf("Your company has used %d%% of its monthly AI budget", int(s.Ratio*100))
+}
+
+// GetLLMBudgetStatus sums the LLMUsage ledger of the company for the month of now.
+// It returns nil without an error when the company has no budget.
+func GetLLMBudgetStatus(db *gorm.DB, company models.Company, now time.Time) (*LLMBudgetStatus, error) {
+	if company.MonthlyLLMBudgetUSD == nil && company.MonthlyLLMTokenBudget == nil {
+		return nil, nil
+	}
+	now = now.UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var totals struct {
+		SpentUSD   float64
+		UsedTokens int64
+	}
+	err := db.Model(&models.LLMUsage{}).
+		Select("COALESCE(SUM(cost_usd), 0) AS spent_usd, COALESCE(SUM(total_token_count), 0) AS used_tokens").
+		Where("company_id = ? AND created_at >= ?", company.ID, monthStart).
+		Scan(&totals).Error
+	if err != nil {
+		return nil, err
+	}
+	status := &LLMBudgetStatus{Period: monthStart.Format("2006-01"), SpentUSD: totals.SpentUSD, UsedTokens: totals.UsedTokens}
+	if company.MonthlyLLMBudgetUSD != nil {
+		status.Ratio = budgetRatio(totals.SpentUSD, *company.MonthlyLLMBudgetUSD)
+	}
+	if company.MonthlyLLMTokenBudget != nil {
+		status.Ratio = max(status.Ratio, budgetRatio(float64(totals.UsedTokens), float64(*company.MonthlyLLMTokenBudget)))
+	}
+	return status, nil
+}
+
+func budgetRatio(used, budget float64) float64 {
+	if budget <= 0 {
+		// a zero budget allows nothing
+		return 1
+	}
+	return used / budget
+}
+
+// NotifyLLMBudget sends the owner of the company a push notification once per month when the usage
+// passes LLMBudgetWarnRatio and once when it passes the budget.
+func NotifyLLMBudget(fbApp *firebase.App, db *gorm.DB, company models.Company, status *LLMBudgetStatus) {
+	if status == nil || !status.Warning() {
+		return
+	}
+	level := int(LLMBudgetWarnRatio * 100)
+	if status.Exceeded() {
+		level = 100
+	}
+	// the conditional update makes concurrent requests and workers notify only once per level
+	result := db.Model(&models.Company{}).
+		Where("id = ? AND (llm_budget_notified_period IS NULL OR llm_budget_notified_period <> ? OR llm_budget_notified_level < ?)", company.ID, status.Period, level).
+		Updates(map[string]interface{}{"llm_budget_notified_period": status.Period, "llm_budget_notified_level": level})
+	if result.Error != nil {
+		sentry.CaptureException(fmt.Errorf("[Company: %v] Error on saving the LLM budget notification: %v", company.ID, result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	fmt.Printf("[Company: %v] LLM budget at %d%%, spent %.2f USD, %d tokens\n", company.ID, int(status.Ratio*100), status.SpentUSD, status.UsedTokens)
+	if fbApp == nil {
+		return
+	}
+	SendNotification(fbApp, db, company.OwnerID, "AI budget", status.Message(), map[string]string{"type": "llm_budget", "level": fmt.Sprint(level)})
+}
+
+// LLMBudgetNotifier is a MeteredLLMProcessor.OnRecord hook notifying the owner when a call
+// takes the company over LLMBudgetWarnRatio or its budget.
+func LLMBudgetNotifier(fbApp *firebase.App, db *gorm.DB) func(usage models.LLMUsage) {
+	return func(usage models.LLMUsage) {
+		if usage.CompanyID == nil || usage.CostUSD == 0 && usage.TotalTokenCount == 0 {
+			return
+		}
+		var company models.Company
+		if err := db.First(&company, *usage.CompanyID).Error; err != nil {
+			fmt.Printf("[Company: %v] Error on loading the company for the LLM budget: %v\n", *usage.CompanyID, err)
+			return
+		}
+		status, err := GetLLMBudgetStatus(db, company, usage.CreatedAt)
+		if err != nil {
+			sentry.CaptureException(fmt.Errorf("[Company: %v] Error on loading the LLM budget: %v", company.ID, err))
+			return
+		}
+		NotifyLLMBudget(fbApp, db, company, status)
+	}
+}
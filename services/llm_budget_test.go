@@ -0,0 +1,40 @@
+package services
+
+import "testing"
+
+func TestLLMBudgetStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		used     float64
+		budget   float64
+		warning  bool
+		exceeded bool
+	}{
+		{"under", 10, 100, false, false},
+		{"near", 80, 100, true, false},
+		{"over", 120, 100, true, true},
+		{"zero budget", 0, 0, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := LLMBudgetStatus{Ratio: budgetRatio(tt.used, tt.budget)}
+			if status.Warning() != tt.warning || status.Exceeded() != tt.exceeded {
+				t.Fatalf("ratio %v: warning %v exceeded %v", status.Ratio, status.Warning(), status.Exceeded())
+			}
+		})
+	}
+}
+
+func TestDowngradeLLMModel(t *testing.T) {
+	for model, cheaper := range llmDowngrades {
+		if model.IsImageModel() != cheaper.IsImageModel() {
+			t.Fatalf("%s is downgraded to %s of another kind", model, cheaper)
+		}
+		if LLMPrices[cheaper].OutputPerMillion > LLMPrices[model].OutputPerMillion {
+			t.Fatalf("%s is not cheaper than %s", cheaper, model)
+		}
+	}
+	if _, ok := DowngradeLLMModel(Seedream40); ok {
+		t.Fatal("Seedream40 has no cheaper model")
+	}
+}
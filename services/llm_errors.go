@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// Failure kinds of the processing pipeline. The errors of the LLM processors and the R2 helpers wrap one of them,
+// so the task handlers pick the user message and the retry with errors.Is instead of matching the error text.
+var (
+	// the model or its safety system refused the input or the output
+	ErrContentBlocked = errors.New("content violation")
+	// the photo has no person to build an avatar or a try-on from
+	ErrNoPersonDetected = errors.New("no person detected")
+	// an uploaded file is gone or can't be read as an image
+	ErrAssetMissing = errors.New("asset missing")
+	// rate limits, 5xx and timeouts of the model API, worth another attempt
+	ErrTransientUpstream = errors.New("transient upstream error")
+	// the model answered, but not in the expected format
+	ErrParseFailure = errors.New("parse failure")
+)
+
+// llmFailureKinds lists the failure kinds for storing them by name, see RecordingLLMProcessor
+var llmFailureKinds = map[string]error{
+	"content_blocked":    ErrContentBlocked,
+	"no_person_detected": ErrNoPersonDetected,
+	"asset_missing":      ErrAssetMissing,
+	"transient_upstream": ErrTransientUpstream,
+	"parse_failure":      ErrParseFailure,
+}
+
+// llmFailureKindName is the name of the failure kind of err, empty for unknown errors
+func llmFailureKindName(err error) string {
+	for name, kind := range llmFailureKinds {
+		if errors.Is(err, kind) {
+			return name
+		}
+	}
+	return ""
+}
+
+// kindError is an error restored from its text and failure kind
+type kindError struct {
+	message string
+	kind    error
+}
+
+func (e *kindError) Error() string {
+	return e.message
+}
+
+func (e *kindError) Unwrap() error {
+	return e.kind
+}
+
+// IsPermanentFailure tells whether retrying can't change the outcome, the task must not be retried.
+// Unknown errors are not permanent.
+func IsPermanentFailure(err error) bool {
+	return errors.Is(err, ErrContentBlocked) ||
+		errors.Is(err, ErrNoPersonDetected) ||
+		errors.Is(err, ErrAssetMissing) ||
+		errors.Is(err, ErrParseFailure)
+}
+
+// noPersonMarker is what the avatar and try-on prompts ask the model to answer without a person in the photo
+const noPersonMarker = "NO_PERSON"
+
+// checkNoPerson turns the NO_PERSON answer of an image model into ErrNoPersonDetected.
+func checkNoPerson(response *LLMResponse) error {
+	if response != nil && strings.Contains(response.Response, noPersonMarker) {
+		return fmt.Errorf("%w: %s", ErrNoPersonDetected, strings.TrimSpace(response.Response))
+	}
+	return nil
+}
+
+// classifyUpstreamError wraps the errors of a model API call worth retrying with ErrTransientUpstream.
+func classifyUpstreamError(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		if isTransientStatus(apiErr.Code) {
+			return fmt.Errorf("%w: %w", ErrTransientUpstream, err)
+		}
+		return err
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) {
+		return fmt.Errorf("%w: %w", ErrTransientUpstream, err)
+	}
+	if code, ok := flattenedAPIErrorCode(err); ok && isTransientStatus(code) {
+		return fmt.Errorf("%w: %w", ErrTransientUpstream, err)
+	}
+	return err
+}
+
+// flattenedAPIErrorPattern matches the text of genai.APIError
+var flattenedAPIErrorPattern = regexp.MustCompile(`Error (\d{3}), Message: `)
+
+// flattenedAPIErrorCode reads the status code of a genai.APIError that only survived as text,
+// Files.Upload formats the error of the create file request with %s.
+func flattenedAPIErrorCode(err error) (int, bool) {
+	match := flattenedAPIErrorPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0, false
+	}
+	code, convErr := strconv.Atoi(match[1])
+	return code, convErr == nil
+}
+
+func isTransientStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusRequestTimeout || statusCode >= 500
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+func TestClassifyUpstreamError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"rate limit", genai.APIError{Code: 429}, true},
+		{"server error", fmt.Errorf("generate: %w", genai.APIError{Code: 503}), true},
+		{"bad request", genai.APIError{Code: 400}, false},
+		{"upload rate limit", fmt.Errorf("Failed to create file. Ran into an error: %s", genai.APIError{Code: 429, Message: "Resource has been exhausted"}), true},
+		{"upload bad request", fmt.Errorf("Failed to create file. Ran into an error: %s", genai.APIError{Code: 400, Message: "bad"}), false},
+		{"deadline", context.DeadlineExceeded, true},
+		{"cancelled", context.Canceled, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyUpstreamError(tt.err)
+			// the original error stays in the chain, APIError is not comparable so its text is checked
+			if errors.Is(err, ErrTransientUpstream) != tt.transient || !strings.Contains(err.Error(), tt.err.Error()) {
+				t.Fatalf("classified %v as %v", tt.err, err)
+			}
+			if IsPermanentFailure(err) {
+				t.Fatalf("%v must not be permanent", err)
+			}
+		})
+	}
+}
+
+func TestCheckNoPerson(t *testing.T) {
+	if err := checkNoPerson(&LLMResponse{Response: "NO_PERSON"}); !errors.Is(err, ErrNoPersonDetected) || !IsPermanentFailure(err) {
+		t.Fatalf("expected a permanent ErrNoPersonDetected, got %v", err)
+	}
+	if err := checkNoPerson(&LLMResponse{Images: [][]byte{{1}}}); err != nil {
+		t.Fatal(err)
+	}
+	var outputErr error = &StructuredOutputError{Operation: "identify", Reason: "invalid json"}
+	if !errors.Is(outputErr, ErrParseFailure) {
+		t.Fatal("StructuredOutputError must be a parse failure")
+	}
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrNoImageGenerated is returned by RequireImages when an image model answered without an image,
+// another model or attempt may do better.
+var ErrNoImageGenerated = errors.New("no image generated")
+
+// DefaultLLMFallbackChains is the order in which the models of each operation are tried, the first one is the
+// default model. LLM_FALLBACK_<OPERATION> replaces a chain for all companies, e.g.
+// LLM_FALLBACK_TRYON="gemini-2.5-flash-image-preview,seedream-4-0-250828", and Company.LLMFallbackChains per company.
+var DefaultLLMFallbackChains = map[string][]LLMModelName{
+	LLMOperationTryOn:                 {Flash25Image, Seedream40},
+	LLMOperationAvatar:                {Flash25Image, Seedream40},
+	LLMOperationPersonCharacteristics: {Pro25, Flash25},
+	LLMOperationIdentifyClothing:      {Pro25, Flash25},
+}
+
+// LLMFallbackChain returns the global chain of the operation, from LLM_FALLBACK_<OPERATION> when it is set.
+// Unknown model names in the variable are skipped.
+func LLMFallbackChain(operation string) []LLMModelName {
+	value := os.Getenv("LLM_FALLBACK_" + strings.ToUpper(operation))
+	if value == "" {
+		return DefaultLLMFallbackChains[operation]
+	}
+	var chain []LLMModelName
+	for _, name := range strings.Split(value, ",") {
+		model, ok := llmModelByName(strings.TrimSpace(name))
+		if !ok {
+			fmt.Printf("[LLM Fallback] Unknown model %q in LLM_FALLBACK_%s\n", name, strings.ToUpper(operation))
+			continue
+		}
+		chain = append(chain, model)
+	}
+	if len(chain) == 0 {
+		return DefaultLLMFallbackChains[operation]
+	}
+	return chain
+}
+
+// ValidateLLMFallbackChains checks company chains keyed by operation with the model ids of LLMModelName.
+// The models of a chain must all generate images or all text, like the default model of the operation.
+func ValidateLLMFallbackChains(chains map[string][]int32) error {
+	for operation, ids := range chains {
+		defaults, ok := DefaultLLMFallbackChains[operation]
+		if !ok {
+			return fmt.Errorf("unknown operation %q", operation)
+		}
+		for _, id := range ids {
+			model := LLMModelName(id)
+			if id < int32(Pro25) || model > Seedream40 {
+				return fmt.Errorf("unknown model %d for %s", id, operation)
+			}
+			if model.IsImageModel() != defaults[0].IsImageModel() {
+				return fmt.Errorf("%s can't be used for %s", model, operation)
+			}
+		}
+	}
+	return nil
+}
+
+// RequireImages turns an answer without images into ErrNoImageGenerated, pass it the result of an image call.
+func RequireImages(response *LLMResponse, err error) (*LLMResponse, error) {
+	if err == nil && (response == nil || len(response.Images) == 0) {
+		return response, ErrNoImageGenerated
+	}
+	return response, err
+}
+
+// CallWithFallback calls the models of the chain in order until one succeeds and returns the answer with the
+// model that gave it. Failures of the input stop the chain, another model can't fix a blocked or missing input.
+// An answer out of schema falls through, the next model may follow the schema.
+// The error of the last model tried is returned when all of them fail.
+func CallWithFallback(ctx context.Context, chain []LLMModelName, entityLog string, call func(model LLMModelName) (*LLMResponse, error)) (*LLMResponse, LLMModelName, error) {
+	if len(chain) == 0 {
+		return nil, 0, fmt.Errorf("no model to call")
+	}
+	var response *LLMResponse
+	var err error
+	for i, model := range chain {
+		response, err = call(model)
+		if err == nil {
+			if i > 0 {
+				fmt.Printf("[%s] [LLM Fallback] %s succeeded after %d failed models\n", entityLog, model, i)
+			}
+			return response, model, nil
+		}
+		if isInputFailure(err) || ctx.Err() != nil || i == len(chain)-1 {
+			return response, model, err
+		}
+		fmt.Printf("[%s] [LLM Fallback] %s failed, falling back to %s: %v\n", entityLog, model, chain[i+1], err)
+	}
+	return response, chain[len(chain)-1], err
+}
+
+// isInputFailure tells whether the failure comes from the input rather than the model, so no model of the chain can do better.
+func isInputFailure(err error) bool {
+	return errors.Is(err, ErrContentBlocked) ||
+		errors.Is(err, ErrNoPersonDetected) ||
+		errors.Is(err, ErrAssetMissing)
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCallWithFallback(t *testing.T) {
+	ctx := context.Background()
+	chain := []LLMModelName{Flash25Image, Seedream40}
+
+	var called []LLMModelName
+	response, model, err := CallWithFallback(ctx, chain, "test", func(model LLMModelName) (*LLMResponse, error) {
+		called = append(called, model)
+		if model == Flash25Image {
+			// an answer without an image falls through like an upstream error
+			return RequireImages(&LLMResponse{Response: "I can't draw that"}, nil)
+		}
+		return &LLMResponse{Images: [][]byte{{1}}}, nil
+	})
+	if err != nil || model != Seedream40 || len(response.Images) != 1 || len(called) != 2 {
+		t.Fatalf("expected the Seedream image, got %v, %v, %v after %v", response, model, err, called)
+	}
+
+	called = nil
+	_, model, err = CallWithFallback(ctx, chain, "test", func(model LLMModelName) (*LLMResponse, error) {
+		called = append(called, model)
+		return nil, fmt.Errorf("%w: nudity", ErrContentBlocked)
+	})
+	if !errors.Is(err, ErrContentBlocked) || model != Flash25Image || len(called) != 1 {
+		t.Fatalf("a permanent failure must stop the chain, got %v with %v after %v", err, model, called)
+	}
+
+	// an answer out of schema is the model's fault, the next model may answer properly
+	textChain := []LLMModelName{Pro25, Flash25}
+	called = nil
+	response, model, err = CallWithFallback(ctx, textChain, "test", func(model LLMModelName) (*LLMResponse, error) {
+		called = append(called, model)
+		if model == Pro25 {
+			return nil, fmt.Errorf("%w: unexpected end of JSON input", ErrParseFailure)
+		}
+		return &LLMResponse{Response: `{"name":"Shirt"}`}, nil
+	})
+	if err != nil || model != Flash25 || response == nil || len(called) != 2 {
+		t.Fatalf("expected the Flash answer after the parse failure, got %v, %v, %v after %v", response, model, err, called)
+	}
+	_, model, err = CallWithFallback(ctx, textChain, "test", func(model LLMModelName) (*LLMResponse, error) {
+		return nil, fmt.Errorf("%w: unexpected end of JSON input", ErrParseFailure)
+	})
+	// once every model failed the parse failure is permanent, the task is not retried
+	if !errors.Is(err, ErrParseFailure) || !IsPermanentFailure(err) || model != Flash25 {
+		t.Fatalf("expected the parse failure of the last model, got %v with %v", err, model)
+	}
+
+	_, model, err = CallWithFallback(ctx, chain, "test", func(model LLMModelName) (*LLMResponse, error) {
+		return nil, fmt.Errorf("%w: 503 from %s", ErrTransientUpstream, model)
+	})
+	if !errors.Is(err, ErrTransientUpstream) || model != Seedream40 {
+		t.Fatalf("expected the error of the last model, got %v with %v", err, model)
+	}
+}
+
+func TestLLMFallbackChain(t *testing.T) {
+	t.Setenv("LLM_FALLBACK_IDENTIFY_CLOTHING", "gemini-2.5-flash, gpt-5, gemini-2.5-pro")
+	chain := LLMFallbackChain(LLMOperationIdentifyClothing)
+	if len(chain) != 2 || chain[0] != Flash25 || chain[1] != Pro25 {
+		t.Fatalf("unexpected chain %v", chain)
+	}
+	if chain := LLMFallbackChain(LLMOperationTryOn); len(chain) != 2 || chain[0] != Flash25Image {
+		t.Fatalf("expected the default try on chain, got %v", chain)
+	}
+}
+
+func TestValidateLLMFallbackChains(t *testing.T) {
+	if err := ValidateLLMFallbackChains(map[string][]int32{LLMOperationTryOn: {int32(Seedream40), int32(Flash25Image)}}); err != nil {
+		t.Fatal(err)
+	}
+	invalid := []map[string][]int32{
+		{"translate": {int32(Pro25)}},
+		{LLMOperationTryOn: {int32(Pro25)}},
+		{LLMOperationIdentifyClothing: {42}},
+	}
+	for _, chains := range invalid {
+		if err := ValidateLLMFallbackChains(chains); err == nil {
+			t.Fatalf("expected an error for %v", chains)
+		}
+	}
+}
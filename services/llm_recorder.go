@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Modes of RecordingLLMProcessor, selected for the worker with LLM_RECORD_MODE
+const (
+	LLMRecordModeRecord = "record"
+	LLMRecordModeReplay = "replay"
+)
+
+// llmRecordAvatarWithCharacteristics keeps the two avatar calls apart, the ledger records both as LLMOperationAvatar
+const llmRecordAvatarWithCharacteristics = "avatar_with_characteristics"
+
+// ErrLLMRecordingNotFound is returned in replay mode for a request that was never recorded
+var ErrLLMRecordingNotFound = errors.New("no LLM recording for the request")
+
+// LLMRecordedRequest identifies a call: the same operation, model, prompt and input file contents
+// give the same Key, wherever the temp files are.
+type LLMRecordedRequest struct {
+	Operation      string           `json:"operation"`
+	Model          LLMModelName     `json:"model"`
+	Prompt         *RenderedPrompt  `json:"prompt,omitempty"`
+	InputHashes    []string         `json:"input_hashes"`
+	Scene          TryOnScene       `json:"scene,omitempty"`
+	Pose           TryOnPose        `json:"pose,omitempty"`
+	AspectRatio    TryOnAspectRatio `json:"aspect_ratio,omitempty"`
+	BackgroundHash string           `json:"background_hash,omitempty"`
+}
+
+func (r LLMRecordedRequest) Key() string {
+	encoded, _ := json.Marshal(r)
+	hash := sha256.Sum256(encoded)
+	return hex.EncodeToString(hash[:])
+}
+
+// LLMRecording is one stored call, the response or the error of the wrapped processor.
+type LLMRecording struct {
+	Request  LLMRecordedRequest `json:"request"`
+	Response *LLMResponse       `json:"response,omitempty"`
+	Error    string             `json:"error,omitempty"`
+	// ErrorKind keeps the failure kind of the error through a replay, e.g. content_blocked
+	ErrorKind string `json:"error_kind,omitempty"`
+}
+
+// RecordingLLMProcessor stores every call of the wrapped processor as a JSON file in dir (record mode)
+// or answers the calls from those files without calling anything (replay mode), e.g. for golden tests of
+// the task handlers and prompt changes in CI.
+type RecordingLLMProcessor struct {
+	next LLMProcessor
+	dir  string
+	mode string
+}
+
+// NewRecordingLLMProcessor wraps next, which may be nil in replay mode.
+func NewRecordingLLMProcessor(next LLMProcessor, dir string, mode string) (*RecordingLLMProcessor, error) {
+	if mode != LLMRecordModeRecord && mode != LLMRecordModeReplay {
+		return nil, fmt.Errorf("unknown LLM record mode %q", mode)
+	}
+	if mode == LLMRecordModeRecord && next == nil {
+		return nil, fmt.Errorf("recording needs a processor to record")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating LLM recordings dir %s: %w", dir, err)
+	}
+	return &RecordingLLMProcessor{next: next, dir: dir, mode: mode}, nil
+}
+
+// NewLLMRecorderFromEnv wraps next with a RecordingLLMProcessor when LLM_RECORD_MODE is set,
+// storing the recordings in LLM_RECORD_DIR (llm-recordings by default). Otherwise next is returned.
+func NewLLMRecorderFromEnv(next LLMProcessor) (LLMProcessor, error) {
+	mode := os.Getenv("LLM_RECORD_MODE")
+	if mode == "" {
+		return next, nil
+	}
+	return NewRecordingLLMProcessor(next, GetEnv("LLM_RECORD_DIR", "llm-recordings"), mode)
+}
+
+// Has forwards to the wrapped registry, any model is accepted when it is not one.
+func (p *RecordingLLMProcessor) Has(model LLMModelName) bool {
+	if checker, ok := p.next.(LLMModelChecker); ok {
+		return checker.Has(model)
+	}
+	return true
+}
+
+func (p *RecordingLLMProcessor) path(request LLMRecordedRequest) string {
+	return filepath.Join(p.dir, fmt.Sprintf("%s-%s.json", request.Operation, request.Key()[:16]))
+}
+
+func newLLMRecordedRequest(operation string, model LLMModelName, prompt *RenderedPrompt, inputPaths ...string) (LLMRecordedRequest, error) {
+	request := LLMRecordedRequest{Operation: operation, Model: model, Prompt: prompt, InputHashes: []string{}}
+	for _, inputPath := range inputPaths {
+		hash, err := fileContentHash(inputPath)
+		if err != nil {
+			return request, fmt.Errorf("error hashing LLM input %s: %w", inputPath, err)
+		}
+		request.InputHashes = append(request.InputHashes, hash)
+	}
+	return request, nil
+}
+
+// do replays the recording of the request or records the result of call.
+func (p *RecordingLLMProcessor) do(request LLMRecordedRequest, call func() (*LLMResponse, error)) (*LLMResponse, error) {
+	path := p.path(request)
+	if p.mode == LLMRecordModeReplay {
+		content, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s %s (%s)", ErrLLMRecordingNotFound, request.Operation, request.Model, path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading LLM recording %s: %w", path, err)
+		}
+		var recording LLMRecording
+		if err := json.Unmarshal(content, &recording); err != nil {
+			return nil, fmt.Errorf("error decoding LLM recording %s: %w", path, err)
+		}
+		if recording.Error != "" {
+			if kind, ok := llmFailureKinds[recording.ErrorKind]; ok {
+				return recording.Response, &kindError{message: recording.Error, kind: kind}
+			}
+			return recording.Response, errors.New(recording.Error)
+		}
+		return recording.Response, nil
+	}
+
+	response, callErr := call()
+	recording := LLMRecording{Request: request, Response: response}
+	if callErr != nil {
+		recording.Error = callErr.Error()
+		recording.ErrorKind = llmFailureKindName(callErr)
+	}
+	content, err := json.MarshalIndent(recording, "", "  ")
+	if err == nil {
+		err = os.WriteFile(path, content, 0o644)
+	}
+	if err != nil {
+		// a failed recording must not fail the call
+		fmt.Printf("[LLM Recorder] Error on saving %s recording %s: %v\n", request.Operation, path, err)
+	}
+	return response, callErr
+}
+
+func (p *RecordingLLMProcessor) ProcessAvatarTaskWithCharacteristics(ctx context.Context, personAvatarPath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	request, err := newLLMRecordedRequest(llmRecordAvatarWithCharacteristics, modelName, prompt, personAvatarPath)
+	if err != nil {
+		return nil, err
+	}
+	return p.do(request, func() (*LLMResponse, error) {
+		return p.next.ProcessAvatarTaskWithCharacteristics(ctx, personAvatarPath, prompt, modelName)
+	})
+}
+
+func (p *RecordingLLMProcessor) GenerateTryOn(ctx context.Context, personAvatarPath string, filePaths []string, options TryOnOptions, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	request, err := newLLMRecordedRequest(LLMOperationTryOn, modelName, prompt, append([]string{personAvatarPath}, filePaths...)...)
+	if err != nil {
+		return nil, err
+	}
+	request.Scene, request.Pose, request.AspectRatio = options.Scene, options.Pose, options.AspectRatio
+	if options.BackgroundImagePath != "" {
+		if request.BackgroundHash, err = fileContentHash(options.BackgroundImagePath); err != nil {
+			return nil, fmt.Errorf("error hashing LLM input %s: %w", options.BackgroundImagePath, err)
+		}
+	}
+	return p.do(request, func() (*LLMResponse, error) {
+		return p.next.GenerateTryOn(ctx, personAvatarPath, filePaths, options, prompt, modelName)
+	})
+}
+
+func (p *RecordingLLMProcessor) AnalyzePersonCharacteristics(ctx context.Context, imagePath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	request, err := newLLMRecordedRequest(LLMOperationPersonCharacteristics, modelName, prompt, imagePath)
+	if err != nil {
+		return nil, err
+	}
+	return p.do(request, func() (*LLMResponse, error) {
+		return p.next.AnalyzePersonCharacteristics(ctx, imagePath, prompt, modelName)
+	})
+}
+
+func (p *RecordingLLMProcessor) IdentifyClothing(ctx context.Context, clothingImagePath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	request, err := newLLMRecordedRequest(LLMOperationIdentifyClothing, modelName, prompt, clothingImagePath)
+	if err != nil {
+		return nil, err
+	}
+	return p.do(request, func() (*LLMResponse, error) {
+		return p.next.IdentifyClothing(ctx, clothingImagePath, prompt, modelName)
+	})
+}
+
+var _ LLMProcessor = (*RecordingLLMProcessor)(nil)
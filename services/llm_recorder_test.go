@@ -0,0 +1,88 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type failingLLMProcessor struct {
+	OfflineLLMProcessor
+}
+
+func (p *failingLLMProcessor) IdentifyClothing(ctx context.Context, clothingImagePath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	return nil, fmt.Errorf("%w: nudity", ErrContentBlocked)
+}
+
+func TestRecordingLLMProcessorRoundtrip(t *testing.T) {
+	ctx := context.Background()
+	recordings := t.TempDir()
+	inputs := t.TempDir()
+	avatarPath := writeTestPNG(t, inputs, "avatar.png", 30, 60, color.RGBA{R: 200, A: 255})
+	garmentPath := writeTestPNG(t, inputs, "garment.png", 10, 10, color.RGBA{B: 200, A: 255})
+	prompt := &RenderedPrompt{Name: "tryon", Version: "v1", User: "Dress the person"}
+
+	recorder, err := NewRecordingLLMProcessor(&OfflineLLMProcessor{}, recordings, LLMRecordModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := recorder.GenerateTryOn(ctx, avatarPath, []string{garmentPath}, TryOnOptions{Scene: SceneStudioWhite}, prompt, Flash25Image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordedIdentification, err := recorder.IdentifyClothing(ctx, garmentPath, prompt, Pro25)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the replay is keyed by content, the inputs are new temp files in a real task
+	moved := t.TempDir()
+	for _, name := range []string{"avatar.png", "garment.png"} {
+		content, _ := os.ReadFile(filepath.Join(inputs, name))
+		if err := os.WriteFile(filepath.Join(moved, "copy-"+name), content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	replayer, err := NewRecordingLLMProcessor(nil, recordings, LLMRecordModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := replayer.GenerateTryOn(ctx, filepath.Join(moved, "copy-avatar.png"), []string{filepath.Join(moved, "copy-garment.png")}, TryOnOptions{Scene: SceneStudioWhite}, prompt, Flash25Image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayed.Images) != 1 || !bytes.Equal(replayed.Images[0], recorded.Images[0]) {
+		t.Fatal("replayed try-on differs from the recorded one")
+	}
+	replayedIdentification, err := replayer.IdentifyClothing(ctx, filepath.Join(moved, "copy-garment.png"), prompt, Pro25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayedIdentification.Identification.Name != recordedIdentification.Identification.Name {
+		t.Fatalf("replayed identification %+v", replayedIdentification.Identification)
+	}
+
+	// a prompt change is a new request
+	changed := *prompt
+	changed.Version = "v2"
+	if _, err := replayer.IdentifyClothing(ctx, garmentPath, &changed, Pro25); !errors.Is(err, ErrLLMRecordingNotFound) {
+		t.Fatalf("expected ErrLLMRecordingNotFound, got %v", err)
+	}
+
+	// errors are replayed too
+	failing, err := NewRecordingLLMProcessor(&failingLLMProcessor{}, recordings, LLMRecordModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := failing.IdentifyClothing(ctx, avatarPath, prompt, Pro25); err == nil {
+		t.Fatal("expected the recorded error")
+	}
+	if _, err := replayer.IdentifyClothing(ctx, avatarPath, prompt, Pro25); !errors.Is(err, ErrContentBlocked) || err.Error() != "content violation: nudity" {
+		t.Fatalf("expected the replayed error, got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// IsImageModel tells whether the model generates images, text operations (identify, characteristics) can't use it.
+func (t LLMModelName) IsImageModel() bool {
+	return t == Flash25Image || t == Seedream40
+}
+
+// LLMModelChecker is implemented by processors that only serve some models, see LLMProviderRegistry.Has.
+type LLMModelChecker interface {
+	Has(model LLMModelName) bool
+}
+
+// LLMProviderRegistry maps every model to the backend that serves it and routes the LLMProcessor calls by model.
+// Models without a registered backend go to the fallback backend.
+type LLMProviderRegistry struct {
+	providers map[LLMModelName]LLMProcessor
+	fallback  LLMProcessor
+}
+
+func NewLLMProviderRegistry(fallback LLMProcessor) *LLMProviderRegistry {
+	return &LLMProviderRegistry{providers: map[LLMModelName]LLMProcessor{}, fallback: fallback}
+}
+
+// NewDefaultLLMProviderRegistry registers the Gemini models on Google and Seedream on its OpenAI compatible API
+// when SEEDREAM_API_KEY is set. SEEDREAM_BASE_URL points it to another server, e.g. a local stub.
+// With LLM_PROVIDER=offline every model is served by OfflineLLMProcessor for local development.
+func NewDefaultLLMProviderRegistry() *LLMProviderRegistry {
+	if os.Getenv("LLM_PROVIDER") == LLMProviderOffline {
+		offline := NewOfflineLLMProcessor()
+		registry := NewLLMProviderRegistry(offline)
+		for _, model := range []LLMModelName{Pro25, Flash25, FlashLite25, Flash20, Flash25Image, Seedream40} {
+			registry.Register(model, offline)
+		}
+		return registry
+	}
+	google := NewGoogleLLMProcessor()
+	registry := NewLLMProviderRegistry(google)
+	for _, model := range []LLMModelName{Pro25, Flash25, FlashLite25, Flash20, Flash25Image} {
+		registry.Register(model, google)
+	}
+	if apiKey := os.Getenv("SEEDREAM_API_KEY"); apiKey != "" {
+		baseURL := GetEnv("SEEDREAM_BASE_URL", "https://ark.ap-southeast.bytepluses.com/api/v3")
+		registry.Register(Seedream40, NewOpenAICompatibleProcessor(baseURL, apiKey))
+	}
+	return registry
+}
+
+func (r *LLMProviderRegistry) Register(model LLMModelName, processor LLMProcessor) {
+	r.providers[model] = processor
+}
+
+// Has tells whether a backend was registered for the model.
+func (r *LLMProviderRegistry) Has(model LLMModelName) bool {
+	_, ok := r.providers[model]
+	return ok
+}
+
+// ProcessorFor returns the backend of the model, the fallback for models without one.
+func (r *LLMProviderRegistry) ProcessorFor(model LLMModelName) (LLMProcessor, error) {
+	if processor, ok := r.providers[model]; ok {
+		return processor, nil
+	}
+	if r.fallback != nil {
+		return r.fallback, nil
+	}
+	return nil, fmt.Errorf("no LLM backend registered for model %s", model)
+}
+
+func (r *LLMProviderRegistry) ProcessAvatarTaskWithCharacteristics(ctx context.Context, personAvatarPath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	processor, err := r.ProcessorFor(modelName)
+	if err != nil {
+		return nil, err
+	}
+	return processor.ProcessAvatarTaskWithCharacteristics(ctx, personAvatarPath, prompt, modelName)
+}
+
+func (r *LLMProviderRegistry) GenerateTryOn(ctx context.Context, personAvatarPath string, filePaths []string, options TryOnOptions, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	processor, err := r.ProcessorFor(modelName)
+	if err != nil {
+		return nil, err
+	}
+	return processor.GenerateTryOn(ctx, personAvatarPath, filePaths, options, prompt, modelName)
+}
+
+func (r *LLMProviderRegistry) AnalyzePersonCharacteristics(ctx context.Context, imagePath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	processor, err := r.ProcessorFor(modelName)
+	if err != nil {
+		return nil, err
+	}
+	return processor.AnalyzePersonCharacteristics(ctx, imagePath, prompt, modelName)
+}
+
+func (r *LLMProviderRegistry) IdentifyClothing(ctx context.Context, clothingImagePath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	processor, err := r.ProcessorFor(modelName)
+	if err != nil {
+		return nil, err
+	}
+	return processor.IdentifyClothing(ctx, clothingImagePath, prompt, modelName)
+}
+
+var _ LLMProcessor = (*LLMProviderRegistry)(nil)
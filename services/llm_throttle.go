@@ -0,0 +1,294 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrLLMUnavailable is returned without calling the model while its circuit is open or its rate limit
+// needs a longer wait than the call may block. The worker re-queues such tasks, see LLMUnavailableError.RetryAfter.
+var ErrLLMUnavailable = errors.New("model temporarily unavailable")
+
+type LLMUnavailableError struct {
+	Model      LLMModelName
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *LLMUnavailableError) Error() string {
+	return fmt.Sprintf("%s %s: %s, retry after %s", ErrLLMUnavailable, e.Model, e.Reason, e.RetryAfter)
+}
+
+func (e *LLMUnavailableError) Is(target error) bool {
+	return target == ErrLLMUnavailable
+}
+
+// LLMRateLimit is the request quota of a model shared by all workers
+type LLMRateLimit struct {
+	PerMinute int
+	Burst     int
+}
+
+// DefaultLLMRateLimits follow the Gemini API quotas of the project, models missing here are not limited.
+// LLM_RATE_LIMITS overrides them, e.g. "gemini-2.5-pro=150,gemini-2.5-flash-image-preview=300".
+var DefaultLLMRateLimits = map[LLMModelName]LLMRateLimit{
+	Pro25:        {PerMinute: 150, Burst: 20},
+	Flash25:      {PerMinute: 1000, Burst: 50},
+	FlashLite25:  {PerMinute: 4000, Burst: 100},
+	Flash20:      {PerMinute: 2000, Burst: 100},
+	Flash25Image: {PerMinute: 500, Burst: 20},
+}
+
+// LLMRateLimitsFromEnv returns DefaultLLMRateLimits with the overrides of LLM_RATE_LIMITS.
+func LLMRateLimitsFromEnv() (map[LLMModelName]LLMRateLimit, error) {
+	limits := map[LLMModelName]LLMRateLimit{}
+	for model, limit := range DefaultLLMRateLimits {
+		limits[model] = limit
+	}
+	value := os.Getenv("LLM_RATE_LIMITS")
+	if value == "" {
+		return limits, nil
+	}
+	for _, entry := range strings.Split(value, ",") {
+		name, perMinute, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		rpm, err := strconv.Atoi(perMinute)
+		if !ok || err != nil || rpm <= 0 {
+			return nil, fmt.Errorf("invalid LLM_RATE_LIMITS entry %q, expected model=requests per minute", entry)
+		}
+		model, ok := llmModelByName(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown model %q in LLM_RATE_LIMITS", name)
+		}
+		// a burst of a tenth of the minute keeps short spikes from tripping the quota
+		limits[model] = LLMRateLimit{PerMinute: rpm, Burst: max(rpm/10, 1)}
+	}
+	return limits, nil
+}
+
+func llmModelByName(name string) (LLMModelName, bool) {
+	for model := Pro25; model <= Seedream40; model++ {
+		if model.String() == name {
+			return model, true
+		}
+	}
+	return 0, false
+}
+
+// LLMRateLimiter hands out the request quota of the models.
+type LLMRateLimiter interface {
+	// Reserve takes a request of the model. It returns zero when the request may go now,
+	// otherwise how long to wait before asking again.
+	Reserve(ctx context.Context, model LLMModelName) (time.Duration, error)
+}
+
+// LLMCircuitBreaker stops calls to a model after repeated upstream failures.
+type LLMCircuitBreaker interface {
+	// OpenFor returns how long the circuit of the model stays open, zero when it is closed.
+	OpenFor(ctx context.Context, model LLMModelName) (time.Duration, error)
+	// Record counts the outcome of a call, failed is a rate limit, 5xx or timeout of the model API.
+	Record(ctx context.Context, model LLMModelName, failed bool) error
+}
+
+// tokenBucketScript refills the bucket by the time passed on the Redis clock and takes one token.
+// It returns 0 when a token was taken, otherwise the milliseconds until the next one.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate) + 1000)
+return wait
+`)
+
+// RedisLLMRateLimiter is a token bucket per model in Redis, shared by every worker on the same Redis.
+type RedisLLMRateLimiter struct {
+	client redis.UniversalClient
+	limits map[LLMModelName]LLMRateLimit
+}
+
+func NewRedisLLMRateLimiter(client redis.UniversalClient, limits map[LLMModelName]LLMRateLimit) *RedisLLMRateLimiter {
+	return &RedisLLMRateLimiter{client: client, limits: limits}
+}
+
+func (l *RedisLLMRateLimiter) Reserve(ctx context.Context, model LLMModelName) (time.Duration, error) {
+	limit, ok := l.limits[model]
+	if !ok || limit.PerMinute <= 0 {
+		return 0, nil
+	}
+	perMillisecond := float64(limit.PerMinute) / float64(time.Minute/time.Millisecond)
+	wait, err := tokenBucketScript.Run(ctx, l.client, []string{"llm:bucket:" + model.String()}, perMillisecond, max(limit.Burst, 1)).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
+// Circuit breaker settings: LLMCircuitFailures failures within LLMCircuitWindow open the circuit for LLMCircuitCooldown
+const (
+	LLMCircuitFailures = 5
+	LLMCircuitWindow   = time.Minute
+	LLMCircuitCooldown = 30 * time.Second
+)
+
+// circuitFailureScript counts a failure in the window and opens the circuit at the threshold.
+var circuitFailureScript = redis.NewScript(`
+local failures = redis.call("INCR", KEYS[1])
+if failures == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+if failures >= tonumber(ARGV[2]) then
+	redis.call("SET", KEYS[2], "1", "PX", ARGV[3])
+	redis.call("DEL", KEYS[1])
+	return 1
+end
+return 0
+`)
+
+// RedisLLMCircuitBreaker keeps the circuit of every model in Redis, so all workers stop together.
+// After the cooldown the next calls go through again, a success resets the failure count.
+type RedisLLMCircuitBreaker struct {
+	client redis.UniversalClient
+}
+
+func NewRedisLLMCircuitBreaker(client redis.UniversalClient) *RedisLLMCircuitBreaker {
+	return &RedisLLMCircuitBreaker{client: client}
+}
+
+func circuitKeys(model LLMModelName) (failures string, open string) {
+	return "llm:circuit:" + model.String() + ":failures", "llm:circuit:" + model.String() + ":open"
+}
+
+func (b *RedisLLMCircuitBreaker) OpenFor(ctx context.Context, model LLMModelName) (time.Duration, error) {
+	_, openKey := circuitKeys(model)
+	ttl, err := b.client.PTTL(ctx, openKey).Result()
+	if err != nil {
+		return 0, err
+	}
+	// negative values mean the key does not exist or has no expiry
+	return max(ttl, 0), nil
+}
+
+func (b *RedisLLMCircuitBreaker) Record(ctx context.Context, model LLMModelName, failed bool) error {
+	failuresKey, openKey := circuitKeys(model)
+	if !failed {
+		return b.client.Del(ctx, failuresKey).Err()
+	}
+	opened, err := circuitFailureScript.Run(ctx, b.client, []string{failuresKey, openKey},
+		LLMCircuitWindow.Milliseconds(), LLMCircuitFailures, LLMCircuitCooldown.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if opened == 1 {
+		fmt.Printf("[LLM Throttle] Circuit of %s opened for %s after %d upstream failures\n", model, LLMCircuitCooldown, LLMCircuitFailures)
+	}
+	return nil
+}
+
+// ThrottledLLMProcessor takes a token of the model before every call and skips the call while the circuit
+// of the model is open. Waits up to MaxWait block the call, longer ones return an LLMUnavailableError.
+// Redis errors let the call through, the quota of the API still applies.
+type ThrottledLLMProcessor struct {
+	next    LLMProcessor
+	limiter LLMRateLimiter
+	breaker LLMCircuitBreaker
+	MaxWait time.Duration
+}
+
+func NewThrottledLLMProcessor(next LLMProcessor, limiter LLMRateLimiter, breaker LLMCircuitBreaker) *ThrottledLLMProcessor {
+	return &ThrottledLLMProcessor{next: next, limiter: limiter, breaker: breaker, MaxWait: 10 * time.Second}
+}
+
+// Has forwards to the wrapped registry, any model is accepted when it is not one.
+func (p *ThrottledLLMProcessor) Has(model LLMModelName) bool {
+	if checker, ok := p.next.(LLMModelChecker); ok {
+		return checker.Has(model)
+	}
+	return true
+}
+
+func (p *ThrottledLLMProcessor) acquire(ctx context.Context, model LLMModelName) error {
+	openFor, err := p.breaker.OpenFor(ctx, model)
+	if err != nil {
+		fmt.Printf("[LLM Throttle] Error on reading the circuit of %s: %v\n", model, err)
+	} else if openFor > 0 {
+		return &LLMUnavailableError{Model: model, Reason: "circuit open", RetryAfter: openFor}
+	}
+	for {
+		wait, err := p.limiter.Reserve(ctx, model)
+		if err != nil {
+			fmt.Printf("[LLM Throttle] Error on reserving a request of %s: %v\n", model, err)
+			return nil
+		}
+		if wait == 0 {
+			return nil
+		}
+		if wait > p.MaxWait {
+			return &LLMUnavailableError{Model: model, Reason: "rate limited", RetryAfter: wait}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (p *ThrottledLLMProcessor) call(ctx context.Context, model LLMModelName, fn func() (*LLMResponse, error)) (*LLMResponse, error) {
+	if err := p.acquire(ctx, model); err != nil {
+		return nil, err
+	}
+	response, err := fn()
+	// only the API being overloaded or down counts, blocked content and bad answers don't
+	if recordErr := p.breaker.Record(ctx, model, errors.Is(err, ErrTransientUpstream)); recordErr != nil {
+		fmt.Printf("[LLM Throttle] Error on recording the call of %s: %v\n", model, recordErr)
+	}
+	return response, err
+}
+
+func (p *ThrottledLLMProcessor) ProcessAvatarTaskWithCharacteristics(ctx context.Context, personAvatarPath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	return p.call(ctx, modelName, func() (*LLMResponse, error) {
+		return p.next.ProcessAvatarTaskWithCharacteristics(ctx, personAvatarPath, prompt, modelName)
+	})
+}
+
+func (p *ThrottledLLMProcessor) GenerateTryOn(ctx context.Context, personAvatarPath string, filePaths []string, options TryOnOptions, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	return p.call(ctx, modelName, func() (*LLMResponse, error) {
+		return p.next.GenerateTryOn(ctx, personAvatarPath, filePaths, options, prompt, modelName)
+	})
+}
+
+func (p *ThrottledLLMProcessor) AnalyzePersonCharacteristics(ctx context.Context, imagePath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	return p.call(ctx, modelName, func() (*LLMResponse, error) {
+		return p.next.AnalyzePersonCharacteristics(ctx, imagePath, prompt, modelName)
+	})
+}
+
+func (p *ThrottledLLMProcessor) IdentifyClothing(ctx context.Context, clothingImagePath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	return p.call(ctx, modelName, func() (*LLMResponse, error) {
+		return p.next.IdentifyClothing(ctx, clothingImagePath, prompt, modelName)
+	})
+}
+
+var _ LLMProcessor = (*ThrottledLLMProcessor)(nil)
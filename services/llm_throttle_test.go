@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type overloadedLLMProcessor struct {
+	OfflineLLMProcessor
+	calls int
+}
+
+func (p *overloadedLLMProcessor) IdentifyClothing(ctx context.Context, clothingImagePath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	p.calls++
+	return nil, fmt.Errorf("%w: 429 resource exhausted", ErrTransientUpstream)
+}
+
+// memoryLLMThrottle is an in process LLMRateLimiter and LLMCircuitBreaker with the Redis thresholds
+type memoryLLMThrottle struct {
+	waits    []time.Duration
+	failures int
+	openFor  time.Duration
+}
+
+func (m *memoryLLMThrottle) Reserve(ctx context.Context, model LLMModelName) (time.Duration, error) {
+	if len(m.waits) == 0 {
+		return 0, nil
+	}
+	wait := m.waits[0]
+	m.waits = m.waits[1:]
+	return wait, nil
+}
+
+func (m *memoryLLMThrottle) OpenFor(ctx context.Context, model LLMModelName) (time.Duration, error) {
+	return m.openFor, nil
+}
+
+func (m *memoryLLMThrottle) Record(ctx context.Context, model LLMModelName, failed bool) error {
+	if !failed {
+		m.failures = 0
+		return nil
+	}
+	m.failures++
+	if m.failures >= LLMCircuitFailures {
+		m.openFor = LLMCircuitCooldown
+		m.failures = 0
+	}
+	return nil
+}
+
+func TestThrottledLLMProcessorOpensCircuit(t *testing.T) {
+	ctx := context.Background()
+	upstream := &overloadedLLMProcessor{}
+	throttle := &memoryLLMThrottle{}
+	processor := NewThrottledLLMProcessor(upstream, throttle, throttle)
+
+	for i := 0; i < LLMCircuitFailures; i++ {
+		if _, err := processor.IdentifyClothing(ctx, "clothing.png", nil, Flash25); !errors.Is(err, ErrTransientUpstream) {
+			t.Fatalf("call %d: expected the upstream error, got %v", i, err)
+		}
+	}
+	_, err := processor.IdentifyClothing(ctx, "clothing.png", nil, Flash25)
+	var unavailable *LLMUnavailableError
+	if !errors.As(err, &unavailable) || !errors.Is(err, ErrLLMUnavailable) {
+		t.Fatalf("expected the open circuit, got %v", err)
+	}
+	if unavailable.RetryAfter != LLMCircuitCooldown || upstream.calls != LLMCircuitFailures {
+		t.Fatalf("retry after %s with %d calls", unavailable.RetryAfter, upstream.calls)
+	}
+	if IsPermanentFailure(err) {
+		t.Fatal("an open circuit must not be permanent")
+	}
+}
+
+func TestThrottledLLMProcessorRateLimit(t *testing.T) {
+	ctx := context.Background()
+	throttle := &memoryLLMThrottle{waits: []time.Duration{5 * time.Millisecond}}
+	processor := NewThrottledLLMProcessor(&OfflineLLMProcessor{}, throttle, throttle)
+
+	// a short wait blocks the call, then it goes through
+	response, err := processor.IdentifyClothing(ctx, "clothing.png", nil, Flash25)
+	if err != nil || response.Identification == nil {
+		t.Fatalf("expected the identification, got %v, %v", response, err)
+	}
+
+	throttle.waits = []time.Duration{time.Minute}
+	_, err = processor.IdentifyClothing(ctx, "clothing.png", nil, Flash25)
+	var unavailable *LLMUnavailableError
+	if !errors.As(err, &unavailable) || unavailable.RetryAfter != time.Minute {
+		t.Fatalf("expected a re-queue after a minute, got %v", err)
+	}
+}
+
+func TestLLMRateLimitsFromEnv(t *testing.T) {
+	t.Setenv("LLM_RATE_LIMITS", "gemini-2.5-pro=60")
+	limits, err := LLMRateLimitsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits[Pro25] != (LLMRateLimit{PerMinute: 60, Burst: 6}) || limits[Flash25] != DefaultLLMRateLimits[Flash25] {
+		t.Fatalf("unexpected limits %v", limits)
+	}
+	t.Setenv("LLM_RATE_LIMITS", "gpt-5=60")
+	if _, err := LLMRateLimitsFromEnv(); err == nil {
+		t.Fatal("expected an error for an unknown model")
+	}
+}
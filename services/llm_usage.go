@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"letryapi/models"
+
+	"github.com/getsentry/sentry-go"
+	"gorm.io/gorm"
+)
+
+// Operations recorded in the LLMUsage ledger
+const (
+	LLMOperationTryOn                 = "tryon"
+	LLMOperationAvatar                = "avatar"
+	LLMOperationPersonCharacteristics = "person_characteristics"
+	LLMOperationIdentifyClothing      = "identify_clothing"
+)
+
+// LLMPrice is the list price of a model in USD. Thoughts are billed as output tokens,
+// PerImage is for backends that bill generated images instead of tokens.
+type LLMPrice struct {
+	InputPerMillion  float64
+	OutputPerMillion float64
+	PerImage         float64
+}
+
+// LLMPrices is the price table used for LLMUsage.CostUSD, models missing here are recorded with a zero cost.
+var LLMPrices = map[LLMModelName]LLMPrice{
+	Pro25:        {InputPerMillion: 1.25, OutputPerMillion: 10},
+	Flash25:      {InputPerMillion: 0.30, OutputPerMillion: 2.50},
+	FlashLite25:  {InputPerMillion: 0.10, OutputPerMillion: 0.40},
+	Flash20:      {InputPerMillion: 0.10, OutputPerMillion: 0.40},
+	Flash25Image: {InputPerMillion: 0.30, OutputPerMillion: 30},
+	Seedream40:   {PerImage: 0.03},
+}
+
+// LLMCostUSD computes the cost of one call from the price table, test responses are free.
+func LLMCostUSD(model LLMModelName, response *LLMResponse) float64 {
+	if response == nil || response.IsTest {
+		return 0
+	}
+	price := LLMPrices[model]
+	return float64(response.InputTokenCount)*price.InputPerMillion/1e6 +
+		float64(response.OutputTokenCount+response.ThoughtsTokenCount)*price.OutputPerMillion/1e6 +
+		float64(len(response.Images))*price.PerImage
+}
+
+// LLMUsageScope tells the ledger who a call is made for.
+type LLMUsageScope struct {
+	CompanyID *uint
+	UserID    *uint
+	EntityID  *uint
+}
+
+type llmUsageScopeKey struct{}
+
+// WithLLMUsageScope attaches the company, user and entity of a task to ctx for MeteredLLMProcessor.
+func WithLLMUsageScope(ctx context.Context, scope LLMUsageScope) context.Context {
+	return context.WithValue(ctx, llmUsageScopeKey{}, scope)
+}
+
+func llmUsageScope(ctx context.Context) LLMUsageScope {
+	scope, _ := ctx.Value(llmUsageScopeKey{}).(LLMUsageScope)
+	return scope
+}
+
+// MeteredLLMProcessor appends an LLMUsage row for every call it passes to the wrapped processor,
+// failed calls included.
+type MeteredLLMProcessor struct {
+	next LLMProcessor
+	db   *gorm.DB
+	now  func() time.Time
+	// OnRecord is called after a usage row was saved, e.g. to check the budget of the company
+	OnRecord func(usage models.LLMUsage)
+}
+
+func NewMeteredLLMProcessor(next LLMProcessor, db *gorm.DB) *MeteredLLMProcessor {
+	return &MeteredLLMProcessor{next: next, db: db, now: time.Now}
+}
+
+// Has forwards to the wrapped registry, any model is accepted when it is not one.
+func (m *MeteredLLMProcessor) Has(model LLMModelName) bool {
+	if checker, ok := m.next.(LLMModelChecker); ok {
+		return checker.Has(model)
+	}
+	return true
+}
+
+func (m *MeteredLLMProcessor) record(ctx context.Context, operation string, model LLMModelName, started time.Time, response *LLMResponse, callErr error) {
+	if response == nil && callErr == nil || errors.Is(callErr, ErrLLMUnavailable) {
+		// nothing was sent to a model, e.g. a throttled call
+		return
+	}
+	scope := llmUsageScope(ctx)
+	usage := models.LLMUsage{
+		CompanyID:     scope.CompanyID,
+		UserAccountID: scope.UserID,
+		EntityID:      scope.EntityID,
+		Operation:     operation,
+		Model:         model.String(),
+		LatencyMs:     m.now().Sub(started).Milliseconds(),
+		Success:       callErr == nil,
+		CostUSD:       LLMCostUSD(model, response),
+	}
+	if response != nil {
+		usage.InputTokenCount = response.InputTokenCount
+		usage.OutputTokenCount = response.OutputTokenCount
+		usage.ThoughtsTokenCount = response.ThoughtsTokenCount
+		usage.TotalTokenCount = response.TotalTokenCount
+		usage.ImageCount = len(response.Images)
+	}
+	if callErr != nil {
+		usage.ErrorMessage = StrPointer(callErr.Error())
+	}
+	// the ledger must not fail the call, the task already has its result
+	if err := m.db.Create(&usage).Error; err != nil {
+		fmt.Printf("[LLM Usage] Error on saving %s usage of %s: %v\n", operation, model, err)
+		sentry.CaptureException(fmt.Errorf("[LLM Usage] Error on saving %s usage of %s: %v", operation, model, err))
+		return
+	}
+	if m.OnRecord != nil {
+		m.OnRecord(usage)
+	}
+}
+
+func (m *MeteredLLMProcessor) ProcessAvatarTaskWithCharacteristics(ctx context.Context, personAvatarPath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	started := m.now()
+	response, err := m.next.ProcessAvatarTaskWithCharacteristics(ctx, personAvatarPath, prompt, modelName)
+	m.record(ctx, LLMOperationAvatar, modelName, started, response, err)
+	return response, err
+}
+
+func (m *MeteredLLMProcessor) GenerateTryOn(ctx context.Context, personAvatarPath string, filePaths []string, options TryOnOptions, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	started := m.now()
+	response, err := m.next.GenerateTryOn(ctx, personAvatarPath, filePaths, options, prompt, modelName)
+	m.record(ctx, LLMOperationTryOn, modelName, started, response, err)
+	return response, err
+}
+
+func (m *MeteredLLMProcessor) AnalyzePersonCharacteristics(ctx context.Context, imagePath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	started := m.now()
+	response, err := m.next.AnalyzePersonCharacteristics(ctx, imagePath, prompt, modelName)
+	m.record(ctx, LLMOperationPersonCharacteristics, modelName, started, response, err)
+	return response, err
+}
+
+func (m *MeteredLLMProcessor) IdentifyClothing(ctx context.Context, clothingImagePath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	started := m.now()
+	response, err := m.next.IdentifyClothing(ctx, clothingImagePath, prompt, modelName)
+	m.record(ctx, LLMOperationIdentifyClothing, modelName, started, response, err)
+	return response, err
+}
+
+var _ LLMProcessor = (*MeteredLLMProcessor)(nil)
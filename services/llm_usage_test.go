@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestLLMCostUSD(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    LLMModelName
+		response *LLMResponse
+		want     float64
+	}{
+		{"image tokens", Flash25Image, &LLMResponse{InputTokenCount: 1000, OutputTokenCount: 1290, Images: [][]byte{{1}}}, 0.0003 + 0.0387},
+		{"thoughts are output", Pro25, &LLMResponse{InputTokenCount: 2000, OutputTokenCount: 100, ThoughtsTokenCount: 900}, 0.0025 + 0.01},
+		{"per image", Seedream40, &LLMResponse{OutputTokenCount: 16384, Images: [][]byte{{1}, {2}}}, 0.06},
+		{"failed call", Flash25Image, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LLMCostUSD(tt.model, tt.response); math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("expected %f, got %f", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMeteredLLMProcessorHas(t *testing.T) {
+	registry := NewLLMProviderRegistry(nil)
+	registry.Register(Seedream40, NewOpenAICompatibleProcessor("http://localhost", "key"))
+	metered := NewMeteredLLMProcessor(registry, nil)
+	if !metered.Has(Seedream40) || metered.Has(Flash25Image) {
+		t.Fatalf("expected Has to be answered by the registry")
+	}
+	// calls that never reach a model are not recorded, the nil db is not touched
+	throttled := NewMeteredLLMProcessor(&unavailableLLMProcessor{}, nil)
+	if _, err := throttled.IdentifyClothing(WithLLMUsageScope(context.Background(), LLMUsageScope{}), "", nil, Flash25); !errors.Is(err, ErrLLMUnavailable) {
+		t.Fatalf("expected ErrLLMUnavailable, got %v", err)
+	}
+}
+
+// unavailableLLMProcessor answers like a throttled backend that didn't send anything
+type unavailableLLMProcessor struct {
+	OfflineLLMProcessor
+}
+
+func (*unavailableLLMProcessor) IdentifyClothing(ctx context.Context, clothingImagePath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	return nil, fmt.Errorf("%w: circuit open for %s", ErrLLMUnavailable, modelName)
+}
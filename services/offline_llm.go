@@ -0,0 +1,153 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/disintegration/imaging"
+)
+
+// LLMProviderOffline is the LLM_PROVIDER value that serves every model with OfflineLLMProcessor
+const LLMProviderOffline = "offline"
+
+// Canned answers of OfflineLLMProcessor, a file with the same name in LLM_OFFLINE_FIXTURES_DIR replaces them
+const (
+	offlineIdentificationFixture  = "identify_clothing.json"
+	offlineCharacteristicsFixture = "person_characteristics.json"
+)
+
+var offlineFixtures = map[string]string{
+	offlineIdentificationFixture:  `{"name":"Blue denim jacket","description":"Classic denim jacket with button front","brand":null,"size":"M","price_usd":60,"condition":"like new","material":"denim","color":"blue","style":"casual","clothing_type":"top"}`,
+	offlineCharacteristicsFixture: `{"body_type":"athletic","shoulder_type":"broad","body_to_leg_ratio":"balanced","hand_type":"large","upper_limb_type":"toned","weight":75,"height":"1.78","waist_size":82}`,
+}
+
+// OfflineLLMProcessor answers every call locally without a network: canned JSON for identify and
+// characteristics, and images built from the inputs for avatars, clothing processing and try-ons.
+// The same inputs always give the same output. Responses are marked IsTest and cost nothing.
+type OfflineLLMProcessor struct {
+	// FixturesDir overrides the canned JSON answers, empty for the built in ones
+	FixturesDir string
+}
+
+func NewOfflineLLMProcessor() *OfflineLLMProcessor {
+	return &OfflineLLMProcessor{FixturesDir: os.Getenv("LLM_OFFLINE_FIXTURES_DIR")}
+}
+
+func (p *OfflineLLMProcessor) fixture(name string) (string, error) {
+	if p.FixturesDir != "" {
+		content, err := os.ReadFile(filepath.Join(p.FixturesDir, name))
+		if err == nil {
+			return string(content), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("error reading offline fixture %s: %w", name, err)
+		}
+	}
+	return offlineFixtures[name], nil
+}
+
+func offlineImageResponse(img image.Image) (*LLMResponse, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("error encoding offline image: %w", err)
+	}
+	return &LLMResponse{Images: [][]byte{buf.Bytes()}, IsTest: true}, nil
+}
+
+func openOfflineImage(path string) (image.Image, error) {
+	img, err := imaging.Open(path, imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, fmt.Errorf("error reading image %s: %w", path, err)
+	}
+	return img, nil
+}
+
+// ProcessAvatarTaskWithCharacteristics returns the photo itself as the avatar.
+func (p *OfflineLLMProcessor) ProcessAvatarTaskWithCharacteristics(ctx context.Context, personAvatarPath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	img, err := openOfflineImage(personAvatarPath)
+	if err != nil {
+		return nil, err
+	}
+	return offlineImageResponse(img)
+}
+
+// GenerateTryOn stacks the garments with their white background removed over the middle of the avatar,
+// on the custom background when there is one.
+func (p *OfflineLLMProcessor) GenerateTryOn(ctx context.Context, personAvatarPath string, filePaths []string, options TryOnOptions, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	avatar, err := openOfflineImage(personAvatarPath)
+	if err != nil {
+		return nil, err
+	}
+	bounds := avatar.Bounds()
+	canvas := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	if options.BackgroundImagePath != "" {
+		background, err := openOfflineImage(options.BackgroundImagePath)
+		if err != nil {
+			return nil, err
+		}
+		background = imaging.Fill(background, bounds.Dx(), bounds.Dy(), imaging.Center, imaging.Lanczos)
+		draw.Draw(canvas, canvas.Bounds(), background, image.Point{}, draw.Src)
+	}
+	draw.Draw(canvas, canvas.Bounds(), avatar, bounds.Min, draw.Over)
+
+	if len(filePaths) > 0 {
+		// the garments share the middle half of the height, one band each from top to bottom
+		slotHeight := bounds.Dy() / 2 / len(filePaths)
+		slotWidth := bounds.Dx() / 2
+		for i, filePath := range filePaths {
+			fileBytes, err := os.ReadFile(filePath)
+			if err != nil {
+				return nil, fmt.Errorf("error reading image %s: %w", filePath, err)
+			}
+			transparent, err := BackgroundToAlpha(fileBytes, 244, 2.0)
+			if err != nil {
+				return nil, err
+			}
+			garment, _, err := image.Decode(bytes.NewReader(transparent))
+			if err != nil {
+				return nil, fmt.Errorf("error decoding garment %s: %w", filePath, err)
+			}
+			fitted := imaging.Fit(garment, max(slotWidth, 1), max(slotHeight, 1), imaging.Lanczos)
+			offset := image.Pt(
+				(bounds.Dx()-fitted.Bounds().Dx())/2,
+				bounds.Dy()/4+i*slotHeight+(slotHeight-fitted.Bounds().Dy())/2,
+			)
+			draw.Draw(canvas, fitted.Bounds().Add(offset), fitted, image.Point{}, draw.Over)
+		}
+	}
+	return offlineImageResponse(canvas)
+}
+
+func (p *OfflineLLMProcessor) AnalyzePersonCharacteristics(ctx context.Context, imagePath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	text, err := p.fixture(offlineCharacteristicsFixture)
+	if err != nil {
+		return nil, err
+	}
+	characteristics, err := DecodePersonCharacteristics(text)
+	if err != nil {
+		return nil, err
+	}
+	return &LLMResponse{Response: text, Characteristics: characteristics, IsTest: true}, nil
+}
+
+func (p *OfflineLLMProcessor) IdentifyClothing(ctx context.Context, clothingImagePath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	text, err := p.fixture(offlineIdentificationFixture)
+	if err != nil {
+		return nil, err
+	}
+	identification, err := DecodeClothingIdentification(text)
+	if err != nil {
+		return nil, err
+	}
+	return &LLMResponse{Response: text, Identification: identification, IsTest: true}, nil
+}
+
+var _ LLMProcessor = (*OfflineLLMProcessor)(nil)
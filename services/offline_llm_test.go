@@ -0,0 +1,90 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestPNG(t *testing.T, dir, name string, width, height int, fill color.Color) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, fill)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOfflineLLMProcessorThroughRegistry(t *testing.T) {
+	t.Setenv("LLM_PROVIDER", LLMProviderOffline)
+	t.Setenv("LLM_OFFLINE_FIXTURES_DIR", "")
+	registry := NewDefaultLLMProviderRegistry()
+	ctx := context.Background()
+	dir := t.TempDir()
+	avatarPath := writeTestPNG(t, dir, "avatar.png", 90, 160, color.RGBA{R: 200, G: 150, B: 120, A: 255})
+	garmentPath := writeTestPNG(t, dir, "garment.png", 40, 40, color.RGBA{B: 200, A: 255})
+
+	response, err := registry.GenerateTryOn(ctx, avatarPath, []string{garmentPath}, TryOnOptions{}, nil, Flash25Image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Images) != 1 || !response.IsTest {
+		t.Fatalf("unexpected try-on response %+v", response)
+	}
+	tryOn, err := png.Decode(bytes.NewReader(response.Images[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tryOn.Bounds().Dx() != 90 || tryOn.Bounds().Dy() != 160 {
+		t.Fatalf("try-on is %v, expected the avatar size", tryOn.Bounds())
+	}
+	if _, _, b, _ := tryOn.At(45, 80).RGBA(); b>>8 < 150 {
+		t.Fatal("the garment is not drawn over the middle of the avatar")
+	}
+	if LLMCostUSD(Flash25Image, response) != 0 {
+		t.Fatal("offline responses must not cost anything")
+	}
+
+	identified, err := registry.IdentifyClothing(ctx, garmentPath, nil, Pro25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identified.Identification == nil || identified.Identification.ClothingType != "top" {
+		t.Fatalf("unexpected identification %+v", identified.Identification)
+	}
+}
+
+func TestOfflineLLMProcessorFixtures(t *testing.T) {
+	dir := t.TempDir()
+	fixture := `{"body_type":"slender","shoulder_type":"narrow","body_to_leg_ratio":"long_legs","hand_type":"slender","upper_limb_type":"slender","weight":55,"height":"1.65","waist_size":64}`
+	if err := os.WriteFile(filepath.Join(dir, offlineCharacteristicsFixture), []byte(fixture), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	processor := &OfflineLLMProcessor{FixturesDir: dir}
+	response, err := processor.AnalyzePersonCharacteristics(context.Background(), "", nil, Pro25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Characteristics.Weight != 55 {
+		t.Fatalf("fixture was not used: %+v", response.Characteristics)
+	}
+	// fixtures missing from the directory fall back to the canned ones
+	if _, err := processor.IdentifyClothing(context.Background(), "", nil, Pro25); err != nil {
+		t.Fatal(err)
+	}
+}
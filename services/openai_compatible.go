@@ -0,0 +1,289 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// OpenAICompatibleProcessor talks to an OpenAI compatible HTTP API, e.g. BytePlus ModelArk serving Seedream.
+// Images are generated with POST /images/generations and text answers come from POST /chat/completions.
+type OpenAICompatibleProcessor struct {
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
+}
+
+func NewOpenAICompatibleProcessor(baseURL, apiKey string) *OpenAICompatibleProcessor {
+	return &OpenAICompatibleProcessor{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		APIKey:     apiKey,
+		HTTPClient: &http.Client{},
+	}
+}
+
+type openAIImageRequest struct {
+	Model          string   `json:"model"`
+	Prompt         string   `json:"prompt"`
+	Image          []string `json:"image,omitempty"`
+	Size           string   `json:"size,omitempty"`
+	ResponseFormat string   `json:"response_format"`
+	Watermark      bool     `json:"watermark"`
+}
+
+type openAIImageResponse struct {
+	Data []struct {
+		B64JSON string `json:"b64_json"`
+		URL     string `json:"url"`
+	} `json:"data"`
+	Usage struct {
+		OutputTokens int32 `json:"output_tokens"`
+		TotalTokens  int32 `json:"total_tokens"`
+	} `json:"usage"`
+	Error *openAIError `json:"error"`
+}
+
+type openAIChatMessage struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"`
+}
+
+type openAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+type openAIChatRequest struct {
+	Model          string              `json:"model"`
+	Messages       []openAIChatMessage `json:"messages"`
+	MaxTokens      int                 `json:"max_tokens,omitempty"`
+	Temperature    float32             `json:"temperature"`
+	ResponseFormat map[string]string   `json:"response_format,omitempty"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message struct {
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens            int32 `json:"prompt_tokens"`
+		CompletionTokens        int32 `json:"completion_tokens"`
+		TotalTokens             int32 `json:"total_tokens"`
+		CompletionTokensDetails struct {
+			ReasoningTokens int32 `json:"reasoning_tokens"`
+		} `json:"completion_tokens_details"`
+	} `json:"usage"`
+	Error *openAIError `json:"error"`
+}
+
+type openAIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// openAIImageSizes are the output sizes per aspect ratio, around 4 megapixels
+var openAIImageSizes = map[TryOnAspectRatio]string{
+	AspectRatio9x16: "1440x2560",
+	AspectRatio3x4:  "1728x2304",
+	AspectRatio4x5:  "1792x2240",
+	AspectRatio1x1:  "2048x2048",
+}
+
+// imageDataURI inlines the file as a data URI, the API does not share the file storage of Gemini.
+func imageDataURI(filePath string) (string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error reading image %s: %v", filePath, err)
+	}
+	return fmt.Sprintf("data:%s;base64,%s", http.DetectContentType(data), base64.StdEncoding.EncodeToString(data)), nil
+}
+
+func (p *OpenAICompatibleProcessor) post(ctx context.Context, path string, body any, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, LLMGenerateTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.BaseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return classifyUpstreamError(fmt.Errorf("error calling %s: %w", path, err))
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading %s response: %v", path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var errResp struct {
+			Error *openAIError `json:"error"`
+		}
+		if json.Unmarshal(respBody, &errResp) == nil && errResp.Error != nil {
+			if strings.Contains(errResp.Error.Code, "Sensitive") || errResp.Error.Code == "content_policy_violation" {
+				return fmt.Errorf("%w: %s", ErrContentBlocked, errResp.Error.Message)
+			}
+			err = fmt.Errorf("%s failed with status %d: %s %s", path, resp.StatusCode, errResp.Error.Code, errResp.Error.Message)
+		} else {
+			err = fmt.Errorf("%s failed with status %d: %s", path, resp.StatusCode, string(respBody))
+		}
+		if isTransientStatus(resp.StatusCode) {
+			return fmt.Errorf("%w: %w", ErrTransientUpstream, err)
+		}
+		return err
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("%w: error parsing %s response: %v", ErrParseFailure, path, err)
+	}
+	return nil
+}
+
+func (p *OpenAICompatibleProcessor) generateImage(ctx context.Context, imagePaths []string, prompt *RenderedPrompt, size string, modelName LLMModelName) (*LLMResponse, error) {
+	var images []string
+	for _, imagePath := range imagePaths {
+		if imagePath == "" {
+			continue
+		}
+		dataURI, err := imageDataURI(imagePath)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, dataURI)
+	}
+	// the images API has no system instruction, it goes in front of the user prompt
+	text := prompt.User
+	if prompt.System != "" {
+		text = prompt.System + "\n\n" + prompt.User
+	}
+	var result openAIImageResponse
+	err := p.post(ctx, "/images/generations", openAIImageRequest{
+		Model:          modelName.String(),
+		Prompt:         text,
+		Image:          images,
+		Size:           size,
+		ResponseFormat: "b64_json",
+	}, &result)
+	if err != nil {
+		fmt.Println("Error in image generation:", err)
+		return nil, err
+	}
+	var imagesBytes [][]byte
+	for _, item := range result.Data {
+		if item.B64JSON == "" {
+			continue
+		}
+		imageBytes, err := base64.StdEncoding.DecodeString(item.B64JSON)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding generated image: %v", err)
+		}
+		imagesBytes = append(imagesBytes, imageBytes)
+	}
+	fmt.Println("Number of images extracted:", len(imagesBytes))
+	fmt.Println("Output token count:", result.Usage.OutputTokens)
+	return &LLMResponse{
+		Images:           imagesBytes,
+		OutputTokenCount: result.Usage.OutputTokens,
+		TotalTokenCount:  result.Usage.TotalTokens,
+	}, nil
+}
+
+func (p *OpenAICompatibleProcessor) chat(ctx context.Context, imagePath string, prompt *RenderedPrompt, temperature float32, modelName LLMModelName) (*LLMResponse, error) {
+	dataURI, err := imageDataURI(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	var result openAIChatResponse
+	err = p.post(ctx, "/chat/completions", openAIChatRequest{
+		Model: modelName.String(),
+		Messages: []openAIChatMessage{
+			{Role: "system", Content: prompt.System},
+			{Role: "user", Content: []openAIContentPart{
+				{Type: "image_url", ImageURL: &openAIImageURL{URL: dataURI}},
+				{Type: "text", Text: prompt.User},
+			}},
+		},
+		MaxTokens:      4000,
+		Temperature:    temperature,
+		ResponseFormat: map[string]string{"type": "json_object"},
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Choices) == 0 {
+		return nil, fmt.Errorf("empty response from %s", modelName)
+	}
+	return &LLMResponse{
+		Response:           result.Choices[0].Message.Content,
+		Thoughts:           result.Choices[0].Message.ReasoningContent,
+		InputTokenCount:    result.Usage.PromptTokens,
+		ThoughtsTokenCount: result.Usage.CompletionTokensDetails.ReasoningTokens,
+		OutputTokenCount:   result.Usage.CompletionTokens,
+		TotalTokenCount:    result.Usage.TotalTokens,
+	}, nil
+}
+
+func (p *OpenAICompatibleProcessor) ProcessAvatarTaskWithCharacteristics(ctx context.Context, personAvatarPath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	return p.generateImage(ctx, []string{personAvatarPath, whiteCanvasPath}, prompt, openAIImageSizes[AspectRatio9x16], modelName)
+}
+
+func (p *OpenAICompatibleProcessor) GenerateTryOn(ctx context.Context, personAvatarPath string, filePaths []string, options TryOnOptions, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	options, err := options.WithDefaults()
+	if err != nil {
+		return nil, err
+	}
+	imagePaths := append([]string{personAvatarPath}, filePaths...)
+	if options.Scene == SceneCustom {
+		// background goes last, the prompt refers to it as the last image
+		imagePaths = append(imagePaths, options.BackgroundImagePath)
+	}
+	return p.generateImage(ctx, imagePaths, prompt, openAIImageSizes[options.AspectRatio], modelName)
+}
+
+func (p *OpenAICompatibleProcessor) AnalyzePersonCharacteristics(ctx context.Context, imagePath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	response, err := p.chat(ctx, imagePath, prompt, 0.2, modelName)
+	if err != nil {
+		return nil, fmt.Errorf("error analyzing person characteristics: %w", err)
+	}
+	if response.Response == "" {
+		return nil, fmt.Errorf("empty response from person characteristics analysis")
+	}
+	response.Characteristics, err = DecodePersonCharacteristics(response.Response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (p *OpenAICompatibleProcessor) IdentifyClothing(ctx context.Context, clothingImagePath string, prompt *RenderedPrompt, modelName LLMModelName) (*LLMResponse, error) {
+	response, err := p.chat(ctx, clothingImagePath, prompt, 0.3, modelName)
+	if err != nil {
+		return nil, fmt.Errorf("error identifying clothing: %w", err)
+	}
+	response.Identification, err = DecodeClothingIdentification(response.Response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+var _ LLMProcessor = (*OpenAICompatibleProcessor)(nil)
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// stubOpenAIServer answers the images and chat endpoints like an OpenAI compatible API and records the requests.
+func stubOpenAIServer(t *testing.T, generated []byte) (*httptest.Server, *[]string) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"code":"AuthenticationError","message":"bad key"}}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/images/generations":
+			var req openAIImageRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("invalid images request: %v", err)
+			}
+			if req.Model != Seedream40.String() || req.Size != "1728x2304" || len(req.Image) != 3 {
+				t.Errorf("unexpected images request: model %s, size %s, %d images", req.Model, req.Size, len(req.Image))
+			}
+			json.NewEncoder(w).Encode(map[string]any{
+				"data":  []map[string]string{{"b64_json": base64.StdEncoding.EncodeToString(generated)}},
+				"usage": map[string]int{"generated_images": 1, "output_tokens": 16384, "total_tokens": 16384},
+			})
+		case "/chat/completions":
+			json.NewEncoder(w).Encode(map[string]any{
+				"choices": []map[string]any{{"message": map[string]string{"content": `{"name":"Shirt","clothing_type":"top"}`}}},
+				"usage":   map[string]int{"prompt_tokens": 1200, "completion_tokens": 30, "total_tokens": 1230},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &paths
+}
+
+func TestOpenAICompatibleProcessorThroughRegistry(t *testing.T) {
+	var generated bytes.Buffer
+	if err := png.Encode(&generated, image.NewGray(image.Rect(0, 0, 9, 16))); err != nil {
+		t.Fatal(err)
+	}
+	imagePath := filepath.Join(t.TempDir(), "person.png")
+	if err := os.WriteFile(imagePath, generated.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server, paths := stubOpenAIServer(t, generated.Bytes())
+
+	registry := NewLLMProviderRegistry(nil)
+	registry.Register(Seedream40, NewOpenAICompatibleProcessor(server.URL+"/", "test-key"))
+	if registry.Has(Flash25Image) {
+		t.Fatalf("only Seedream should be registered")
+	}
+	if _, err := registry.ProcessorFor(Flash25Image); err == nil {
+		t.Fatalf("expected an error for a model without backend")
+	}
+
+	prompt := &RenderedPrompt{System: "system", User: "user"}
+	response, err := registry.GenerateTryOn(context.Background(), imagePath, []string{imagePath, "", imagePath}, TryOnOptions{AspectRatio: AspectRatio3x4}, prompt, Seedream40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Images) != 1 || !bytes.Equal(response.Images[0], generated.Bytes()) {
+		t.Fatalf("expected the generated image back")
+	}
+	if response.OutputTokenCount != 16384 {
+		t.Fatalf("expected output tokens from usage, got %d", response.OutputTokenCount)
+	}
+
+	identified, err := registry.IdentifyClothing(context.Background(), imagePath, prompt, Seedream40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identified.Response != `{"name":"Shirt","clothing_type":"top"}` || identified.InputTokenCount != 1200 {
+		t.Fatalf("unexpected identify response %+v", identified)
+	}
+
+	if len(*paths) != 2 || (*paths)[0] != "/images/generations" || (*paths)[1] != "/chat/completions" {
+		t.Fatalf("unexpected requests %v", *paths)
+	}
+
+	unauthorized := NewOpenAICompatibleProcessor(server.URL, "wrong-key")
+	if _, err := unauthorized.IdentifyClothing(context.Background(), imagePath, prompt, Seedream40); err == nil {
+		t.Fatalf("expected the API error to be returned")
+	}
+}
+
+func TestOpenAICompatibleProcessorHonoursContext(t *testing.T) {
+	imagePath := filepath.Join(t.TempDir(), "clothing.png")
+	if err := os.WriteFile(imagePath, []byte("\x89PNG\r\n\x1a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_, err := NewOpenAICompatibleProcessor(server.URL, "test-key").IdentifyClothing(ctx, imagePath, &RenderedPrompt{}, Seedream40)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline of the task ctx, got %v", err)
+	}
+	if time.Since(started) > 5*time.Second {
+		t.Fatalf("the call did not stop at the deadline")
+	}
+}
+
+func TestOpenAICompatibleProcessorRateLimitIsTransient(t *testing.T) {
+	imagePath := filepath.Join(t.TempDir(), "person.png")
+	if err := os.WriteFile(imagePath, []byte("\x89PNG\r\n\x1a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"code":"RateLimitExceeded","message":"too many requests"}}`))
+	}))
+	defer server.Close()
+
+	processor := NewOpenAICompatibleProcessor(server.URL, "test-key")
+	prompt := &RenderedPrompt{System: "system", User: "user"}
+	if _, err := processor.AnalyzePersonCharacteristics(context.Background(), imagePath, prompt, Seedream40); !errors.Is(err, ErrTransientUpstream) {
+		t.Fatalf("expected the 429 of the characteristics analysis to be transient, got %v", err)
+	}
+	if _, err := processor.IdentifyClothing(context.Background(), imagePath, prompt, Seedream40); !errors.Is(err, ErrTransientUpstream) {
+		t.Fatalf("expected the 429 of the identification to be transient, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"text/template"
+
+	"letryapi/models"
+
+	"gorm.io/gorm"
+)
+
+//go:embed prompts/*.tmpl
+var embeddedPrompts embed.FS
+
+type PromptName string
+
+const (
+	PromptTryOn                 PromptName = "tryon"
+	PromptAvatarCharacteristics PromptName = "avatar_characteristics"
+	PromptPersonCharacteristics PromptName = "person_characteristics"
+	PromptIdentifyClothing      PromptName = "identify_clothing"
+)
+
+// DefaultPromptVersion is used when no active A/B versions are configured in the database.
+const DefaultPromptVersion = "v1"
+
+type RenderedPrompt struct {
+	Name    PromptName
+	Version string
+	System  string
+	User    string
+}
+
+// PromptRegistry resolves prompt templates from the database first and the embedded prompts/ files second.
+type PromptRegistry struct {
+	db *gorm.DB
+}
+
+// NewPromptRegistry returns a registry; with a nil db only embedded prompts are used.
+func NewPromptRegistry(db *gorm.DB) *PromptRegistry {
+	return &PromptRegistry{db: db}
+}
+
+// Assign picks the prompt version for a new job, weighted between the active versions
+// stored in the database, or DefaultPromptVersion when there are none.
+func (r *PromptRegistry) Assign(name PromptName) string {
+	templates, totalWeight := r.activeTemplates(name)
+	if totalWeight == 0 {
+		return DefaultPromptVersion
+	}
+	return weightedVersion(templates, rand.IntN(totalWeight))
+}
+
+// AssignForUser picks the version like Assign, but the same user always gets the same version
+// while the weights don't change, so results cached by prompt version are found again.
+func (r *PromptRegistry) AssignForUser(name PromptName, userID uint) string {
+	templates, totalWeight := r.activeTemplates(name)
+	if totalWeight == 0 {
+		return DefaultPromptVersion
+	}
+	return weightedVersion(templates, userWeightBucket(name, userID, totalWeight))
+}
+
+// activeTemplates loads the active versions of the prompt with their total weight, zero when there are none.
+func (r *PromptRegistry) activeTemplates(name PromptName) ([]models.PromptTemplate, int) {
+	if r.db == nil {
+		return nil, 0
+	}
+	var templates []models.PromptTemplate
+	if err := r.db.Where("name = ? AND active = ? AND weight > 0", string(name), true).Order("version").Find(&templates).Error; err != nil {
+		fmt.Printf("[Prompt: %s] Error on loading active versions, using default: %v\n", name, err)
+		return nil, 0
+	}
+	totalWeight := 0
+	for _, t := range templates {
+		totalWeight += t.Weight
+	}
+	return templates, totalWeight
+}
+
+// weightedVersion returns the version whose weight range contains pick, pick is below the total weight.
+func weightedVersion(templates []models.PromptTemplate, pick int) string {
+	for _, t := range templates {
+		if pick < t.Weight {
+			return t.Version
+		}
+		pick -= t.Weight
+	}
+	return DefaultPromptVersion
+}
+
+// userWeightBucket spreads users evenly over [0, totalWeight), per prompt so the splits of prompts are independent.
+func userWeightBucket(name PromptName, userID uint, totalWeight int) int {
+	hash := fnv.New32a()
+	fmt.Fprintf(hash, "%s:%d", name, userID)
+	return int(hash.Sum32() % uint32(totalWeight))
+}
+
+// Render executes the "system" and "user" blocks of the prompt version with data.
+func (r *PromptRegistry) Render(name PromptName, version string, data any) (*RenderedPrompt, error) {
+	text, err := r.templateText(name, version)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(string(name)).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing prompt %s %s: %v", name, version, err)
+	}
+	prompt := &RenderedPrompt{Name: name, Version: version}
+	for block, target := range map[string]*string{"system": &prompt.System, "user": &prompt.User} {
+		if tmpl.Lookup(block) == nil {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, block, data); err != nil {
+			return nil, fmt.Errorf("error rendering prompt %s %s: %v", name, version, err)
+		}
+		*target = buf.String()
+	}
+	return prompt, nil
+}
+
+func (r *PromptRegistry) templateText(name PromptName, version string) (string, error) {
+	if r.db != nil {
+		var stored models.PromptTemplate
+		res := r.db.Where("name = ? AND version = ?", string(name), version).Limit(1).Find(&stored)
+		if res.Error != nil {
+			fmt.Printf("[Prompt: %s] Error on loading version %s, trying embedded: %v\n", name, version, res.Error)
+		} else if res.RowsAffected > 0 && stored.Template != "" {
+			return stored.Template, nil
+		}
+	}
+	content, err := embeddedPrompts.ReadFile(fmt.Sprintf("prompts/%s.%s.tmpl", name, version))
+	if err != nil {
+		return "", fmt.Errorf("prompt %s version %s not found", name, version)
+	}
+	return string(content), nil
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"testing"
+
+	"letryapi/models"
+)
+
+func TestWeightedVersion(t *testing.T) {
+	templates := []models.PromptTemplate{{Version: "v1", Weight: 3}, {Version: "v2", Weight: 1}}
+	for pick, want := range map[int]string{0: "v1", 2: "v1", 3: "v2"} {
+		if got := weightedVersion(templates, pick); got != want {
+			t.Errorf("pick %d gave %s, expected %s", pick, got, want)
+		}
+	}
+
+	counts := map[string]int{}
+	for userID := uint(1); userID <= 4000; userID++ {
+		bucket := userWeightBucket(PromptTryOn, userID, 4)
+		if bucket != userWeightBucket(PromptTryOn, userID, 4) {
+			t.Fatalf("user %d got different buckets", userID)
+		}
+		counts[weightedVersion(templates, bucket)]++
+	}
+	// 3:1 split of the users, with some slack for the hash
+	if counts["v1"] < 2800 || counts["v1"] > 3200 {
+		t.Fatalf("unexpected split %v", counts)
+	}
+}
@@ -3,25 +3,40 @@ package services
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+// ErrR2ObjectNotFound is returned by HeadR2Object when the key does not exist (yet).
+var ErrR2ObjectNotFound = errors.New("r2 object not found")
+
+type R2ObjectInfo struct {
+	Size        int64
+	ContentType string
+}
+
 type AWSServiceProvider interface {
 	InitPresignClient(ctx context.Context) error
 	PresignLink(ctx context.Context, bucketName string, fileName string) (string, error)
 	UploadToPresignedURL(ctx context.Context, bucketName, url string, fileContent []byte) (string, int, error)
 	GetPresignedR2FileReadURL(ctx context.Context, bucketName, fileKey string) (string, error)
+	HeadR2Object(ctx context.Context, bucketName, fileKey string) (*R2ObjectInfo, error)
+	DeleteR2Object(ctx context.Context, bucketName, fileKey string) error
 }
 
 type AWSService struct {
+	S3Client        *s3.Client
 	S3PresignClient *s3.PresignClient
 }
 
@@ -46,10 +61,110 @@ func (awsService *AWSService) InitPresignClient(ctx context.Context) error {
 
 	presignClient := s3.NewPresignClient(s3Client)
 
+	awsService.S3Client = s3Client
 	awsService.S3PresignClient = presignClient
 	return err
 }
 
+func (awsService *AWSService) HeadR2Object(ctx context.Context, bucketName, fileKey string) (*R2ObjectInfo, error) {
+	output, err := awsService.S3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(fileKey),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, ErrR2ObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to head object: %w", err)
+	}
+	info := &R2ObjectInfo{Size: output.ContentLength}
+	if output.ContentType != nil {
+		info.ContentType = *output.ContentType
+	}
+	return info, nil
+}
+
+// DeleteR2Object removes the object, deleting a missing key is not an error.
+func (awsService *AWSService) DeleteR2Object(ctx context.Context, bucketName, fileKey string) error {
+	_, err := awsService.S3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(fileKey),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	return nil
+}
+
+// r2ExistsAttempts and r2ExistsBaseDelay give roughly 6 seconds of backoff in total
+const (
+	r2ExistsAttempts  = 6
+	r2ExistsBaseDelay = 200 * time.Millisecond
+)
+
+// WaitForR2Object polls HeadR2Object with exponential backoff until the object is visible,
+// which it may not be right after an upload. It gives up when ctx is done or the attempts are used up.
+func WaitForR2Object(ctx context.Context, awsService AWSServiceProvider, bucketName, fileKey string) (*R2ObjectInfo, error) {
+	delay := r2ExistsBaseDelay
+	for attempt := 1; ; attempt++ {
+		info, err := awsService.HeadR2Object(ctx, bucketName, fileKey)
+		if err == nil {
+			return info, nil
+		}
+		if attempt >= r2ExistsAttempts {
+			return nil, fmt.Errorf("%w: object %s not available after %d attempts: %w", ErrAssetMissing, fileKey, attempt, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// MaxImageUploadSize is the largest image accepted through a presigned upload
+const MaxImageUploadSize = 20 << 20
+
+// allowedImageUploadTypes are the content types the apps may upload, see NormalizeImageForLLM
+var allowedImageUploadTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+	"image/heic": true,
+	"image/heif": true,
+}
+
+// UploadRejectedError is returned by VerifyImageUpload when the uploaded object can't be processed.
+type UploadRejectedError struct {
+	Reason string
+}
+
+func (e *UploadRejectedError) Error() string {
+	return e.Reason
+}
+
+// VerifyImageUpload checks that a presigned upload has landed in R2 with an image content type
+// and a size within MaxImageUploadSize. ErrR2ObjectNotFound is returned when nothing was uploaded yet.
+func VerifyImageUpload(ctx context.Context, awsService AWSServiceProvider, bucketName, fileKey string) (*R2ObjectInfo, error) {
+	info, err := awsService.HeadR2Object(ctx, bucketName, fileKey)
+	if err != nil {
+		return nil, err
+	}
+	contentType, _, err := mime.ParseMediaType(info.ContentType)
+	if err != nil || !allowedImageUploadTypes[contentType] {
+		return info, &UploadRejectedError{Reason: fmt.Sprintf("unsupported file type %q, please upload a JPEG, PNG, WebP or HEIC image", info.ContentType)}
+	}
+	if info.Size <= 0 {
+		return info, &UploadRejectedError{Reason: "uploaded file is empty"}
+	}
+	if info.Size > MaxImageUploadSize {
+		return info, &UploadRejectedError{Reason: fmt.Sprintf("file is too large, the maximum size is %d MB", MaxImageUploadSize>>20)}
+	}
+	return info, nil
+}
+
 func (awsService *AWSService) PresignLink(ctx context.Context, bucketName string, fileName string) (string, error) {
 	request, err := awsService.S3PresignClient.PresignPutObject(context.TODO(), &s3.PutObjectInput{Bucket: &bucketName, Key: &fileName})
 	return request.URL, err
@@ -80,6 +195,7 @@ func (awsService *AWSService) UploadToPresignedURL(ctx context.Context, bucketNa
 		"image/png":  true,
 		"image/jpeg": true,
 		"image/heic": true,
+		"image/webp": true,
 	}
 	if !allowedMimeTypes[mimeType] {
 		return "", 0, fmt.Errorf("unsupported file type: %s", mimeType)
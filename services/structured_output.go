@@ -0,0 +1,206 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// Allowed values of the identified clothing, the same lists go into the response schema
+var (
+	ClothingConditions = []string{"new", "like new", "good", "fair", "poor"}
+	ClothingStyles     = []string{"casual", "formal", "sporty", "vintage", "bohemian", "chic", "business", "streetwear"}
+	ClothingTypes      = []string{"top", "bottom", "shoes", "accessory"}
+)
+
+// Allowed values of the person characteristics
+var (
+	BodyTypes       = []BodyType{BodyTypeSlender, BodyTypeAthletic, BodyTypeRobust}
+	ShoulderTypes   = []ShoulderType{ShoulderTypeNarrow, ShoulderTypeProportionate, ShoulderTypeBroad}
+	BodyToLegRatios = []BodyToLegRatio{BodyToLegRatioLongLegs, BodyToLegRatioBalanced, BodyToLegRatioLongTorso}
+	HandTypes       = []HandType{HandTypeSlender, HandTypeProportioned, HandTypeLarge}
+	UpperLimbTypes  = []UpperLimbType{UpperLimbTypeSlender, UpperLimbTypeToned, UpperLimbTypeMuscular}
+)
+
+// Plausible ranges of the numbers the models estimate
+const (
+	minPersonWeightKg  = 30
+	maxPersonWeightKg  = 250
+	minPersonHeightM   = 1.0
+	maxPersonHeightM   = 2.3
+	minPersonWaistCm   = 40
+	maxPersonWaistCm   = 200
+	maxClothingNameLen = 200
+	maxClothingPrice   = 100000
+)
+
+// StructuredOutputError is returned when a JSON answer of the model can't be decoded or has a value outside
+// of the allowed enums and ranges. Field is empty when the JSON itself is invalid.
+type StructuredOutputError struct {
+	Operation string
+	Field     string
+	Value     any
+	Reason    string
+}
+
+func (e *StructuredOutputError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("invalid %s response: %s", e.Operation, e.Reason)
+	}
+	return fmt.Sprintf("invalid %s response: %s %v %s", e.Operation, e.Field, e.Value, e.Reason)
+}
+
+// Is makes the error match ErrParseFailure
+func (e *StructuredOutputError) Is(target error) bool {
+	return target == ErrParseFailure
+}
+
+func stringEnum[T ~string](values []T) []string {
+	enum := make([]string, len(values))
+	for i, value := range values {
+		enum[i] = string(value)
+	}
+	return enum
+}
+
+func float64Pointer(f float64) *float64 {
+	return &f
+}
+
+// clothingIdentificationSchema is the response schema of IdentifyClothing
+func clothingIdentificationSchema() *genai.Schema {
+	return &genai.Schema{
+		Type: "object",
+		Properties: map[string]*genai.Schema{
+			"name":          {Type: "string"},
+			"description":   {Type: "string"},
+			"brand":         {Type: "string"},
+			"size":          {Type: "string"},
+			"price_usd":     {Type: "number", Minimum: float64Pointer(0), Maximum: float64Pointer(maxClothingPrice)},
+			"condition":     {Type: "string", Enum: ClothingConditions},
+			"material":      {Type: "string"},
+			"color":         {Type: "string"},
+			"style":         {Type: "string", Enum: ClothingStyles},
+			"clothing_type": {Type: "string", Enum: ClothingTypes},
+		},
+		Required: []string{"name", "condition", "material", "color", "style", "clothing_type"},
+	}
+}
+
+// personCharacteristicsSchema is the response schema of AnalyzePersonCharacteristics
+func personCharacteristicsSchema() *genai.Schema {
+	return &genai.Schema{
+		Type: "object",
+		Properties: map[string]*genai.Schema{
+			"body_type":         {Type: "string", Enum: stringEnum(BodyTypes)},
+			"shoulder_type":     {Type: "string", Enum: stringEnum(ShoulderTypes)},
+			"body_to_leg_ratio": {Type: "string", Enum: stringEnum(BodyToLegRatios)},
+			"hand_type":         {Type: "string", Enum: stringEnum(HandTypes)},
+			"upper_limb_type":   {Type: "string", Enum: stringEnum(UpperLimbTypes)},
+			"weight":            {Type: "integer", Minimum: float64Pointer(minPersonWeightKg), Maximum: float64Pointer(maxPersonWeightKg)},
+			"height":            {Type: "string"},
+			"waist_size":        {Type: "integer", Minimum: float64Pointer(minPersonWaistCm), Maximum: float64Pointer(maxPersonWaistCm)},
+		},
+		Required: []string{"body_type", "shoulder_type", "body_to_leg_ratio", "hand_type", "upper_limb_type", "weight", "height", "waist_size"},
+	}
+}
+
+// decodeStructuredOutput unmarshals the JSON answer, backends without schema support may still wrap it in a markdown fence
+func decodeStructuredOutput(operation, text string, out any) error {
+	text = strings.TrimSpace(text)
+	text = strings.TrimPrefix(text, "```json")
+	text = strings.TrimSuffix(text, "```")
+	if err := json.Unmarshal([]byte(text), out); err != nil {
+		return &StructuredOutputError{Operation: operation, Reason: err.Error()}
+	}
+	return nil
+}
+
+// DecodeClothingIdentification decodes and validates the answer of IdentifyClothing.
+func DecodeClothingIdentification(text string) (*ClothingIdentificationResponse, error) {
+	var identification ClothingIdentificationResponse
+	if err := decodeStructuredOutput("clothing identification", text, &identification); err != nil {
+		return nil, err
+	}
+	if err := identification.Validate(); err != nil {
+		return nil, err
+	}
+	return &identification, nil
+}
+
+// DecodePersonCharacteristics decodes and validates the answer of AnalyzePersonCharacteristics.
+func DecodePersonCharacteristics(text string) (*PersonCharacteristics, error) {
+	var characteristics PersonCharacteristics
+	if err := decodeStructuredOutput("person characteristics", text, &characteristics); err != nil {
+		return nil, err
+	}
+	if err := characteristics.Validate(); err != nil {
+		return nil, err
+	}
+	return &characteristics, nil
+}
+
+func (r *ClothingIdentificationResponse) Validate() error {
+	invalid := func(field string, value any, reason string) error {
+		return &StructuredOutputError{Operation: "clothing identification", Field: field, Value: value, Reason: reason}
+	}
+	if strings.TrimSpace(r.Name) == "" {
+		return invalid("name", r.Name, "is empty")
+	}
+	if len(r.Name) > maxClothingNameLen {
+		return invalid("name", len(r.Name), fmt.Sprintf("characters is longer than %d", maxClothingNameLen))
+	}
+	if !slices.Contains(ClothingTypes, r.ClothingType) {
+		return invalid("clothing_type", r.ClothingType, "is not one of "+strings.Join(ClothingTypes, ", "))
+	}
+	if r.Condition != nil && !slices.Contains(ClothingConditions, *r.Condition) {
+		return invalid("condition", *r.Condition, "is not one of "+strings.Join(ClothingConditions, ", "))
+	}
+	if r.Style != nil && !slices.Contains(ClothingStyles, *r.Style) {
+		return invalid("style", *r.Style, "is not one of "+strings.Join(ClothingStyles, ", "))
+	}
+	if r.PriceUSD != nil && (*r.PriceUSD < 0 || *r.PriceUSD > maxClothingPrice) {
+		return invalid("price_usd", *r.PriceUSD, fmt.Sprintf("is outside of 0-%d", maxClothingPrice))
+	}
+	return nil
+}
+
+func (p *PersonCharacteristics) Validate() error {
+	invalid := func(field string, value any, reason string) error {
+		return &StructuredOutputError{Operation: "person characteristics", Field: field, Value: value, Reason: reason}
+	}
+	if !slices.Contains(BodyTypes, p.BodyType) {
+		return invalid("body_type", p.BodyType, "is not one of "+strings.Join(stringEnum(BodyTypes), ", "))
+	}
+	if !slices.Contains(ShoulderTypes, p.ShoulderType) {
+		return invalid("shoulder_type", p.ShoulderType, "is not one of "+strings.Join(stringEnum(ShoulderTypes), ", "))
+	}
+	if !slices.Contains(BodyToLegRatios, p.BodyToLegRatio) {
+		return invalid("body_to_leg_ratio", p.BodyToLegRatio, "is not one of "+strings.Join(stringEnum(BodyToLegRatios), ", "))
+	}
+	if !slices.Contains(HandTypes, p.HandType) {
+		return invalid("hand_type", p.HandType, "is not one of "+strings.Join(stringEnum(HandTypes), ", "))
+	}
+	if !slices.Contains(UpperLimbTypes, p.UpperLimbType) {
+		return invalid("upper_limb_type", p.UpperLimbType, "is not one of "+strings.Join(stringEnum(UpperLimbTypes), ", "))
+	}
+	if p.Weight < minPersonWeightKg || p.Weight > maxPersonWeightKg {
+		return invalid("weight", p.Weight, fmt.Sprintf("kg is outside of %d-%d", minPersonWeightKg, maxPersonWeightKg))
+	}
+	// the height is a string in meters, e.g. "1.72"
+	height, err := strconv.ParseFloat(strings.TrimSpace(p.Height), 64)
+	if err != nil {
+		return invalid("height", p.Height, "is not a number in meters")
+	}
+	if height < minPersonHeightM || height > maxPersonHeightM {
+		return invalid("height", p.Height, fmt.Sprintf("m is outside of %.1f-%.1f", minPersonHeightM, maxPersonHeightM))
+	}
+	if p.WaistSize < minPersonWaistCm || p.WaistSize > maxPersonWaistCm {
+		return invalid("waist_size", p.WaistSize, fmt.Sprintf("cm is outside of %d-%d", minPersonWaistCm, maxPersonWaistCm))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeClothingIdentification(t *testing.T) {
+	identification, err := DecodeClothingIdentification("```json\n{\"name\":\"Denim jacket\",\"condition\":\"like new\",\"style\":\"casual\",\"price_usd\":80,\"clothing_type\":\"top\"}\n```")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identification.Name != "Denim jacket" || *identification.Condition != "like new" {
+		t.Fatalf("unexpected identification %+v", identification)
+	}
+
+	tests := []struct {
+		name  string
+		text  string
+		field string
+	}{
+		{"invalid json", `{"name":`, ""},
+		{"empty name", `{"name":" ","clothing_type":"top"}`, "name"},
+		{"unknown type", `{"name":"Hat","clothing_type":"headwear"}`, "clothing_type"},
+		{"unknown style", `{"name":"Hat","style":"punk","clothing_type":"accessory"}`, "style"},
+		{"negative price", `{"name":"Hat","price_usd":-1,"clothing_type":"accessory"}`, "price_usd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeClothingIdentification(tt.text)
+			var outputErr *StructuredOutputError
+			if !errors.As(err, &outputErr) || outputErr.Field != tt.field {
+				t.Fatalf("expected StructuredOutputError on %q, got %v", tt.field, err)
+			}
+		})
+	}
+}
+
+func TestDecodePersonCharacteristics(t *testing.T) {
+	valid := `{"body_type":"athletic","shoulder_type":"broad","body_to_leg_ratio":"balanced","hand_type":"large","upper_limb_type":"toned","weight":78,"height":"1.82","waist_size":84}`
+	if _, err := DecodePersonCharacteristics(valid); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		text  string
+		field string
+	}{
+		{"unknown body type", `{"body_type":"average","shoulder_type":"broad","body_to_leg_ratio":"balanced","hand_type":"large","upper_limb_type":"toned","weight":78,"height":"1.82","waist_size":84}`, "body_type"},
+		{"weight out of range", `{"body_type":"athletic","shoulder_type":"broad","body_to_leg_ratio":"balanced","hand_type":"large","upper_limb_type":"toned","weight":900,"height":"1.82","waist_size":84}`, "weight"},
+		{"height in cm", `{"body_type":"athletic","shoulder_type":"broad","body_to_leg_ratio":"balanced","hand_type":"large","upper_limb_type":"toned","weight":78,"height":"182","waist_size":84}`, "height"},
+		{"height not a number", `{"body_type":"athletic","shoulder_type":"broad","body_to_leg_ratio":"balanced","hand_type":"large","upper_limb_type":"toned","weight":78,"height":"tall","waist_size":84}`, "height"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodePersonCharacteristics(tt.text)
+			var outputErr *StructuredOutputError
+			if !errors.As(err, &outputErr) || outputErr.Field != tt.field {
+				t.Fatalf("expected StructuredOutputError on %q, got %v", tt.field, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"letryapi/models"
+)
+
+// UserCharacteristicsDescription builds the same characteristics sentence used
+// for avatar generation from the values saved on the user, or "" if any are missing.
+func UserCharacteristicsDescription(user models.UserAccount) string {
+	if user.BodyType == nil || user.ShoulderType == nil || user.BodyToLegRatio == nil ||
+		user.HandType == nil || user.UpperLimbType == nil || user.Weight == nil ||
+		user.Height == nil || user.WaistSize == nil {
+		return ""
+	}
+	characteristics := PersonCharacteristics{
+		BodyType:       BodyType(*user.BodyType),
+		ShoulderType:   ShoulderType(*user.ShoulderType),
+		BodyToLegRatio: BodyToLegRatio(*user.BodyToLegRatio),
+		HandType:       HandType(*user.HandType),
+		UpperLimbType:  UpperLimbType(*user.UpperLimbType),
+		Weight:         *user.Weight,
+		Height:         *user.Height,
+		WaistSize:      *user.WaistSize,
+	}
+	return characteristics.ToDescriptiveSentence()
+}
+
+// TryOnCacheKey returns a deterministic key for a try-on request.
+// clothingImageKeys must be passed in a fixed slot order (top, bottom, shoes, accessory)
+// with "" for empty slots, so the same outfit always hashes to the same key.
+// promptVersion is the assigned try-on prompt version, so a new prompt never reuses old generations.
+func TryOnCacheKey(clothingImageKeys []string, avatarURL string, characteristics string, options TryOnOptions, promptVersion string) string {
+	hash := sha256.New()
+	for _, key := range clothingImageKeys {
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+	}
+	hash.Write([]byte(avatarURL))
+	hash.Write([]byte{0})
+	hash.Write([]byte(characteristics))
+	hash.Write([]byte{0})
+	for _, option := range []string{string(options.Scene), string(options.Pose), string(options.AspectRatio)} {
+		hash.Write([]byte(option))
+		hash.Write([]byte{0})
+	}
+	hash.Write([]byte(promptVersion))
+	return hex.EncodeToString(hash.Sum(nil))
+}
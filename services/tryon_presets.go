@@ -0,0 +1,129 @@
+package services
+
+import "fmt"
+
+type TryOnScene string
+
+const (
+	SceneStudioWhite TryOnScene = "studio_white"
+	SceneStreet      TryOnScene = "street"
+	SceneBeach       TryOnScene = "beach"
+	SceneOffice      TryOnScene = "office"
+	// SceneCustom places the person into a background image uploaded by the user
+	SceneCustom TryOnScene = "custom"
+)
+
+type TryOnPose string
+
+const (
+	PoseRelaxed        TryOnPose = "relaxed"
+	PoseWalking        TryOnPose = "walking"
+	PoseHandsInPockets TryOnPose = "hands_in_pockets"
+	PoseThreeQuarter   TryOnPose = "three_quarter"
+)
+
+type TryOnAspectRatio string
+
+const (
+	AspectRatio9x16 TryOnAspectRatio = "9:16"
+	AspectRatio3x4  TryOnAspectRatio = "3:4"
+	AspectRatio4x5  TryOnAspectRatio = "4:5"
+	AspectRatio1x1  TryOnAspectRatio = "1:1"
+)
+
+type TryOnScenePreset struct {
+	// how the background of the first image should be treated while editing
+	Setup string
+	// how the final background should look
+	Background string
+}
+
+var TryOnScenePresets = map[TryOnScene]TryOnScenePreset{
+	SceneStudioWhite: {
+		Setup:      "and use the same solid, flat, unlit, white first image background including ratio",
+		Background: "with on flat, consistent, all white(#FFFFFF, rgb(255,255,255)) second image background. Do not apply slight grayish gradients, keep all edges white",
+	},
+	SceneStreet: {
+		Setup:      "and place the person on a modern city street in daylight",
+		Background: "standing on a clean urban sidewalk with softly blurred buildings behind, natural daylight matching the light on the person",
+	},
+	SceneBeach: {
+		Setup:      "and place the person on a sunny beach",
+		Background: "standing on light sand with the sea and a clear sky softly blurred behind, warm natural sunlight matching the light on the person",
+	},
+	SceneOffice: {
+		Setup:      "and place the person in a bright modern office",
+		Background: "standing in a tidy modern office interior with softly blurred desks and windows behind, soft indoor light matching the light on the person",
+	},
+	SceneCustom: {
+		Setup:      "and place the person into the environment shown in the last image, the last image is only a background and not a clothing item",
+		Background: "placed naturally into the last image background with matching perspective, scale, shadows and lighting",
+	},
+}
+
+var TryOnPoseDescriptions = map[TryOnPose]string{
+	PoseRelaxed:        "straight facing the camera and relaxed, coolest, confident pose",
+	PoseWalking:        "natural mid-stride walking pose towards the camera, arms relaxed",
+	PoseHandsInPockets: "straight facing the camera, casual confident pose with hands in pockets where the clothing allows it",
+	PoseThreeQuarter:   "three-quarter angle to the camera, relaxed confident pose with face turned to the camera",
+}
+
+var TryOnAspectRatioDescriptions = map[TryOnAspectRatio]string{
+	AspectRatio9x16: "9:16 portrait size",
+	AspectRatio3x4:  "3:4 portrait size",
+	AspectRatio4x5:  "4:5 portrait size",
+	AspectRatio1x1:  "1:1 square size",
+}
+
+// TryOnOptions holds the presentation presets of a try-on generation.
+// Empty values fall back to the defaults (white studio, relaxed pose, 9:16).
+type TryOnOptions struct {
+	Scene       TryOnScene
+	Pose        TryOnPose
+	AspectRatio TryOnAspectRatio
+	// local path to the uploaded background, used only with SceneCustom
+	BackgroundImagePath string
+}
+
+// WithDefaults returns options with unknown or empty presets replaced by the defaults.
+// A custom scene without a background is an error, the user asked for that background.
+func (o TryOnOptions) WithDefaults() (TryOnOptions, error) {
+	if _, ok := TryOnScenePresets[o.Scene]; !ok {
+		o.Scene = SceneStudioWhite
+	}
+	if o.Scene == SceneCustom && o.BackgroundImagePath == "" {
+		return o, fmt.Errorf("%w: custom scene without a background image", ErrAssetMissing)
+	}
+	if _, ok := TryOnPoseDescriptions[o.Pose]; !ok {
+		o.Pose = PoseRelaxed
+	}
+	if _, ok := TryOnAspectRatioDescriptions[o.AspectRatio]; !ok {
+		o.AspectRatio = AspectRatio9x16
+	}
+	return o, nil
+}
+
+// TryOnPromptData holds the values the try-on prompt template is rendered with.
+type TryOnPromptData struct {
+	Characteristics string
+	SceneSetup      string
+	SceneBackground string
+	Pose            string
+	AspectRatio     string
+}
+
+// NewTryOnPromptData maps the person characteristics and chosen presets to prompt fragments.
+func NewTryOnPromptData(characteristics string, options TryOnOptions) (TryOnPromptData, error) {
+	options, err := options.WithDefaults()
+	if err != nil {
+		return TryOnPromptData{}, err
+	}
+	scene := TryOnScenePresets[options.Scene]
+	return TryOnPromptData{
+		Characteristics: characteristics,
+		SceneSetup:      scene.Setup,
+		SceneBackground: scene.Background,
+		Pose:            TryOnPoseDescriptions[options.Pose],
+		AspectRatio:     TryOnAspectRatioDescriptions[options.AspectRatio],
+	}, nil
+}
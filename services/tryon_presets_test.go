@@ -0,0 +1,28 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTryOnOptionsWithDefaults(t *testing.T) {
+	options, err := TryOnOptions{Scene: "moon", Pose: "", AspectRatio: "2:1"}.WithDefaults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.Scene != SceneStudioWhite || options.Pose != PoseRelaxed || options.AspectRatio != AspectRatio9x16 {
+		t.Fatalf("unexpected defaults %+v", options)
+	}
+
+	// the user asked for their own background, a studio one instead would be a different try on
+	if _, err := (TryOnOptions{Scene: SceneCustom}).WithDefaults(); !errors.Is(err, ErrAssetMissing) {
+		t.Fatalf("expected a missing background error, got %v", err)
+	}
+	if _, err := NewTryOnPromptData("", TryOnOptions{Scene: SceneCustom}); err == nil {
+		t.Fatal("expected an error for the prompt of a custom scene without background")
+	}
+	options, err = TryOnOptions{Scene: SceneCustom, BackgroundImagePath: "/tmp/background.png"}.WithDefaults()
+	if err != nil || options.Scene != SceneCustom {
+		t.Fatalf("expected the custom scene, got %+v, %v", options, err)
+	}
+}
@@ -3,6 +3,7 @@ package tasks
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"letryapi/models"
@@ -12,12 +13,15 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	firebase "firebase.google.com/go/v4"
 	"github.com/getsentry/sentry-go"
 	"github.com/hibiken/asynq"
+	"golang.org/x/sync/errgroup"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type TryOnGenerationPayload struct {
@@ -30,6 +34,8 @@ type ClothingGenerationPayload struct {
 
 type UserAvatarGeneratePayload struct {
 	UserID uint `json:"user_id"`
+	// empty for tasks queued before saved avatars, the current user avatar is processed then
+	AvatarID uint `json:"avatar_id"`
 }
 
 type IdentifyClothingPayload struct {
@@ -41,23 +47,30 @@ func NewClient() (*asynq.Client, error) {
 	return asynq.NewClient(asynq.RedisClientOpt{Addr: "your-redis-connection-string"}), nil
 }
 
+// Deadlines of the task ctx. The generation tasks may run the model up to 1+maxQualityRegenerations times,
+// each call bounded by services.LLMGenerateTimeout, the identify task runs it once.
+const (
+	generationTaskTimeout = 15 * time.Minute
+	identifyTaskTimeout   = 5 * time.Minute
+)
+
 // EnqueueTranscribeNote enqueues a clothing for processing
 func NewTryOnGenerationTask(userID uint, tryOnID uint) (*asynq.Task, error) {
 	payload, err := json.Marshal(TryOnGenerationPayload{TryOnID: tryOnID, UserID: userID})
 	if err != nil {
 		return nil, err
 	}
-	return asynq.NewTask("generate:tryon", payload), nil
+	return asynq.NewTask("generate:tryon", payload, asynq.TaskID(TryOnTaskID(tryOnID)), asynq.Timeout(generationTaskTimeout)), nil
 
 }
 
 // EnqueueTranscribeNote enqueues a clothing for processing
-func NewFullBodyAvatarGenerateTask(userID uint) (*asynq.Task, error) {
-	payload, err := json.Marshal(UserAvatarGeneratePayload{UserID: userID})
+func NewFullBodyAvatarGenerateTask(userID uint, avatarID uint) (*asynq.Task, error) {
+	payload, err := json.Marshal(UserAvatarGeneratePayload{UserID: userID, AvatarID: avatarID})
 	if err != nil {
 		return nil, err
 	}
-	return asynq.NewTask("generate:avatar", payload), nil
+	return asynq.NewTask("generate:avatar", payload, asynq.Timeout(generationTaskTimeout)), nil
 
 }
 
@@ -66,7 +79,7 @@ func NewClothingProcessingTask(clothingId uint) (*asynq.Task, error) {
 	if err != nil {
 		return nil, err
 	}
-	return asynq.NewTask("generate:process_clothing", payload), nil
+	return asynq.NewTask("generate:process_clothing", payload, asynq.TaskID(ClothingProcessingTaskID(clothingId)), asynq.Timeout(generationTaskTimeout)), nil
 
 }
 
@@ -75,24 +88,76 @@ func NewIdentifyClothingTask(clothingId uint) (*asynq.Task, error) {
 	if err != nil {
 		return nil, err
 	}
-	return asynq.NewTask("generate:identify_clothing", payload), nil
+	return asynq.NewTask("generate:identify_clothing", payload, asynq.TaskID(IdentifyClothingTaskID(clothingId)), asynq.Timeout(identifyTaskTimeout)), nil
+}
+
+// NewExpireUploadsTask is scheduled by the worker to expire uploads that were never confirmed
+func NewExpireUploadsTask() *asynq.Task {
+	return asynq.NewTask("maintenance:expire_uploads", []byte{}, asynq.Queue("generate"), asynq.MaxRetry(0))
+}
+
+// TryOnTaskID is the queue task id of a try-on generation, so it can be found again to cancel it
+func TryOnTaskID(tryOnID uint) string {
+	return fmt.Sprintf("tryon:%v", tryOnID)
 }
 
-func fetchR2File(awsService services.AWSServiceProvider, r2FilePath *string, entityLog string) ([]byte, string, error) {
+// ClothingProcessingTaskID is the queue task id of a clothing processing, so it can be found again to cancel it
+func ClothingProcessingTaskID(clothingId uint) string {
+	return fmt.Sprintf("process_clothing:%v", clothingId)
+}
+
+// IdentifyClothingTaskID is the queue task id of a clothing identification, so a repeated confirm-upload does not queue it twice
+func IdentifyClothingTaskID(clothingId uint) string {
+	return fmt.Sprintf("identify_clothing:%v", clothingId)
+}
+
+// CancelQueuedTask deletes the task if it is still waiting in the queue, or cancels it when a worker is already running it.
+// Tasks that are not found have already finished, so there is nothing to cancel.
+func CancelQueuedTask(inspector *asynq.Inspector, queue string, taskID string) error {
+	info, err := inspector.GetTaskInfo(queue, taskID)
+	if errors.Is(err, asynq.ErrTaskNotFound) || errors.Is(err, asynq.ErrQueueNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.State == asynq.TaskStateActive {
+		return inspector.CancelProcessing(taskID)
+	}
+	return inspector.DeleteTask(queue, taskID)
+}
+
+func isTryOnCancelled(db *gorm.DB, tryOnID uint) (bool, error) {
+	var status string
+	if err := db.Model(&models.ClothingTryonGeneration{}).Where("id = ?", tryOnID).Select("status").Scan(&status).Error; err != nil {
+		return false, fmt.Errorf("failed to check the try on status: %w", err)
+	}
+	return status == "cancelled", nil
+}
+
+func isClothingProcessingCancelled(db *gorm.DB, clothingId uint) (bool, error) {
+	var processingStatus string
+	if err := db.Model(&models.Clothing{}).Where("id = ?", clothingId).Select("processing_status").Scan(&processingStatus).Error; err != nil {
+		return false, fmt.Errorf("failed to check the processing status: %w", err)
+	}
+	return processingStatus == "cancelled", nil
+}
+
+func fetchR2FileContext(ctx context.Context, awsService services.AWSServiceProvider, r2FilePath *string, entityLog string) ([]byte, string, error) {
 	bucketName := os.Getenv("R2_BUCKET_NAME")
 	fmt.Printf("[R2: %v] Bucket name: %s\n", entityLog, bucketName)
 	fmt.Printf("[R2: %v] Request presigned download url.. ", entityLog)
 	if r2FilePath == nil {
-		return nil, "", fmt.Errorf("[Clothing: %v] File URL is nil", entityLog)
+		return nil, "", fmt.Errorf("[Clothing: %v] %w: file URL is nil", entityLog, services.ErrAssetMissing)
 	}
-	fileUrl, err := awsService.GetPresignedR2FileReadURL(context.TODO(), bucketName, *r2FilePath)
+	fileUrl, err := awsService.GetPresignedR2FileReadURL(ctx, bucketName, *r2FilePath)
 	fileName := filepath.Base(*r2FilePath)
 	if err != nil {
 		sentry.CaptureException(fmt.Errorf("[Clothing: %v] Error on getting presigned URL for file %s", entityLog, *r2FilePath))
 		return nil, fileName, err
 	}
 	fmt.Printf("Downloading... %s\n", fileUrl)
-	fileBytes, err := services.ReadFileFromUrl(fileUrl)
+	fileBytes, err := services.ReadFileFromUrlContext(ctx, fileUrl)
 	if err != nil {
 		sentry.CaptureException(fmt.Errorf("[Clothing: %v] Error on downloading file %s: %v", entityLog, *r2FilePath, err))
 		return nil, fileName, err
@@ -101,6 +166,181 @@ func fetchR2File(awsService services.AWSServiceProvider, r2FilePath *string, ent
 	return fileBytes, fileName, nil
 }
 
+// tryOnAsset is an R2 file the try-on worker needs locally, path receives the temp file path
+type tryOnAsset struct {
+	label string
+	key   *string
+	path  *string
+}
+
+// maxConcurrentR2Fetches bounds the parallel downloads of a single task
+const maxConcurrentR2Fetches = 4
+
+// fetchR2FileToTemp waits until the key is visible in R2, downloads it and writes it to a temp file.
+func fetchR2FileToTemp(ctx context.Context, awsService services.AWSServiceProvider, r2FilePath *string, entityLog string) (string, error) {
+	if r2FilePath == nil {
+		return "", fmt.Errorf("[Clothing: %v] %w: file URL is nil", entityLog, services.ErrAssetMissing)
+	}
+	bucketName := os.Getenv("R2_BUCKET_NAME")
+	if _, err := services.WaitForR2Object(ctx, awsService, bucketName, *r2FilePath); err != nil {
+		return "", err
+	}
+	fileBytes, fileName, err := fetchR2FileContext(ctx, awsService, r2FilePath, entityLog)
+	if err != nil {
+		return "", err
+	}
+	fileBytes, fileName, err = services.NormalizeImageForLLM(fileBytes, fileName)
+	if err != nil {
+		return "", err
+	}
+	return services.CreateTempFile(fileBytes, fileName)
+}
+
+// taskFailMessage is the user message of a failed step, the failure kinds of services get their own message
+// and everything else the fallback of the step
+func taskFailMessage(err error, fallback string) string {
+	var formatErr *services.UnsupportedImageFormatError
+	switch {
+	case errors.As(err, &formatErr):
+		return "This photo format is not supported, please upload a JPEG, PNG, WebP or HEIC photo"
+	case errors.Is(err, services.ErrContentBlocked):
+		return "Sorry, it seems that this image contains violated content that we cannot process."
+	case errors.Is(err, services.ErrNoPersonDetected):
+		return "No person detected in the image, please try to upload new avatar"
+	case errors.Is(err, services.ErrAssetMissing):
+		return "The uploaded image could not be found, please upload it again"
+	}
+	return fallback
+}
+
+// taskError is the error a handler returns to asynq for a failed step. Failures another attempt can't fix,
+// the permanent failure kinds and deleted rows, are wrapped with asynq.SkipRetry. The handlers save the
+// failed status before, see taskFailMessage, and return nil only when there was nothing to do.
+// Throttled model calls (services.ErrLLMUnavailable) are returned as they are without saving a failure,
+// nothing was sent and the worker re-queues the task once the model may be called again, see cmd/worker.
+func taskError(err error) error {
+	if services.IsPermanentFailure(err) || errors.Is(err, gorm.ErrRecordNotFound) {
+		return skipRetry(err)
+	}
+	return err
+}
+
+func skipRetry(err error) error {
+	return fmt.Errorf("%w: %w", err, asynq.SkipRetry)
+}
+
+// fetchTryOnAssets downloads the assets concurrently and stores the temp file paths into them.
+// The first failure cancels the remaining downloads. The returned temp files must be removed
+// by the caller even when an error is returned.
+func fetchTryOnAssets(ctx context.Context, awsService services.AWSServiceProvider, assets []tryOnAsset, entityLog string) ([]string, error) {
+	var mu sync.Mutex
+	var tempFiles []string
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxConcurrentR2Fetches)
+	for _, asset := range assets {
+		g.Go(func() error {
+			path, err := fetchR2FileToTemp(gctx, awsService, asset.key, fmt.Sprintf("%s-%s", entityLog, asset.label))
+			if err != nil {
+				return fmt.Errorf("failed to fetch %s: %w", asset.label, err)
+			}
+			mu.Lock()
+			tempFiles = append(tempFiles, path)
+			mu.Unlock()
+			*asset.path = path
+			return nil
+		})
+	}
+	err := g.Wait()
+	return tempFiles, err
+}
+
+// companyLLMChain returns the models to try in order for the operation of the company: the chain of the company
+// for the operation or the global one, see services.LLMFallbackChain, led by the model enforced for the company.
+// Over the monthly LLM budget with the downgrade action every model is replaced by its cheaper one.
+// Models of the wrong kind for the operation or without a registered backend are left out.
+func companyLLMChain(db *gorm.DB, llmProcessor services.LLMProcessor, company models.Company, operation string, entityLog string) []services.LLMModelName {
+	defaultModel := services.DefaultLLMFallbackChains[operation][0]
+	var chain []services.LLMModelName
+	if company.EnforcedLLMModel != nil {
+		chain = append(chain, services.LLMModelName(*company.EnforcedLLMModel))
+	}
+	if ids := company.LLMFallbackChains[operation]; len(ids) > 0 {
+		for _, id := range ids {
+			chain = append(chain, services.LLMModelName(id))
+		}
+	} else {
+		chain = append(chain, services.LLMFallbackChain(operation)...)
+	}
+
+	registry, _ := llmProcessor.(services.LLMModelChecker)
+	downgrade := overLLMBudgetWithDowngrade(db, company, entityLog)
+	var usable []services.LLMModelName
+	seen := map[services.LLMModelName]bool{}
+	for _, model := range chain {
+		if cheaper, ok := services.DowngradeLLMModel(model); downgrade && ok {
+			if registry == nil || registry.Has(cheaper) {
+				fmt.Printf("[%s] [LLM BUDGET] Monthly budget exceeded, downgrading %s to %s\n", entityLog, model, cheaper)
+				model = cheaper
+			} else {
+				fmt.Printf("[%s] [LLM BUDGET] No backend registered for %s, keeping %s\n", entityLog, cheaper, model)
+			}
+		}
+		switch {
+		case seen[model]:
+		case model.IsImageModel() != defaultModel.IsImageModel():
+			fmt.Printf("[%s] [LLM MODEL] %s can't be used for %s, skipping it\n", entityLog, model, operation)
+		case registry != nil && !registry.Has(model):
+			fmt.Printf("[%s] [LLM MODEL] No backend registered for %s, skipping it\n", entityLog, model)
+		default:
+			usable = append(usable, model)
+		}
+		seen[model] = true
+	}
+	if len(usable) == 0 {
+		fmt.Printf("[%s] [LLM MODEL] No usable model for %s, using the default model\n", entityLog, operation)
+		return []services.LLMModelName{defaultModel}
+	}
+	return usable
+}
+
+// overLLMBudgetWithDowngrade tells whether the company is over its monthly LLM budget and chose cheaper models for it
+func overLLMBudgetWithDowngrade(db *gorm.DB, company models.Company, entityLog string) bool {
+	if company.LLMBudgetAction != services.LLMBudgetActionDowngrade {
+		return false
+	}
+	status, err := services.GetLLMBudgetStatus(db, company, time.Now())
+	if err != nil {
+		sentry.CaptureException(fmt.Errorf("[%s] Error on loading the LLM budget: %v", entityLog, err))
+		return false
+	}
+	return status != nil && status.Exceeded()
+}
+
+// llmUsageScope is the ledger scope of a task, zero ids are left empty
+func llmUsageScope(companyID, userID, entityID uint) services.LLMUsageScope {
+	var scope services.LLMUsageScope
+	if companyID != 0 {
+		scope.CompanyID = &companyID
+	}
+	if userID != 0 {
+		scope.UserID = &userID
+	}
+	if entityID != 0 {
+		scope.EntityID = &entityID
+	}
+	return scope
+}
+
+func removeTempFiles(paths []string, entityLog string) {
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil {
+			fmt.Printf("[%s] Error removing temporary file %s: %v\n", entityLog, path, err)
+		} else {
+			fmt.Printf("[%s] Successfully removed temporary file %s\n", entityLog, path)
+		}
+	}
+}
+
 // extractYoutubeID parses YouTube ID from various URL formats
 func ExtractYoutubeID(youtubeURL string) (string, error) {
 	// Regular expressions for different YouTube URL formats
@@ -166,134 +406,155 @@ func cleanAIResponseText(text string) string {
 func ProcessAvatarTask(
 	ctx context.Context, t *asynq.Task, db *gorm.DB, transcriber services.LLMProcessor,
 	awsService services.AWSServiceProvider, fbApp *firebase.App) error {
-	google_key := os.Getenv("GOOGLE_API_KEY")
-	if google_key == "" {
-		sentry.CaptureException(fmt.Errorf("[QUEUE] %s Google API key is not set", string(t.Payload())))
-		return fmt.Errorf("[QUEUE] %s Google API key is not set", string(t.Payload()))
-	}
 	var payload UserAvatarGeneratePayload
 	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
-		return err
+		return skipRetry(err)
 	}
 	fmt.Printf("[Avatar: %v] Start Processing\n", payload.UserID)
 	var user models.UserAccount
 	res := db.First(&user, payload.UserID)
 	if res.Error != nil {
 		sentry.CaptureException(fmt.Errorf("[QUEUE] Avatar: error on retrieving user for processing %v", payload.UserID))
-		return res.Error
-	}
-	if user.UserFullBodyImageURL == nil {
-		saveUserAvatarProcessingFail(db, user, "Failed to identify your avatar image, please try to upload new avatar", false)
-		sentry.CaptureException(fmt.Errorf("[Avatar: %v] Error on getting user image for processing", payload.UserID))
-		return fmt.Errorf("[Avatar: %v] Error on getting user image", payload.UserID)
+		return taskError(res.Error)
 	}
-	time.Sleep(2 * time.Second) // wait for r2 to be ready
-	fileBytes, fileName, err := fetchR2File(awsService, user.UserFullBodyImageURL, "User ID "+fmt.Sprint(payload.UserID))
+	avatar, err := avatarForProcessing(db, user, payload.AvatarID)
 	if err != nil {
-		fmt.Printf("[Avatar: %v] Error on getting file from R2 %s: %v\n", payload.UserID, *user.UserFullBodyImageURL, err)
-		saveUserAvatarProcessingFail(db, user, "Failed to read clothing image, please try to create new clothing", false)
-		sentry.CaptureException(fmt.Errorf("[Avatar: %v] File path exists, but error on getting file %s: %v", payload.UserID, *user.UserFullBodyImageURL, err))
-		return err
+		saveUserAvatarProcessingFail(db, user, avatar, "Failed to identify your avatar image, please try to upload new avatar", false)
+		sentry.CaptureException(fmt.Errorf("[Avatar: %v] Error on getting user avatar for processing: %v", payload.UserID, err))
+		return taskError(err)
 	}
-	fmt.Printf("[Avatar: %v] Downloaded file size: %d bytes\n", payload.UserID, len(fileBytes))
-	imgPath, err := services.CreateTempFile(fileBytes, fileName)
-	// clean defer file after processing
-	defer func(path string) {
-		if err := os.Remove(path); err != nil {
-			fmt.Printf("[Avatar: %v] Error removing temporary file %s: %v\n", payload.UserID, path, err)
-		} else {
-			fmt.Printf("[Avatar: %v] Successfully removed temporary file %s\n", payload.UserID, path)
-		}
-	}(imgPath)
-
+	fmt.Printf("[Avatar: %v] Processing avatar %v\n", payload.UserID, avatar.ID)
+	imgPath, err := fetchR2FileToTemp(ctx, awsService, &avatar.SourceImageURL, "User ID "+fmt.Sprint(payload.UserID))
 	if err != nil {
-		saveUserAvatarProcessingFail(db, user, "Failed to read your clothing files, please try to create new clothing", true)
-		sentry.CaptureException(fmt.Errorf("[Avatar: %v] Error extracting documents from zip %s: %v", payload.UserID, *user.UserFullBodyImageURL, err))
-		return err
+		fmt.Printf("[Avatar: %v] Error on getting file from R2 %s: %v\n", payload.UserID, avatar.SourceImageURL, err)
+		saveUserAvatarProcessingFail(db, user, avatar, taskFailMessage(err, "Failed to read your avatar image, please try to upload new avatar"), !services.IsPermanentFailure(err))
+		sentry.CaptureException(fmt.Errorf("[Avatar: %v] File path exists, but error on getting file %s: %v", payload.UserID, avatar.SourceImageURL, err))
+		return taskError(err)
 	}
+	// clean defer file after processing
+	defer removeTempFiles([]string{imgPath}, fmt.Sprintf("Avatar: %v", payload.UserID))
+	ctx = services.WithImageSources(ctx, map[string]string{imgPath: avatar.SourceImageURL})
 
 	var clothingLLMResponseText string
 	var clothingLLMResponse *services.LLMResponse
 
 	fmt.Printf("[Avatar: %v] Transform to e-commerce style avatar..\n", payload.UserID)
-	model := services.Flash25Image
-	modelString := model.String()
-	// if user.EnforcedLLMModel != nil {
-	// 	model = services.LLMModelName(*user.Company.EnforcedLLMModel)
-	// 	modelString = model.String()
-	// 	fmt.Printf("[Avatar: %v] [ENFORCE MODEL] Using enforced model: %s\n", payload.UserID, model.String())
-	// }
+	var membership models.UserCompanyRole
+	db.Joins("Company").Where("user_account_id = ?", user.ID).Limit(1).Find(&membership)
+	entityLog := fmt.Sprintf("Avatar: %v", payload.UserID)
+	ctx = services.WithLLMUsageScope(ctx, llmUsageScope(membership.CompanyID, user.ID, avatar.ID))
+	chain := companyLLMChain(db, transcriber, membership.Company, services.LLMOperationAvatar, entityLog)
+	characteristicsChain := companyLLMChain(db, transcriber, membership.Company, services.LLMOperationPersonCharacteristics, entityLog)
 
-	fmt.Printf("[Avatar: %v] Model: %s\n", payload.UserID, modelString)
-	// }
+	fmt.Printf("[Avatar: %v] Models: %v, characteristics: %v\n", payload.UserID, chain, characteristicsChain)
 
-	fmt.Printf("[Avatar: %v] Avatar url %s\n", payload.UserID, *user.UserFullBodyImageURL)
+	fmt.Printf("[Avatar: %v] Avatar url %s\n", payload.UserID, avatar.SourceImageURL)
 	fmt.Printf("[Avatar: %v] Downloaded avatar: %v\n", payload.UserID, imgPath)
 
 	// Analyze person characteristics first
 	fmt.Printf("[Avatar: %v] Analyzing person characteristics...\n", payload.UserID)
-	characteristics, err := transcriber.AnalyzePersonCharacteristics(imgPath, services.Pro25)
+	promptRegistry := services.NewPromptRegistry(db)
+	characteristicsPromptVersion := promptRegistry.Assign(services.PromptPersonCharacteristics)
+	characteristicsPrompt, err := promptRegistry.Render(services.PromptPersonCharacteristics, characteristicsPromptVersion, nil)
+	if err != nil {
+		saveUserAvatarProcessingFail(db, user, avatar, "Failed to analyze person characteristics, please try again", false)
+		sentry.CaptureException(fmt.Errorf("[Avatar: %v] Error on rendering characteristics prompt %s: %v", payload.UserID, characteristicsPromptVersion, err))
+		return skipRetry(err)
+	}
+	characteristicsResponse, characteristicsModel, err := services.CallWithFallback(ctx, characteristicsChain, entityLog, func(model services.LLMModelName) (*services.LLMResponse, error) {
+		response, err := transcriber.AnalyzePersonCharacteristics(ctx, imgPath, characteristicsPrompt, model)
+		if err == nil && response.Characteristics == nil {
+			response.Characteristics, err = services.DecodePersonCharacteristics(response.Response)
+		}
+		return response, err
+	})
 	if err != nil {
+		if errors.Is(err, services.ErrLLMUnavailable) {
+			return err
+		}
 		fmt.Printf("[Avatar: %v] Error analyzing person characteristics: %v\n", payload.UserID, err)
-		saveUserAvatarProcessingFail(db, user, "Failed to analyze person characteristics, please try again", true)
-		return err
+		fallback := "Failed to analyze person characteristics, please try again"
+		if errors.Is(err, services.ErrParseFailure) {
+			// the answer already had to follow the schema, another attempt is unlikely to do better
+			fallback = "We could not read the body proportions from this photo, please upload a full body photo"
+		}
+		saveUserAvatarProcessingFail(db, user, avatar, taskFailMessage(err, fallback), !services.IsPermanentFailure(err))
+		sentry.CaptureException(fmt.Errorf("[Avatar: %v] Error analyzing %s characteristics: %w", payload.UserID, characteristicsModel.String(), err))
+		return taskError(err)
 	}
+	characteristics := characteristicsResponse.Characteristics
 	fmt.Printf("[Avatar: %v] Person characteristics: %+v\n", payload.UserID, characteristics)
 
-	// Save characteristics to user model
+	// Save characteristics to the avatar, mirrored to the user when it is the default one
 	bodyTypeStr := string(characteristics.BodyType)
 	shoulderTypeStr := string(characteristics.ShoulderType)
 	bodyToLegRatioStr := string(characteristics.BodyToLegRatio)
 	handTypeStr := string(characteristics.HandType)
 	upperLimbTypeStr := string(characteristics.UpperLimbType)
 
-	user.BodyType = &bodyTypeStr
-	user.ShoulderType = &shoulderTypeStr
-	user.BodyToLegRatio = &bodyToLegRatioStr
-	user.HandType = &handTypeStr
-	user.UpperLimbType = &upperLimbTypeStr
-	user.Weight = &characteristics.Weight
-	user.Height = &characteristics.Height
-	user.WaistSize = &characteristics.WaistSize
+	avatar.BodyType = &bodyTypeStr
+	avatar.ShoulderType = &shoulderTypeStr
+	avatar.BodyToLegRatio = &bodyToLegRatioStr
+	avatar.HandType = &handTypeStr
+	avatar.UpperLimbType = &upperLimbTypeStr
+	avatar.Weight = &characteristics.Weight
+	avatar.Height = &characteristics.Height
+	avatar.WaistSize = &characteristics.WaistSize
 
 	// Generate descriptive sentence for avatar generation
 	characteristicsDescription := characteristics.ToDescriptiveSentence()
 	fmt.Printf("[Avatar: %v] Characteristics description: %s\n", payload.UserID, characteristicsDescription)
 
-	clothingLLMResponse, err = transcriber.ProcessAvatarTaskWithCharacteristics(imgPath, characteristicsDescription, services.Flash25Image)
-	fmt.Printf("[Avatar: %v] Images length: %d", payload.UserID, len(clothingLLMResponse.Images))
-	fmt.Println("Images length:", len(clothingLLMResponse.Images))
+	avatar.CharacteristicsPromptVersion = &characteristicsPromptVersion
+
+	avatarPromptVersion := promptRegistry.Assign(services.PromptAvatarCharacteristics)
+	avatarPrompt, err := promptRegistry.Render(services.PromptAvatarCharacteristics, avatarPromptVersion, map[string]string{"Characteristics": characteristicsDescription})
 	if err != nil {
-		sentry.CaptureException(fmt.Errorf("[Avatar: %v] Error on generating study material %s: %v", payload.UserID, "", err))
-		saveUserAvatarProcessingFail(db, user, "Failed to generate avatar, please try again", true)
-		return err
+		saveUserAvatarProcessingFail(db, user, avatar, "Failed to generate avatar, please try again", false)
+		sentry.CaptureException(fmt.Errorf("[Avatar: %v] Error on rendering avatar prompt %s: %v", payload.UserID, avatarPromptVersion, err))
+		return skipRetry(err)
 	}
-	clothingLLMResponseText = clothingLLMResponse.Response
-	if strings.Contains(clothingLLMResponseText, "NO_PERSON") {
-		saveUserAvatarProcessingFail(db, user, "No person detected in the image, please try to upload new avatar", false)
-		sentry.CaptureException(fmt.Errorf("[Avatar: %v] No person detected in the image on generating tryon %s: %v", payload.UserID, "", err))
-		return fmt.Errorf("[Avatar: %v] No person detected in the image on generating tryon %s: %v", payload.UserID, "", err)
+	fmt.Printf("[Avatar: %v] Prompt versions: characteristics %s, avatar %s\n", payload.UserID, characteristicsPromptVersion, avatarPromptVersion)
+	avatar.PromptVersion = &avatarPromptVersion
+
+	clothingLLMResponse, model, err := services.CallWithFallback(ctx, chain, entityLog, func(model services.LLMModelName) (*services.LLMResponse, error) {
+		return services.RequireImages(transcriber.ProcessAvatarTaskWithCharacteristics(ctx, imgPath, avatarPrompt, model))
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrLLMUnavailable) {
+			return err
+		}
+		sentry.CaptureException(fmt.Errorf("[Avatar: %v] Error on generating avatar: %v", payload.UserID, err))
+		saveUserAvatarProcessingFail(db, user, avatar, taskFailMessage(err, "Failed to generate avatar, please try again"), !services.IsPermanentFailure(err))
+		return taskError(err)
 	}
+	fmt.Printf("[Avatar: %v] Images length: %d", payload.UserID, len(clothingLLMResponse.Images))
+	fmt.Println("Images length:", len(clothingLLMResponse.Images))
+	clothingLLMResponseText = clothingLLMResponse.Response
 	if clothingLLMResponseText != "" {
 		fmt.Printf("[Avatar: %v] Response is nil no issues %s: %s", payload.UserID, "", clothingLLMResponseText)
 	}
-	if len(clothingLLMResponse.Images) == 0 {
-		sentry.CaptureException(fmt.Errorf("[Avatar: %v] Response image is nil or empty on generating try on %s: %v", payload.UserID, "", err))
-		saveUserAvatarProcessingFail(db, user, "Failed to generate generating preview, please try again", true)
-		return fmt.Errorf("[Avatar: %v] Response image is nil or empty on generating try on %s: %v", payload.UserID, "", err)
-	}
 	if len(clothingLLMResponse.Images) > 1 {
 		fmt.Printf("[Avatar: %v] Warning: More than 1 image returned, using the first one\n", payload.UserID)
 	}
+	clothingLLMResponse, model, avatar.QualityRegenerations, avatar.QualityCheckFailReason, err = regenerateUntilQualityPasses(
+		ctx, entityLog, clothingLLMResponse, model,
+		services.ImageQualityOptions{AspectRatio: services.AspectRatio9x16, WhiteBackground: true},
+		func() (*services.LLMResponse, services.LLMModelName, error) {
+			return services.CallWithFallback(ctx, chain, entityLog, func(model services.LLMModelName) (*services.LLMResponse, error) {
+				return services.RequireImages(transcriber.ProcessAvatarTaskWithCharacteristics(ctx, imgPath, avatarPrompt, model))
+			})
+		},
+	)
+	if err != nil {
+		return err
+	}
 	generatedImageBytes := clothingLLMResponse.Images[0]
-	// hard threshold which makes everything above 244 white,
-	// below will be smoothed out
-	var threshold uint8 = 244
-	var blurSigma float64 = 4.0 // adjust for blurring
-	whitenedAvatarBytes, err := services.WhitenBackgroundSmooth(generatedImageBytes, threshold, blurSigma)
+	whitenedAvatarBytes, err := services.WhitenBackgroundSmooth(generatedImageBytes, backgroundThreshold, backgroundBlurSigma)
 	if err != nil {
 		fmt.Printf("[Avatar: %v] Error on whitening background: %v\n", payload.UserID, err)
-		saveUserAvatarProcessingFail(db, user, "Failed to process the background, please try again", true)
+		saveUserAvatarProcessingFail(db, user, avatar, "Failed to process the background, please try again", true)
+		return err
 	}
 	// err = os.WriteFile("nanobanana.png", generatedImageBytes, 0644)
 	// if err != nil {
@@ -303,44 +564,53 @@ func ProcessAvatarTask(
 	fmt.Println("Successfully wrote data to file1.txt")
 	var bucketName = services.GetEnv("R2_BUCKET_NAME", "")
 	// todo clean and map the same file name as in FE UI otherwise **FAIL**
-	safeFileName := fmt.Sprintf("/user/%v/generation/%s", user.ID, "generation.png")
+	safeFileName := fmt.Sprintf("/user/%v/avatars/%v/%s", user.ID, avatar.ID, "generation.png")
 
-	uploadUrl, presignErr := awsService.PresignLink(context.Background(), bucketName, safeFileName)
+	uploadUrl, presignErr := awsService.PresignLink(ctx, bucketName, safeFileName)
 	if presignErr != nil {
-		saveUserAvatarProcessingFail(db, user, "Failed to upload generated avatar, please try again", true)
+		saveUserAvatarProcessingFail(db, user, avatar, "Failed to upload generated avatar, please try again", true)
 		fmt.Printf("[Avatar: %v]  Unable to create presign link for tryon %s!\n", user.ID, presignErr)
 		sentry.CaptureException(fmt.Errorf("[Clothing: %v] Unable to create presign for tryon %s", payload.UserID, presignErr))
 		return presignErr
 	}
 	// parse file from Output of ytdlp file path in fmt.Sprintf("clothing-%v.%%(ext)s", clothing.ID)
-	respBody, statusCode, err := awsService.UploadToPresignedURL(context.Background(), bucketName, uploadUrl, whitenedAvatarBytes)
+	respBody, statusCode, err := awsService.UploadToPresignedURL(ctx, bucketName, uploadUrl, whitenedAvatarBytes)
 	fmt.Printf("[Avatar: %v] R2 Upload response body: %s, status code: %v\n", payload.UserID, respBody, statusCode)
 	if err != nil || statusCode > 299 {
-		saveUserAvatarProcessingFail(db, user, "Failed to upload generated avatar, please try again", true)
+		err = uploadError(safeFileName, statusCode, err)
+		saveUserAvatarProcessingFail(db, user, avatar, "Failed to upload generated avatar, please try again", true)
 		fmt.Printf("[Avatar: %v] Error on uploading file not success code or err %s: %v\n", payload.UserID, safeFileName, err)
-		sentry.CaptureException(fmt.Errorf("[Avatar: %v] Error on uploading file %s: %v", payload.UserID, safeFileName, err))
+		sentry.CaptureException(fmt.Errorf("[Avatar: %v] Error on uploading file %s: %w", payload.UserID, safeFileName, err))
 		return err
 	}
-	time.Sleep(1 * time.Second) // wait for r2 to be ready
-	fetchR2File(awsService, &safeFileName, "Avatar-FetchCheck")
-	// fmt.Printf("[Avatar: %v] Success.. Removing local one\n", payload.UserID)
-	user.UserFullBodyImageURL = &safeFileName
-	user.FullBodyAvatarStatus = "completed"
-
-	user.LLMTotalTokenCount = &clothingLLMResponse.TotalTokenCount
-	user.LLMInputTokenCount = &clothingLLMResponse.InputTokenCount
-	user.LLMThoughtsTokenCount = &clothingLLMResponse.ThoughtsTokenCount
-	user.LLMOutputTokenCount = &clothingLLMResponse.OutputTokenCount
-	user.LLMThoughts = &clothingLLMResponse.Thoughts
-	user.LLMModel = &modelString
-
-	// save question from llm
+	if _, err := services.WaitForR2Object(ctx, awsService, bucketName, safeFileName); err != nil {
+		fmt.Printf("[Avatar: %v] Uploaded avatar is not visible yet %s: %v\n", payload.UserID, safeFileName, err)
+	}
+	transparentFileName := fmt.Sprintf("/user/%v/avatars/%v/%s", user.ID, avatar.ID, "transparent.png")
+	if err := uploadTransparentVariant(ctx, awsService, generatedImageBytes, transparentFileName); err != nil {
+		// the white avatar is enough for try ons, the transparent one is optional
+		fmt.Printf("[Avatar: %v] Error on storing transparent avatar: %v\n", payload.UserID, err)
+		sentry.CaptureException(fmt.Errorf("[Avatar: %v] Error on storing transparent avatar: %v", payload.UserID, err))
+	} else {
+		avatar.TransparentImageURL = &transparentFileName
+	}
+	avatar.ImageURL = &safeFileName
+	avatar.Status = "completed"
+	avatar.ProcessingErrorMessage = nil
+
+	avatar.LLMTotalTokenCount = &clothingLLMResponse.TotalTokenCount
+	avatar.LLMInputTokenCount = &clothingLLMResponse.InputTokenCount
+	avatar.LLMThoughtsTokenCount = &clothingLLMResponse.ThoughtsTokenCount
+	avatar.LLMOutputTokenCount = &clothingLLMResponse.OutputTokenCount
+	avatar.LLMThoughts = &clothingLLMResponse.Thoughts
+	// the model of the chain that generated the avatar
+	modelString := model.String()
+	avatar.LLMModel = &modelString
 
-	tx := db.Save(&user)
-	if tx.Error != nil {
-		saveUserAvatarProcessingFail(db, user, "Failed to save generated avatar, please try again", true)
-		sentry.CaptureException(fmt.Errorf("[Avatar %v] Error on saving avatar at the end", payload.UserID))
-		return tx.Error
+	if err := saveProcessedAvatar(db, user, avatar); err != nil {
+		saveUserAvatarProcessingFail(db, user, avatar, "Failed to save generated avatar, please try again", true)
+		sentry.CaptureException(fmt.Errorf("[Avatar %v] Error on saving avatar at the end: %v", payload.UserID, err))
+		return err
 	}
 	fmt.Printf("[Avatar: %v] Generation finished succesfully..\n", payload.UserID)
 
@@ -352,118 +622,81 @@ func ProcessAvatarTask(
 func ProcessClothingTask(
 	ctx context.Context, t *asynq.Task, db *gorm.DB, transcriber services.LLMProcessor,
 	awsService services.AWSServiceProvider, fbApp *firebase.App) error {
-	google_key := os.Getenv("GOOGLE_API_KEY")
-	if google_key == "" {
-		sentry.CaptureException(fmt.Errorf("[QUEUE] %s Google API key is not set", string(t.Payload())))
-		return fmt.Errorf("[QUEUE] %s Google API key is not set", string(t.Payload()))
-	}
 	var payload ClothingGenerationPayload
 	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
-		return err
+		return skipRetry(err)
 	}
 	fmt.Printf("[Clothing: %v] Start Processing\n", payload.ClothingId)
 	var clothing models.Clothing
 	res := db.Joins("Company").First(&clothing, payload.ClothingId)
 	if res.Error != nil {
 		sentry.CaptureException(fmt.Errorf("[QUEUE] Error on retrieving clothing for processing %v", payload.ClothingId))
-		return res.Error
+		return taskError(res.Error)
+	}
+	if clothing.ProcessingStatus == "cancelled" {
+		fmt.Printf("[Clothing: %v] Processing was cancelled\n", payload.ClothingId)
+		return nil
 	}
 	if clothing.ClothingType == "" {
 		saveClothingProcessingFail(db, clothing, "Failed to identify clothing type, please try to create new clothing", false)
 		sentry.CaptureException(fmt.Errorf("[Clothing: %v] Error on getting clothing type", payload.ClothingId))
-		return fmt.Errorf("[Clothing: %v] Error on getting clothing type", payload.ClothingId)
+		return skipRetry(fmt.Errorf("[Clothing: %v] Error on getting clothing type", payload.ClothingId))
 	}
-	fileBytes, fileName, err := fetchR2File(awsService, clothing.ImageURL, "Clothing ID "+fmt.Sprint(payload.ClothingId))
+	fileBytes, fileName, err := fetchR2FileContext(ctx, awsService, clothing.ImageURL, "Clothing ID "+fmt.Sprint(payload.ClothingId))
 	if err != nil {
-		saveClothingProcessingFail(db, clothing, "Failed to read clothing image, please try to create new clothing", false)
+		saveClothingProcessingFail(db, clothing, taskFailMessage(err, "Failed to read clothing image, please try to create new clothing"), !services.IsPermanentFailure(err))
 		sentry.CaptureException(fmt.Errorf("[Clothing: %v] File path exists, but error on getting file %s: %v", payload.ClothingId, *clothing.ImageURL, err))
-		return err
+		return taskError(err)
 	}
 	fmt.Printf("[Clothing: %v] Downloaded file size: %d bytes\n", payload.ClothingId, len(fileBytes))
-	imgPath, err := services.CreateTempFile(fileBytes, fileName)
-	// clean defer file after processing
-	defer func(path string) {
-		if err := os.Remove(path); err != nil {
-			fmt.Printf("[Clothing: %v] Error removing temporary file %s: %v\n", payload.ClothingId, path, err)
-		} else {
-			fmt.Printf("[Clothing: %v] Successfully removed temporary file %s\n", payload.ClothingId, path)
-		}
-	}(imgPath)
-
+	fileBytes, _, err = services.NormalizeImageForLLM(fileBytes, fileName)
 	if err != nil {
-		saveClothingProcessingFail(db, clothing, "Failed to read your clothing files, please try to create new clothing", true)
-		sentry.CaptureException(fmt.Errorf("[Clothing: %v] Error extracting documents from zip %s: %v", payload.ClothingId, *clothing.ImageURL, err))
-		return err
+		// decoding the same bytes again gives the same error
+		saveClothingProcessingFail(db, clothing, taskFailMessage(err, "Failed to read clothing image, please try to create new clothing"), false)
+		sentry.CaptureException(fmt.Errorf("[Clothing: %v] Error on normalizing image %s: %v", payload.ClothingId, *clothing.ImageURL, err))
+		return skipRetry(err)
 	}
-
-	var clothingLLMResponseText string
-	var clothingLLMResponse *services.LLMResponse
-
+	fmt.Printf("[Clothing: %v] Normalized file size: %d bytes\n", payload.ClothingId, len(fileBytes))
 	fmt.Printf("[Clothing: %v] Type: %s\n", clothing.ID, clothing.ClothingType)
-
-	fmt.Printf("[Clothing: %v] Transform to e-commerce style white image..\n", payload.ClothingId)
-	model := services.Flash25
-	modelString := model.String()
-	if clothing.Company.EnforcedLLMModel != nil {
-		model = services.LLMModelName(*clothing.Company.EnforcedLLMModel)
-		modelString = model.String()
-		fmt.Printf("[Clothing: %v] [ENFORCE MODEL] Using enforced model: %s\n", payload.ClothingId, model.String())
+	// last chance to stop before the variants are stored
+	cancelled, err := isClothingProcessingCancelled(db, clothing.ID)
+	if err != nil {
+		fmt.Printf("[Clothing: %v] %v\n", payload.ClothingId, err)
+		return err
 	}
-
-	fmt.Printf("[Clothing: %v] Model: %s\n", payload.ClothingId, modelString)
-	// }
-
-	if clothing.ClothingType == "" {
-		sentry.CaptureException(fmt.Errorf("[Clothing: %v] Error on getting clothing type", payload.ClothingId))
-		return fmt.Errorf("[Clothing: %v] Error on getting clothing type", payload.ClothingId)
+	if cancelled {
+		fmt.Printf("[Clothing: %v] Processing was cancelled, skipping the image variants\n", payload.ClothingId)
+		return nil
 	}
-	fmt.Printf("[Clothing: %v] Note type %s\n", payload.ClothingId, clothing.ClothingType)
-	fmt.Printf("[Clothing: %v] Extracted zip document paths %v:", payload.ClothingId, imgPath)
-	if db.Save(&clothing).Error != nil {
-		fmt.Printf("[Clothing: %v] Error on saving clothing mid type detect %v", payload.ClothingId, err)
-		saveClothingProcessingFail(db, clothing, "Failed to determine clothing type, please try to create new clothing", true)
-		sentry.CaptureException(fmt.Errorf("[Clothing: %v] Error on saving clothing mid type detect %v", payload.ClothingId, err))
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
 
-	clothingLLMResponse, err = transcriber.ProcessClothing(imgPath, services.Flash25Image)
+	// the variants come from the confirmed upload, no model generates an e-commerce image yet
+	fmt.Printf("[Clothing: %v] Transform to e-commerce style white image..\n", payload.ClothingId)
+	whitenedBytes, err := services.WhitenBackgroundSmooth(fileBytes, backgroundThreshold, backgroundBlurSigma)
 	if err != nil {
-		fmt.Printf("[Clothing: %v] Error on transcribing documents %v: %v\n", payload.ClothingId, imgPath, err)
-		if strings.Contains(err.Error(), "content violation") {
-			saveClothingProcessingFail(db, clothing, "Sorry, it seems that this clothing contains violated content that we cannot process.", false)
-			sentry.CaptureException(fmt.Errorf("[Clothing: %v] Content violation on transcribing clothing %s: %v", payload.ClothingId, *clothing.ImageURL, err))
-			return nil
-		}
-		saveClothingProcessingFail(db, clothing, "Failed to transribe your clothing, please try to create new clothing", true)
-		sentry.CaptureException(fmt.Errorf("[Clothing: %v] Error on transcribing documents %s: %v", payload.ClothingId, *clothing.ImageURL, err))
-		return err
-	}
-	if clothingLLMResponse == nil {
-		fmt.Printf("[Clothing: %v] Response is nil but no error provided on transcribing %v: %v\n", payload.ClothingId, imgPath, err)
-		saveClothingProcessingFail(db, clothing, "Failed to transribe your clothing, please try to create new clothing", true)
-		sentry.CaptureException(fmt.Errorf("[Clothing: %v] Response is nil but no error provided on transcribing documents %v: %v", payload.ClothingId, imgPath, err))
-		return fmt.Errorf("[Clothing: %v] Response is nil but no error provided on transcribing documents %s: %v", payload.ClothingId, *clothing.ImageURL, err)
+		saveClothingProcessingFail(db, clothing, "Failed to process your clothing image, please try to create new clothing", false)
+		sentry.CaptureException(fmt.Errorf("[Clothing: %v] Error on whitening background %s: %v", payload.ClothingId, *clothing.ImageURL, err))
+		return skipRetry(err)
+	}
+	whiteFileName := fmt.Sprintf("/clothes/%v/white.png", clothing.ID)
+	if err := uploadImageVariant(ctx, awsService, whitenedBytes, whiteFileName); err != nil {
+		saveClothingProcessingFail(db, clothing, "Failed to upload processed clothing, please try again", true)
+		fmt.Printf("[Clothing: %v] Error on storing white image: %v\n", payload.ClothingId, err)
+		sentry.CaptureException(fmt.Errorf("[Clothing: %v] Error on storing white image: %w", payload.ClothingId, err))
+		return taskError(err)
+	}
+	clothing.WhiteImageURL = &whiteFileName
+
+	transparentFileName := fmt.Sprintf("/clothes/%v/transparent.png", clothing.ID)
+	if err := uploadTransparentVariant(ctx, awsService, fileBytes, transparentFileName); err != nil {
+		// the white image is enough for try ons, the transparent one is optional
+		fmt.Printf("[Clothing: %v] Error on storing transparent image: %v\n", payload.ClothingId, err)
+		sentry.CaptureException(fmt.Errorf("[Clothing: %v] Error on storing transparent image: %v", payload.ClothingId, err))
+	} else {
+		clothing.TransparentImageURL = &transparentFileName
 	}
-	clothingLLMResponseText = clothingLLMResponse.Response
-
-	cleanNoteContent := cleanAIResponseText(clothingLLMResponseText)
-	fmt.Println(cleanNoteContent)
-	// content is json read attributes
-	// fmt.Printf("[Clothing: %v] LLM Processed: %q, IT: %d, OT: %d, TT: %d, TOT: %d, Thoughts: %s..\n", payload.ClothingId, cleanNoteContent, clothingLLMResponse.InputTokenCount, clothingLLMResponse.OutputTokenCount, clothingLLMResponse.ThoughtsTokenCount, clothingLLMResponse.TotalTokenCount, clothingLLMResponse.Thoughts)
-	// var parsedNoteData services.ClothingTranscribeResponse
-	// if err := json.Unmarshal([]byte(cleanNoteContent), &parsedNoteData); err != nil {
-	// 	fmt.Println(err)
-	// 	fmt.Printf("[Clothing: %v] Error on parsing Gemini %s AI json %s", payload.ClothingId, model.String(), clothingLLMResponseText)
-	// 	clothing.FailedToProcessLLMNoteResponse = cleanNoteContent
-	// 	saveClothingProcessingFail(db, clothing, "Failed to transcribe clothing content, please try again later", true)
-	// 	sentry.CaptureException(fmt.Errorf("[Clothing: %v] Error on parsing Gemini %s AI json %s", payload.ClothingId, services.Pro25, clothingLLMResponseText))
-	// 	return err
-	// }
-	// parsedNoteData.Transcription = cleanAIResponseSeparateFieldsText(parsedNoteData.Transcription)
-	// parsedNoteData.MD_Summary = cleanAIResponseSeparateFieldsText(parsedNoteData.MD_Summary)
-
-	// convert quiz to json string
-	// quizJSONBytes, err := json.Marshal(parsedNoteData.QuizJSON)
-	// quizJSONString :=
 	clothing.Status = "in_closet"
 	clothing.ProcessingStatus = "completed"
 	// clothing.Transcript = &parsedNoteData.Transcription
@@ -494,205 +727,201 @@ func ProcessClothingTask(
 func HandleTryOnGenerationTask(ctx context.Context, t *asynq.Task, db *gorm.DB, llmProcessor services.LLMProcessor, awsService services.AWSServiceProvider) error {
 	var payload TryOnGenerationPayload
 	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
-		return err
+		return skipRetry(err)
 	}
 	fmt.Printf("[Try on Gen: %v] Start Processing\n", payload.TryOnID)
 	// Fetch clothing from database
 
 	var tryOnGeneration models.ClothingTryonGeneration
-	res := db.Joins("TopClothing").Joins("BottomClothing").Joins("ShoesClothing").Joins("Accessory").First(&tryOnGeneration, payload.TryOnID)
+	res := db.Joins("TopClothing").Joins("BottomClothing").Joins("ShoesClothing").Joins("Accessory").Joins("Company").First(&tryOnGeneration, payload.TryOnID)
 	if res.Error != nil {
 		sentry.CaptureException(fmt.Errorf("[QUEUE] Error on retrieving clothing for generation %v", payload.TryOnID))
-		return res.Error
+		return taskError(res.Error)
 	}
 	if tryOnGeneration.Status == "completed" {
 		fmt.Printf("[Try on Gen: %v] Try on generation already generated\n", payload.TryOnID)
 		return nil
 	}
+	if tryOnGeneration.Status == "cancelled" {
+		fmt.Printf("[Try on Gen: %v] Try on generation was cancelled\n", payload.TryOnID)
+		return nil
+	}
 
 	var user models.UserAccount
 	resUser := db.First(&user, payload.UserID)
 	if resUser.Error != nil {
 		sentry.CaptureException(fmt.Errorf("[QUEUE] Error on retrieving user for try on generation %v", payload.UserID))
-		return resUser.Error
+		return taskError(resUser.Error)
+	}
+	if tryOnGeneration.AvatarID != nil {
+		var avatar models.UserAvatar
+		if err := db.Where("id = ? AND user_account_id = ?", *tryOnGeneration.AvatarID, user.ID).First(&avatar).Error; err != nil {
+			saveTryOnGenerationFail(db, tryOnGeneration, "Selected avatar was deleted, please choose another avatar", false)
+			sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] Error on retrieving avatar %v: %v", payload.TryOnID, *tryOnGeneration.AvatarID, err))
+			return skipRetry(err)
+		}
+		// only used for this generation, the user is not saved here
+		avatar.ApplyToUser(&user)
 	}
 	if user.UserFullBodyImageURL == nil || *user.UserFullBodyImageURL == "" {
 		saveTryOnGenerationFail(db, tryOnGeneration, "Please set your avatar first", false)
 		sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] User full body image is missing, please upload a full body image to use try on generation", payload.TryOnID))
-		return fmt.Errorf("[Try on Gen: %v] User full body image is missing, please upload a full body image to use try on generation", payload.TryOnID)
+		return skipRetry(fmt.Errorf("[Try on Gen: %v] %w: user full body image", payload.TryOnID, services.ErrAssetMissing))
 	}
 
-	model := services.Flash25Image
-	modelString := model.String()
-	fmt.Printf("[Try on Gen: %v] Model: %s\n", payload.TryOnID, modelString)
+	ctx = services.WithLLMUsageScope(ctx, llmUsageScope(tryOnGeneration.CompanyID, tryOnGeneration.UserAccountID, tryOnGeneration.ID))
+	entityLog := fmt.Sprintf("Try on Gen: %v", payload.TryOnID)
+	chain := companyLLMChain(db, llmProcessor, tryOnGeneration.Company, services.LLMOperationTryOn, entityLog)
+	fmt.Printf("[Try on Gen: %v] Models: %v\n", payload.TryOnID, chain)
 	var topImgPath, bottomImgPath, shoesImgPath, accessoryImgPath string
 	if tryOnGeneration.TopClothing != nil && tryOnGeneration.TopClothing.ImageURL == nil {
 		saveTryOnGenerationFail(db, tryOnGeneration, "Top clothing image is missing, please select a valid top clothing", false)
 		sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] Top clothing image is missing, please select a valid top clothing", payload.TryOnID))
-		return nil
+		return skipRetry(fmt.Errorf("[Try on Gen: %v] %w: top clothing image", payload.TryOnID, services.ErrAssetMissing))
 	}
 
 	if tryOnGeneration.BottomClothing != nil && tryOnGeneration.BottomClothing.ImageURL == nil {
 		saveTryOnGenerationFail(db, tryOnGeneration, "Bottom clothing image is missing, please select a valid top clothing", false)
 		sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] Bottom clothing image is missing, please select a valid top clothing", payload.TryOnID))
-		return nil
+		return skipRetry(fmt.Errorf("[Try on Gen: %v] %w: bottom clothing image", payload.TryOnID, services.ErrAssetMissing))
 	}
 
 	if tryOnGeneration.ShoesClothing != nil && tryOnGeneration.ShoesClothing.ImageURL == nil {
 		saveTryOnGenerationFail(db, tryOnGeneration, "Shoes clothing image is missing, please select a valid top clothing", false)
 		sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] Shoes clothing image is missing, please select a valid top clothing", payload.TryOnID))
-		return nil
+		return skipRetry(fmt.Errorf("[Try on Gen: %v] %w: shoes clothing image", payload.TryOnID, services.ErrAssetMissing))
 	}
 
 	if tryOnGeneration.Accessory != nil && tryOnGeneration.Accessory.ImageURL == nil {
 		saveTryOnGenerationFail(db, tryOnGeneration, "Accessory clothing image is missing, please select a valid top clothing", false)
 		sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] Accessory clothing image is missing, please select a valid top clothing", payload.TryOnID))
-		return nil
+		return skipRetry(fmt.Errorf("[Try on Gen: %v] %w: accessory clothing image", payload.TryOnID, services.ErrAssetMissing))
 	}
-	fmt.Println("Fetching clothing files...", tryOnGeneration.TopClothingID, tryOnGeneration.BottomClothingID, tryOnGeneration.ShoesClothingID)
-	time.Sleep(2 * time.Second) // wait for r2 to be ready
+	options := services.TryOnOptions{
+		Scene:       services.TryOnScene(tryOnGeneration.Scene),
+		Pose:        services.TryOnPose(tryOnGeneration.Pose),
+		AspectRatio: services.TryOnAspectRatio(tryOnGeneration.AspectRatio),
+	}
+	var personAvatarPath string
+	assets := []tryOnAsset{{label: "user avatar", key: user.UserFullBodyImageURL, path: &personAvatarPath}}
 	if tryOnGeneration.TopClothing != nil {
-		fmt.Printf("[Try on Gen: %v] Adding top clothing ID: %v\n", payload.TryOnID, tryOnGeneration.TopClothing.ID)
-		topFileBytes, topFileName, err := fetchR2File(awsService, tryOnGeneration.TopClothing.ImageURL, fmt.Sprintf("TryOnGen-%v-TopClothing-%v", payload.TryOnID, tryOnGeneration.TopClothing.ID))
-		if err != nil {
-			saveTryOnGenerationFail(db, tryOnGeneration, "Failed to fetch top clothing image, please try again", true)
-			sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] R2 Fetch top file error, but error on getting file %s: %v", payload.TryOnID, *tryOnGeneration.TopClothing.ImageURL, err))
-			return err
-		}
-		topImgPath, err = services.CreateTempFile(topFileBytes, topFileName)
-		if err != nil {
-			saveTryOnGenerationFail(db, tryOnGeneration, "Failed to read top clothing image, please try again", true)
-			sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] File path exists, but error on getting file %s: %v", payload.TryOnID, *tryOnGeneration.TopClothing.ImageURL, err))
-			return err
-		}
-
-		// clean defer file after processing
-		defer func(path string) {
-			if err := os.Remove(path); err != nil {
-				fmt.Printf("[Clothing: %v] Error removing temporary file %s: %v\n", payload.TryOnID, path, err)
-			} else {
-				fmt.Printf("[Clothing: %v] Successfully removed temporary file %s\n", payload.TryOnID, path)
-			}
-		}(topImgPath)
+		assets = append(assets, tryOnAsset{label: "top clothing", key: tryOnGeneration.TopClothing.ImageURL, path: &topImgPath})
 	}
-
 	if tryOnGeneration.BottomClothing != nil {
-		fmt.Printf("[Try on Gen: %v] Adding bottom clothing ID: %v\n", payload.TryOnID, tryOnGeneration.BottomClothing.ID)
-		bottomFileBytes, bottomFileName, err := fetchR2File(awsService, tryOnGeneration.BottomClothing.ImageURL, fmt.Sprintf("TryOnGen-%v-BottomClothing-%v", payload.TryOnID, tryOnGeneration.BottomClothing.ID))
-		if err != nil {
-			saveTryOnGenerationFail(db, tryOnGeneration, "Failed to fetch bottom clothing image, please try again", true)
-			sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] R2 Fetch bottom file error, but error on getting file %s: %v", payload.TryOnID, *tryOnGeneration.TopClothing.ImageURL, err))
-			return err
-		}
-		if err != nil {
-			saveTryOnGenerationFail(db, tryOnGeneration, "Failed to fetch bottom clothing image, please try again", true)
-			sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] File path exists, but error on getting file %s: %v", payload.TryOnID, *tryOnGeneration.TopClothing.ImageURL, err))
-			return err
+		assets = append(assets, tryOnAsset{label: "bottom clothing", key: tryOnGeneration.BottomClothing.ImageURL, path: &bottomImgPath})
+	}
+	if tryOnGeneration.ShoesClothing != nil {
+		assets = append(assets, tryOnAsset{label: "shoes clothing", key: tryOnGeneration.ShoesClothing.ImageURL, path: &shoesImgPath})
+	}
+	if tryOnGeneration.Accessory != nil {
+		assets = append(assets, tryOnAsset{label: "accessory", key: tryOnGeneration.Accessory.ImageURL, path: &accessoryImgPath})
+	}
+	if options.Scene == services.SceneCustom {
+		assets = append(assets, tryOnAsset{label: "background", key: tryOnGeneration.BackgroundImageURL, path: &options.BackgroundImagePath})
+	}
+	fmt.Printf("[Try on Gen: %v] Fetching %d files...\n", payload.TryOnID, len(assets))
+	tempFiles, err := fetchTryOnAssets(ctx, awsService, assets, fmt.Sprintf("TryOnGen-%v", payload.TryOnID))
+	defer removeTempFiles(tempFiles, fmt.Sprintf("Try on Gen: %v", payload.TryOnID))
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
-		bottomImgPath, err = services.CreateTempFile(bottomFileBytes, bottomFileName)
-		if err != nil {
-			saveTryOnGenerationFail(db, tryOnGeneration, "Failed to read bottom clothing image, please try again", true)
-			sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] File path exists, but error on getting file %s: %v", payload.TryOnID, *tryOnGeneration.BottomClothing.ImageURL, err))
-			return err
+		saveTryOnGenerationFail(db, tryOnGeneration, taskFailMessage(err, "Failed to fetch try on images, please try again"), !services.IsPermanentFailure(err))
+		sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] R2 Fetch error: %v", payload.TryOnID, err))
+		return taskError(err)
+	}
+	// repeat try-ons of the same user reuse the avatar already uploaded to Gemini
+	imageSources := map[string]string{}
+	for _, asset := range assets {
+		if asset.key != nil {
+			imageSources[*asset.path] = *asset.key
 		}
-		defer func(path string) {
-			if err := os.Remove(path); err != nil {
-				fmt.Printf("[Clothing: %v] Error removing temporary file %s: %v\n", payload.TryOnID, path, err)
-			} else {
-				fmt.Printf("[Clothing: %v] Successfully removed temporary file %s\n", payload.TryOnID, path)
-			}
-		}(bottomImgPath)
+	}
+	ctx = services.WithImageSources(ctx, imageSources)
+	clothesToWear := []string{topImgPath, bottomImgPath, shoesImgPath, accessoryImgPath}
 
+	// Build characteristics description from user data (same as ProcessAvatarTask)
+	characteristicsDescription := services.UserCharacteristicsDescription(user)
+	if characteristicsDescription != "" {
+		fmt.Printf("[Try on Gen: %v] User characteristics description: %s\n", payload.TryOnID, characteristicsDescription)
+	} else {
+		fmt.Printf("[Try on Gen: %v] User characteristics not available, using default\n", payload.TryOnID)
 	}
-	if tryOnGeneration.ShoesClothing != nil {
-		fmt.Printf("[Try on Gen: %v] Adding shoes clothing ID: %v\n", payload.TryOnID, tryOnGeneration.ShoesClothing.ID)
-		shoesFileBytes, shoesFileName, err := fetchR2File(awsService, tryOnGeneration.ShoesClothing.ImageURL, fmt.Sprintf("TryOnGen-%v-ShoesClothing-%v", payload.TryOnID, tryOnGeneration.ShoesClothing.ID))
-		shoesImgPath, err = services.CreateTempFile(shoesFileBytes, shoesFileName)
-		if err != nil {
-			saveTryOnGenerationFail(db, tryOnGeneration, "Failed to read shoes clothing image, please try again", true)
-			sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] File path exists, but error on getting file %s: %v", payload.TryOnID, *tryOnGeneration.ShoesClothing.ImageURL, err))
-			return err
-		}
-		defer func(path string) {
-			if err := os.Remove(path); err != nil {
-				fmt.Printf("[Clothing: %v] Error removing temporary file %s: %v\n", payload.TryOnID, path, err)
-			} else {
-				fmt.Printf("[Clothing: %v] Successfully removed temporary file %s\n", payload.TryOnID, path)
-			}
-		}(shoesImgPath)
+	options, err = options.WithDefaults()
+	if err != nil {
+		saveTryOnGenerationFail(db, tryOnGeneration, taskFailMessage(err, "Failed to generate try on, please try again"), false)
+		sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] Invalid try on options: %v", payload.TryOnID, err))
+		return taskError(err)
 	}
+	fmt.Printf("[Try on Gen: %v] Scene: %s, pose: %s, aspect ratio: %s\n", payload.TryOnID, options.Scene, options.Pose, options.AspectRatio)
 
-	clothesToWear := []string{topImgPath, bottomImgPath, shoesImgPath, accessoryImgPath}
-	personAvatarBytes, personFileName, err := fetchR2File(awsService, user.UserFullBodyImageURL, "person-avatar")
+	// rows created before prompt versioning have no version assigned
+	promptVersion := services.DefaultPromptVersion
+	if tryOnGeneration.PromptVersion != nil {
+		promptVersion = *tryOnGeneration.PromptVersion
+	}
+	promptData, err := services.NewTryOnPromptData(characteristicsDescription, options)
+	var prompt *services.RenderedPrompt
+	if err == nil {
+		prompt, err = services.NewPromptRegistry(db).Render(services.PromptTryOn, promptVersion, promptData)
+	}
 	if err != nil {
-		saveTryOnGenerationFail(db, tryOnGeneration, "Failed to fetch user avatar image, please try again", true)
-		sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] R2 Fetch person avatar file error, but error on getting file %s: %v", payload.TryOnID, *user.UserFullBodyImageURL, err))
-		return err
+		saveTryOnGenerationFail(db, tryOnGeneration, "Failed to generate try on, please try again", false)
+		sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] Error on rendering prompt %s: %v", payload.TryOnID, promptVersion, err))
+		return skipRetry(err)
 	}
-	personAvatarPath, err := services.CreateTempFile(personAvatarBytes, personFileName)
+	fmt.Printf("[Try on Gen: %v] Prompt version: %s\n", payload.TryOnID, promptVersion)
+	tryOnGeneration.PromptVersion = &promptVersion
+
+	// last chance to stop before the paid model call
+	cancelled, err := isTryOnCancelled(db, tryOnGeneration.ID)
 	if err != nil {
-		saveTryOnGenerationFail(db, tryOnGeneration, "Failed to read user avatar image, please try again", true)
-		sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] File path exists, but error on getting file %s: %v", payload.TryOnID, *user.UserFullBodyImageURL, err))
+		fmt.Printf("[Try on Gen: %v] %v\n", payload.TryOnID, err)
 		return err
 	}
-	defer func(path string) {
-		if err := os.Remove(path); err != nil {
-			fmt.Printf("[Clothing: %v] Error removing temporary file %s: %v\n", payload.TryOnID, path, err)
-		} else {
-			fmt.Printf("[Clothing: %v] Successfully removed temporary file %s\n", payload.TryOnID, path)
-		}
-	}(personAvatarPath)
-	// Build characteristics description from user data (same as ProcessAvatarTask)
-	var characteristicsDescription string
-	if user.BodyType != nil && user.ShoulderType != nil && user.BodyToLegRatio != nil &&
-		user.HandType != nil && user.UpperLimbType != nil && user.Weight != nil &&
-		user.Height != nil && user.WaistSize != nil {
-
-		// Create PersonCharacteristics struct from user data
-		characteristics := services.PersonCharacteristics{
-			BodyType:       services.BodyType(*user.BodyType),
-			ShoulderType:   services.ShoulderType(*user.ShoulderType),
-			BodyToLegRatio: services.BodyToLegRatio(*user.BodyToLegRatio),
-			HandType:       services.HandType(*user.HandType),
-			UpperLimbType:  services.UpperLimbType(*user.UpperLimbType),
-			Weight:         *user.Weight,
-			Height:         *user.Height,
-			WaistSize:      *user.WaistSize,
-		}
-		characteristicsDescription = characteristics.ToDescriptiveSentence()
-		fmt.Printf("[Try on Gen: %v] User characteristics description: %s\n", payload.TryOnID, characteristicsDescription)
-	} else {
-		fmt.Printf("[Try on Gen: %v] User characteristics not available, using default\n", payload.TryOnID)
-		characteristicsDescription = ""
+	if cancelled {
+		fmt.Printf("[Try on Gen: %v] Try on generation was cancelled, skipping generation\n", payload.TryOnID)
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
 
 	fmt.Printf("[Try on Gen: %v] Clothing to wear paths: %v", payload.TryOnID, clothesToWear)
-	clothingLLMResponse, err := llmProcessor.GenerateTryOn(personAvatarPath, clothesToWear, characteristicsDescription, model)
-	fmt.Printf("[Try on Gen: %v] Images length: %d", payload.TryOnID, len(clothingLLMResponse.Images))
-	fmt.Println("Images length:", len(clothingLLMResponse.Images))
+	clothingLLMResponse, model, err := services.CallWithFallback(ctx, chain, entityLog, func(model services.LLMModelName) (*services.LLMResponse, error) {
+		return services.RequireImages(llmProcessor.GenerateTryOn(ctx, personAvatarPath, clothesToWear, options, prompt, model))
+	})
 	if err != nil {
-		sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] Error on generating study material %s: %v", payload.TryOnID, "", err))
-		saveTryOnGenerationFail(db, tryOnGeneration, "Failed to generate try on, please try again", true)
-		return err
+		if errors.Is(err, services.ErrLLMUnavailable) {
+			return err
+		}
+		sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] Error on generating try on: %v", payload.TryOnID, err))
+		saveTryOnGenerationFail(db, tryOnGeneration, taskFailMessage(err, "Failed to generate try on, please try again"), !services.IsPermanentFailure(err))
+		return taskError(err)
 	}
+	fmt.Printf("[Try on Gen: %v] Images length: %d", payload.TryOnID, len(clothingLLMResponse.Images))
+	fmt.Println("Images length:", len(clothingLLMResponse.Images))
 	clothingLLMResponseText := clothingLLMResponse.Response
 	fmt.Printf("[Try on Gen: %v] Response text on generating %s: %s", payload.TryOnID, "", clothingLLMResponseText)
 
-	if strings.Contains(clothingLLMResponseText, "NO_PERSON") {
-		saveTryOnGenerationFail(db, tryOnGeneration, "No person detected in the image, please try to upload new avatar", false)
-		fmt.Printf("[Try on Gen: %v] No person detected in the image on generating tryon %s: %v", payload.TryOnID, "", err)
-		sentry.CaptureException(fmt.Errorf("[Avatar: %v] No person detected in the image on generating tryon %s: %v", payload.UserID, "", err))
-		return fmt.Errorf("[Avatar: %v] No person detected in the image on generating tryon %s: %v", payload.UserID, "", err)
-	}
-	if len(clothingLLMResponse.Images) == 0 {
-		sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] Response image is nil or empty on generating try on %s: %v", payload.TryOnID, "", err))
-		fmt.Printf("[Try on Gen: %v] Response image is nil or empty on generating try on %s: %v", payload.TryOnID, "", err)
-		saveTryOnGenerationFail(db, tryOnGeneration, "Failed to generate generating preview, please try again", true)
-		return fmt.Errorf("[Try on Gen: %v] Response image is nil or empty on generating try on %s: %v", payload.TryOnID, "", err)
-	}
 	if len(clothingLLMResponse.Images) > 1 {
 		fmt.Printf("[Try on Gen: %v] Warning: More than 1 image returned, using the first one\n", payload.TryOnID)
 	}
+	qualityOptions := services.ImageQualityOptions{
+		AspectRatio:     options.AspectRatio,
+		WhiteBackground: options.Scene == services.SceneStudioWhite,
+	}
+	clothingLLMResponse, model, tryOnGeneration.QualityRegenerations, tryOnGeneration.QualityCheckFailReason, err = regenerateUntilQualityPasses(
+		ctx, entityLog, clothingLLMResponse, model, qualityOptions,
+		func() (*services.LLMResponse, services.LLMModelName, error) {
+			return services.CallWithFallback(ctx, chain, entityLog, func(model services.LLMModelName) (*services.LLMResponse, error) {
+				return services.RequireImages(llmProcessor.GenerateTryOn(ctx, personAvatarPath, clothesToWear, options, prompt, model))
+			})
+		},
+	)
+	if err != nil {
+		return err
+	}
 	generatedImageBytes := clothingLLMResponse.Images[0]
 	// err = os.WriteFile("nanobanana.png", generatedImageBytes, 0644)
 	// if err != nil {
@@ -703,26 +932,39 @@ func HandleTryOnGenerationTask(ctx context.Context, t *asynq.Task, db *gorm.DB,
 	// todo clean and map the same file name as in FE UI otherwise **FAIL**
 	safeFileName := fmt.Sprintf("/tryon/%v/generation/%s", tryOnGeneration.ID, "generation.png")
 
-	uploadUrl, presignErr := awsService.PresignLink(context.Background(), bucketName, safeFileName)
+	uploadUrl, presignErr := awsService.PresignLink(ctx, bucketName, safeFileName)
 	fmt.Printf("[Try on Gen: %v] Upload url generated: %s\n", payload.TryOnID, uploadUrl)
 	if presignErr != nil {
+		saveTryOnGenerationFail(db, tryOnGeneration, "Failed to upload generated try on, please try again", true)
 		fmt.Printf("[Try on Gen: %v] Youtube Unable to create presign link for tryon %s!\n", tryOnGeneration.ID, presignErr)
 		sentry.CaptureException(fmt.Errorf("[Clothing: %v] Unable to create presign for tryon %s", payload.TryOnID, presignErr))
 		return presignErr
 	}
 	// parse file from Output of ytdlp file path in fmt.Sprintf("clothing-%v.%%(ext)s", clothing.ID)
-	respBody, statusCode, err := awsService.UploadToPresignedURL(context.Background(), bucketName, uploadUrl, generatedImageBytes)
+	respBody, statusCode, err := awsService.UploadToPresignedURL(ctx, bucketName, uploadUrl, generatedImageBytes)
 	fmt.Printf("[Try on: %v] R2 Upload response body: %s, status code: %v\n", payload.TryOnID, respBody, statusCode)
 	if err != nil || statusCode > 299 {
+		err = uploadError(safeFileName, statusCode, err)
+		saveTryOnGenerationFail(db, tryOnGeneration, "Failed to upload generated try on, please try again", true)
 		fmt.Printf("[Try on Gen: %v] Try on Error on uploading generated file %s: %v\n", payload.TryOnID, safeFileName, err)
-		sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] Error on uploading file %s: %v", payload.TryOnID, safeFileName, err))
+		sentry.CaptureException(fmt.Errorf("[Try on Gen: %v] Error on uploading file %s: %w", payload.TryOnID, safeFileName, err))
 		return err
 	}
-	time.Sleep(1 * time.Second) // wait for r2 to be ready
-	// just fetch for logs
-	fetchR2File(awsService, &safeFileName, "TryOnGen-FetchCheck")
+	if _, err := services.WaitForR2Object(ctx, awsService, bucketName, safeFileName); err != nil {
+		fmt.Printf("[Try on Gen: %v] Uploaded file is not visible yet %s: %v\n", payload.TryOnID, safeFileName, err)
+	}
 
 	fmt.Printf("[Try on Gen: %v] Successfully uploaded to R2: %s\n", payload.TryOnID, uploadUrl)
+	// cancelled while generating, keep the cancelled status
+	cancelled, err = isTryOnCancelled(db, tryOnGeneration.ID)
+	if err != nil {
+		fmt.Printf("[Try on Gen: %v] %v\n", payload.TryOnID, err)
+		return err
+	}
+	if cancelled {
+		fmt.Printf("[Try on Gen: %v] Try on generation was cancelled during generation\n", payload.TryOnID)
+		return nil
+	}
 	tryOnGeneration.TryOnPreviewImageURL = &safeFileName
 	tryOnGeneration.Status = "completed"
 
@@ -731,6 +973,8 @@ func HandleTryOnGenerationTask(ctx context.Context, t *asynq.Task, db *gorm.DB,
 	tryOnGeneration.LLMThoughtsTokenCount = &clothingLLMResponse.ThoughtsTokenCount
 	tryOnGeneration.LLMOutputTokenCount = &clothingLLMResponse.OutputTokenCount
 	tryOnGeneration.LLMThoughts = &clothingLLMResponse.Thoughts
+	// the model of the chain that generated the try on
+	modelString := model.String()
 	tryOnGeneration.LLMModel = &modelString
 
 	// save question from llm
@@ -746,6 +990,86 @@ func HandleTryOnGenerationTask(ctx context.Context, t *asynq.Task, db *gorm.DB,
 	return nil
 }
 
+// hard threshold which makes everything above 244 background,
+// below will be smoothed out by the blur
+const (
+	backgroundThreshold uint8   = 244
+	backgroundBlurSigma float64 = 4.0
+)
+
+// uploadTransparentVariant turns the background of the image into alpha and uploads the PNG under key.
+func uploadTransparentVariant(ctx context.Context, awsService services.AWSServiceProvider, imageBytes []byte, key string) error {
+	transparentBytes, err := services.BackgroundToAlpha(imageBytes, backgroundThreshold, backgroundBlurSigma)
+	if err != nil {
+		return err
+	}
+	return uploadImageVariant(ctx, awsService, transparentBytes, key)
+}
+
+// uploadImageVariant uploads an image derived from the original under key.
+func uploadImageVariant(ctx context.Context, awsService services.AWSServiceProvider, imageBytes []byte, key string) error {
+	bucketName := services.GetEnv("R2_BUCKET_NAME", "")
+	uploadUrl, err := awsService.PresignLink(ctx, bucketName, key)
+	if err != nil {
+		return fmt.Errorf("unable to presign %s: %w", key, err)
+	}
+	_, statusCode, err := awsService.UploadToPresignedURL(ctx, bucketName, uploadUrl, imageBytes)
+	if err != nil || statusCode > 299 {
+		return uploadError(key, statusCode, err)
+	}
+	return nil
+}
+
+// uploadError describes a failed presigned upload. A non 2xx answer comes with a nil err,
+// it is retried like the other upstream errors since the next attempt presigns a new link.
+func uploadError(key string, statusCode int, err error) error {
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return fmt.Errorf("%w: failed to upload %s, status code: %d", services.ErrTransientUpstream, key, statusCode)
+}
+
+// maxQualityRegenerations bounds how many extra generations a failed quality check can trigger
+const maxQualityRegenerations = 2
+
+// regenerateUntilQualityPasses checks the generated image and calls generate again while it fails the quality gate.
+// When every attempt fails, the last image is kept so the user still gets a result, and the last failure reason is returned.
+// The reason is nil when an image passes, the failures of earlier attempts don't describe the kept image.
+// The model of the kept image is returned with it. A failed regeneration keeps the previous image too, unless no
+// model could be called or the task was cancelled; that error is returned so the task is queued again.
+func regenerateUntilQualityPasses(ctx context.Context, entityLog string, response *services.LLMResponse, model services.LLMModelName, options services.ImageQualityOptions, generate func() (*services.LLMResponse, services.LLMModelName, error)) (*services.LLMResponse, services.LLMModelName, int, *string, error) {
+	var failReason *string
+	regenerations := 0
+	for {
+		qualityErr := services.CheckGeneratedImage(response.Images[0], options)
+		if qualityErr == nil {
+			return response, model, regenerations, nil, nil
+		}
+		reason := qualityErr.Error()
+		failReason = &reason
+		fmt.Printf("[%s] Generated image failed quality check: %s\n", entityLog, reason)
+		if regenerations >= maxQualityRegenerations {
+			sentry.CaptureException(fmt.Errorf("[%s] Generated image failed quality check after %d regenerations: %s", entityLog, regenerations, reason))
+			return response, model, regenerations, failReason, nil
+		}
+		regenerations++
+		regenerated, regeneratedModel, err := generate()
+		if errors.Is(err, services.ErrLLMUnavailable) || ctx.Err() != nil {
+			fmt.Printf("[%s] Regeneration %d stopped: %v\n", entityLog, regenerations, err)
+			if err == nil {
+				err = ctx.Err()
+			}
+			return response, model, regenerations, failReason, err
+		}
+		if err != nil || regenerated == nil || len(regenerated.Images) == 0 {
+			fmt.Printf("[%s] Regeneration %d failed, keeping previous image: %v\n", entityLog, regenerations, err)
+			return response, model, regenerations, failReason, nil
+		}
+		response = regenerated
+		model = regeneratedModel
+	}
+}
+
 func saveTryOnGenerationFail(db *gorm.DB, tryOnGeneration models.ClothingTryonGeneration, message string, shouldRetry bool) error {
 	// clothing.QuizStatus = "failed"
 	tryOnGeneration.GenerationRetryTimes = tryOnGeneration.GenerationRetryTimes + 1
@@ -778,48 +1102,123 @@ func saveClothingProcessingFail(db *gorm.DB, clothing models.Clothing, msg strin
 	return nil
 }
 
-func saveUserAvatarProcessingFail(db *gorm.DB, user models.UserAccount, msg string, shouldRetry bool) error {
-	user.AvatarProcessRetryTimes = user.AvatarProcessRetryTimes + 1
-	if !shouldRetry || user.AvatarProcessRetryTimes >= 3 {
+func saveUserAvatarProcessingFail(db *gorm.DB, user models.UserAccount, avatar models.UserAvatar, msg string, shouldRetry bool) error {
+	avatar.ProcessRetryTimes = avatar.ProcessRetryTimes + 1
+	if !shouldRetry || avatar.ProcessRetryTimes >= 3 {
+		avatar.ProcessingErrorMessage = &msg
+		avatar.Status = "failed"
+	}
+	user.AvatarProcessRetryTimes = avatar.ProcessRetryTimes
+	if avatar.ID == 0 && avatar.Status == "failed" {
 		user.FullBodyAvatarProcessingErrorMessage = &msg
-
-		user.Status = "failed"
+		user.FullBodyAvatarStatus = "failed"
 	}
-	tx := db.Save(&user)
-	if tx.Error != nil {
+	if err := saveProcessedAvatar(db, user, avatar); err != nil {
 		sentry.CaptureException(fmt.Errorf("[Fail Avatar %v] Error on saving user avatar for failed status", user.ID))
-		return tx.Error
+		return err
 	}
 	return nil
 }
+
+// avatarForProcessing loads the avatar of the task. Tasks queued before saved avatars carry no avatar ID,
+// their current user avatar is stored as the default saved avatar first.
+func avatarForProcessing(db *gorm.DB, user models.UserAccount, avatarID uint) (models.UserAvatar, error) {
+	var avatar models.UserAvatar
+	if avatarID != 0 {
+		err := db.Where("id = ? AND user_account_id = ?", avatarID, user.ID).First(&avatar).Error
+		return avatar, err
+	}
+	if user.UserFullBodyImageURL == nil {
+		return avatar, fmt.Errorf("user %v has no avatar image", user.ID)
+	}
+	avatar = models.UserAvatar{
+		UserAccountID:  user.ID,
+		SourceImageURL: *user.UserFullBodyImageURL,
+		Status:         "processing",
+		IsDefault:      true,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.UserAvatar{}).Where("user_account_id = ?", user.ID).Update("is_default", false).Error; err != nil {
+			return err
+		}
+		return tx.Create(&avatar).Error
+	})
+	return avatar, err
+}
+
+// avatarUserFields are the user columns written from the avatar task, the user may edit the others meanwhile
+var avatarUserFields = []string{
+	"AvatarProcessRetryTimes", "FullBodyAvatarStatus", "FullBodyAvatarProcessingErrorMessage",
+	"UserFullBodyImageURL", "UserFullBodyTransparentImageURL",
+	"PromptVersion", "CharacteristicsPromptVersion", "AvatarQualityCheckFailReason", "AvatarQualityRegenerations",
+	"BodyType", "ShoulderType", "BodyToLegRatio", "HandType", "UpperLimbType", "Weight", "Height", "WaistSize",
+	"CharacteristicsProvenance",
+}
+
+// saveProcessedAvatar saves the avatar and, when it is still the default one, mirrors it into the user.
+// The default flag and the user are read again under a row lock, the user may pick another default
+// or enter characteristics by hand while the avatar is processed.
+func saveProcessedAvatar(db *gorm.DB, user models.UserAccount, avatar models.UserAvatar) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if avatar.ID != 0 {
+			var current models.UserAvatar
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("is_default").First(&current, avatar.ID).Error; err != nil {
+				return err
+			}
+			avatar.IsDefault = current.IsDefault
+			if err := tx.Save(&avatar).Error; err != nil {
+				return err
+			}
+			if !avatar.IsDefault {
+				return nil
+			}
+		}
+		var fresh models.UserAccount
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&fresh, user.ID).Error; err != nil {
+			return err
+		}
+		fresh.AvatarProcessRetryTimes = user.AvatarProcessRetryTimes
+		if avatar.ID == 0 {
+			// a task without a saved avatar only reports its failure
+			fresh.FullBodyAvatarStatus = user.FullBodyAvatarStatus
+			fresh.FullBodyAvatarProcessingErrorMessage = user.FullBodyAvatarProcessingErrorMessage
+		} else {
+			avatar.ApplyToUser(&fresh)
+		}
+		return tx.Model(&fresh).Select(avatarUserFields).Updates(&fresh).Error
+	})
+}
 func IdentifyClothingTask(
 	ctx context.Context, t *asynq.Task, db *gorm.DB, transcriber services.LLMProcessor,
 	awsService services.AWSServiceProvider, fbApp *firebase.App) error {
-	google_key := os.Getenv("GOOGLE_API_KEY")
-	if google_key == "" {
-		sentry.CaptureException(fmt.Errorf("[QUEUE] %s Google API key is not set", string(t.Payload())))
-		return fmt.Errorf("[QUEUE] %s Google API key is not set", string(t.Payload()))
-	}
 	var payload IdentifyClothingPayload
 	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
-		return err
+		return skipRetry(err)
 	}
 	fmt.Printf("[Identify Clothing: %v] Start Processing\n", payload.ClothingId)
 	var clothing models.Clothing
 	res := db.Joins("Company").First(&clothing, payload.ClothingId)
 	if res.Error != nil {
 		sentry.CaptureException(fmt.Errorf("[QUEUE] Error on retrieving clothing for identification %v", payload.ClothingId))
-		return res.Error
+		return taskError(res.Error)
 	}
 
-	time.Sleep(2 * time.Second) // wait for r2 to be ready
-	fileBytes, fileName, err := fetchR2File(awsService, clothing.ImageURL, "Clothing ID "+fmt.Sprint(payload.ClothingId))
+	// the upload was verified by confirm-upload before the task was queued
+	fileBytes, fileName, err := fetchR2FileContext(ctx, awsService, clothing.ImageURL, "Clothing ID "+fmt.Sprint(payload.ClothingId))
 	if err != nil {
-		saveClothingIdentifyFail(db, clothing, "Failed to read clothing image, please try to create new clothing", false)
+		saveClothingIdentifyFail(db, clothing, taskFailMessage(err, "Failed to read clothing image, please try to create new clothing"), !services.IsPermanentFailure(err))
 		sentry.CaptureException(fmt.Errorf("[Identify Clothing: %v] File path exists, but error on getting file %s: %v", payload.ClothingId, *clothing.ImageURL, err))
-		return err
+		return taskError(err)
 	}
 	fmt.Printf("[Identify Clothing: %v] Downloaded file size: %d bytes\n", payload.ClothingId, len(fileBytes))
+	fileBytes, fileName, err = services.NormalizeImageForLLM(fileBytes, fileName)
+	if err != nil {
+		// decoding the same bytes again gives the same error
+		saveClothingIdentifyFail(db, clothing, taskFailMessage(err, "Failed to read clothing image, please try to create new clothing"), false)
+		sentry.CaptureException(fmt.Errorf("[Identify Clothing: %v] Error on normalizing image %s: %v", payload.ClothingId, *clothing.ImageURL, err))
+		return skipRetry(err)
+	}
+	fmt.Printf("[Identify Clothing: %v] Normalized file size: %d bytes\n", payload.ClothingId, len(fileBytes))
 	imgPath, err := services.CreateTempFile(fileBytes, fileName)
 	defer func(path string) {
 		if err := os.Remove(path); err != nil {
@@ -828,6 +1227,7 @@ func IdentifyClothingTask(
 			fmt.Printf("[Identify Clothing: %v] Successfully removed temporary file %s\n", payload.ClothingId, path)
 		}
 	}(imgPath)
+	ctx = services.WithImageSources(ctx, map[string]string{imgPath: *clothing.ImageURL})
 
 	if err != nil {
 		saveClothingIdentifyFail(db, clothing, "Failed to read your clothing files, please try to create new clothing", true)
@@ -836,28 +1236,40 @@ func IdentifyClothingTask(
 	}
 
 	fmt.Printf("[Identify Clothing: %v] Identifying clothing attributes..\n", payload.ClothingId)
-	model := services.Pro25
-	modelString := model.String()
-	if clothing.Company.EnforcedLLMModel != nil {
-		model = services.LLMModelName(*clothing.Company.EnforcedLLMModel)
-		modelString = model.String()
-		fmt.Printf("[Identify Clothing: %v] [ENFORCE MODEL] Using enforced model: %s\n", payload.ClothingId, model.String())
-	}
+	ctx = services.WithLLMUsageScope(ctx, llmUsageScope(clothing.CompanyID, clothing.OwnerID, clothing.ID))
+	entityLog := fmt.Sprintf("Identify Clothing: %v", payload.ClothingId)
+	chain := companyLLMChain(db, transcriber, clothing.Company, services.LLMOperationIdentifyClothing, entityLog)
 
-	fmt.Printf("[Identify Clothing: %v] Model: %s\n", payload.ClothingId, modelString)
+	fmt.Printf("[Identify Clothing: %v] Models: %v\n", payload.ClothingId, chain)
 	fmt.Printf("[Identify Clothing: %v] Extracted clothing image path %v:", payload.ClothingId, imgPath)
 
-	clothingLLMResponse, err := transcriber.IdentifyClothing(imgPath, services.Pro25)
+	promptRegistry := services.NewPromptRegistry(db)
+	promptVersion := promptRegistry.Assign(services.PromptIdentifyClothing)
+	prompt, err := promptRegistry.Render(services.PromptIdentifyClothing, promptVersion, nil)
+	if err != nil {
+		saveClothingIdentifyFail(db, clothing, "Failed to identify your clothing, please try to create new clothing", false)
+		sentry.CaptureException(fmt.Errorf("[Identify Clothing: %v] Error on rendering prompt %s: %v", payload.ClothingId, promptVersion, err))
+		return skipRetry(err)
+	}
+	fmt.Printf("[Identify Clothing: %v] Prompt version: %s\n", payload.ClothingId, promptVersion)
+	clothing.PromptVersion = &promptVersion
+
+	clothingLLMResponse, model, err := services.CallWithFallback(ctx, chain, entityLog, func(model services.LLMModelName) (*services.LLMResponse, error) {
+		return transcriber.IdentifyClothing(ctx, imgPath, prompt, model)
+	})
 	if err != nil {
+		if errors.Is(err, services.ErrLLMUnavailable) {
+			return err
+		}
 		fmt.Printf("[Identify Clothing: %v] Error on identifying clothing %v: %v\n", payload.ClothingId, imgPath, err)
-		if strings.Contains(err.Error(), "content violation") {
-			saveClothingIdentifyFail(db, clothing, "Sorry, it seems that this clothing contains violated content that we cannot process.", false)
-			sentry.CaptureException(fmt.Errorf("[Identify Clothing: %v] Content violation on identifying clothing %s: %v", payload.ClothingId, *clothing.ImageURL, err))
-			return nil
+		fallback := "Failed to identify your clothing, please try to create new clothing"
+		if errors.Is(err, services.ErrParseFailure) {
+			// the answer already had to follow the schema, another attempt is unlikely to do better
+			fallback = "We could not recognise the clothing in this photo, please try another photo"
 		}
-		saveClothingIdentifyFail(db, clothing, "Failed to identify your clothing, please try to create new clothing", true)
-		sentry.CaptureException(fmt.Errorf("[Identify Clothing: %v] Error on identifying clothing %s: %v", payload.ClothingId, *clothing.ImageURL, err))
-		return err
+		saveClothingIdentifyFail(db, clothing, taskFailMessage(err, fallback), !services.IsPermanentFailure(err))
+		sentry.CaptureException(fmt.Errorf("[Identify Clothing: %v] Error on identifying clothing %s with %s: %w", payload.ClothingId, *clothing.ImageURL, model.String(), err))
+		return taskError(err)
 	}
 	if clothingLLMResponse == nil {
 		fmt.Printf("[Identify Clothing: %v] Response is nil but no error provided on identifying %v: %v\n", payload.ClothingId, imgPath, err)
@@ -866,18 +1278,18 @@ func IdentifyClothingTask(
 		return fmt.Errorf("[Identify Clothing: %v] Response is nil but no error provided on identifying clothing %s: %v", payload.ClothingId, *clothing.ImageURL, err)
 	}
 	clothingLLMResponseText := clothingLLMResponse.Response
+	fmt.Println(clothingLLMResponseText)
 
-	cleanResponse := cleanAIResponseText(clothingLLMResponseText)
-	fmt.Println(cleanResponse)
-
-	// Parse the JSON response from LLM
-	var identifiedData services.ClothingIdentificationResponse
-	if err := json.Unmarshal([]byte(cleanResponse), &identifiedData); err != nil {
-		fmt.Println(err)
-		fmt.Printf("[Identify Clothing: %v] Error on parsing Gemini %s AI json %s", payload.ClothingId, model.String(), clothingLLMResponseText)
-		saveClothingIdentifyFail(db, clothing, "Failed to parse clothing identification response, please try again later", true)
-		sentry.CaptureException(fmt.Errorf("[Identify Clothing: %v] Error on parsing Gemini %s AI json %s", payload.ClothingId, services.Pro25, clothingLLMResponseText))
-		return err
+	// the backends validate the answer against the schema, processors without it leave only the text
+	identifiedData := clothingLLMResponse.Identification
+	if identifiedData == nil {
+		identifiedData, err = services.DecodeClothingIdentification(clothingLLMResponseText)
+	}
+	if err != nil {
+		fmt.Printf("[Identify Clothing: %v] Invalid %s identification %s: %v\n", payload.ClothingId, model.String(), clothingLLMResponseText, err)
+		saveClothingIdentifyFail(db, clothing, "We could not recognise the clothing in this photo, please try another photo", false)
+		sentry.CaptureException(fmt.Errorf("[Identify Clothing: %v] Invalid %s identification: %w", payload.ClothingId, model.String(), err))
+		return taskError(err)
 	}
 
 	// Update clothing with identified attributes
@@ -900,6 +1312,7 @@ func IdentifyClothingTask(
 	clothing.LLMThoughtsTokenCount = &clothingLLMResponse.ThoughtsTokenCount
 	clothing.LLMOutputTokenCount = &clothingLLMResponse.OutputTokenCount
 	clothing.LLMThoughts = &clothingLLMResponse.Thoughts
+	modelString := model.String()
 	clothing.LLMModel = &modelString
 
 	tx := db.Save(&clothing)
@@ -931,3 +1344,114 @@ func ScheduledQuizAlertTask(ctx context.Context, t *asynq.Task, db *gorm.DB, fbA
 
 	return nil
 }
+
+// UploadConfirmWindow is how long the apps have to upload an image and call confirm-upload
+const UploadConfirmWindow = 30 * time.Minute
+
+const uploadExpiredMessage = "Image upload was not finished, please upload the image again"
+
+// ExpireUploadsTask marks clothes, avatars and custom scene try-on backgrounds whose upload was never
+// confirmed as expired, together with the processing that was waiting for the upload.
+// An expired default avatar gives the default back to the last completed avatar of the user.
+func ExpireUploadsTask(ctx context.Context, t *asynq.Task, db *gorm.DB) error {
+	now := time.Now()
+
+	var clothes []models.Clothing
+	if err := db.Where("image_status = ? AND upload_expires_at < ?", "draft", now).Find(&clothes).Error; err != nil {
+		sentry.CaptureException(fmt.Errorf("[Expire Uploads] Error on retrieving clothes: %v", err))
+		return err
+	}
+	// every row is expired with conditional updates, a confirm-upload running meanwhile wins
+	for _, clothing := range clothes {
+		expired := false
+		err := db.Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(&models.Clothing{}).Where("id = ? AND image_status = ?", clothing.ID, "draft").Update("image_status", "expired")
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			expired = true
+			if err := tx.Model(&models.Clothing{}).Where("id = ? AND processing_status = ?", clothing.ID, "pending").
+				Updates(map[string]interface{}{"processing_status": "failed", "process_error_message": uploadExpiredMessage}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&models.Clothing{}).Where("id = ? AND identify_status = ?", clothing.ID, "pending").
+				Updates(map[string]interface{}{"identify_status": "failed", "identify_error_message": uploadExpiredMessage}).Error
+		})
+		if err != nil {
+			sentry.CaptureException(fmt.Errorf("[Expire Uploads] Error on expiring clothing %v: %v", clothing.ID, err))
+			continue
+		}
+		if expired {
+			fmt.Printf("[Expire Uploads] Clothing %v upload expired\n", clothing.ID)
+		}
+	}
+
+	var avatars []models.UserAvatar
+	if err := db.Where("image_status = ? AND upload_expires_at < ?", "draft", now).Find(&avatars).Error; err != nil {
+		sentry.CaptureException(fmt.Errorf("[Expire Uploads] Error on retrieving avatars: %v", err))
+		return err
+	}
+	for _, avatar := range avatars {
+		expired := false
+		err := db.Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(&models.UserAvatar{}).Where("id = ? AND image_status = ?", avatar.ID, "draft").
+				Updates(map[string]interface{}{"image_status": "expired", "status": "failed", "processing_error_message": uploadExpiredMessage})
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			expired = true
+			var current models.UserAvatar
+			if err := tx.Select("is_default").First(&current, avatar.ID).Error; err != nil {
+				return err
+			}
+			if !current.IsDefault {
+				return nil
+			}
+			// set-avatar made the upload the default, the last completed avatar becomes the default again
+			var previous models.UserAvatar
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("user_account_id = ? AND id <> ? AND status = ?", avatar.UserAccountID, avatar.ID, "completed").
+				Order("created_at desc").First(&previous).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// only the avatar status of the user, the rest of the row may be edited meanwhile
+				return tx.Model(&models.UserAccount{}).Where("id = ?", avatar.UserAccountID).
+					Updates(map[string]interface{}{"full_body_avatar_status": "failed", "full_body_avatar_processing_error_message": uploadExpiredMessage}).Error
+			}
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&models.UserAvatar{}).Where("id = ?", avatar.ID).Update("is_default", false).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&previous).Update("is_default", true).Error; err != nil {
+				return err
+			}
+			var user models.UserAccount
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, avatar.UserAccountID).Error; err != nil {
+				return err
+			}
+			previous.ApplyToUser(&user)
+			return tx.Model(&user).Select(avatarUserFields).Updates(&user).Error
+		})
+		if err != nil {
+			sentry.CaptureException(fmt.Errorf("[Expire Uploads] Error on expiring avatar %v: %v", avatar.ID, err))
+			continue
+		}
+		if expired {
+			fmt.Printf("[Expire Uploads] Avatar %v of user %v upload expired\n", avatar.ID, avatar.UserAccountID)
+		}
+	}
+
+	// custom scene try-ons wait for their background, see ConfirmTryOnBackgroundUpload
+	res := db.Model(&models.ClothingTryonGeneration{}).
+		Where("status = ? AND created_at < ?", "awaiting_background", now.Add(-UploadConfirmWindow)).
+		Updates(map[string]interface{}{"status": "failed", "generation_error_message": uploadExpiredMessage})
+	if res.Error != nil {
+		sentry.CaptureException(fmt.Errorf("[Expire Uploads] Error on expiring try on backgrounds: %v", res.Error))
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		fmt.Printf("[Expire Uploads] %v try on background uploads expired\n", res.RowsAffected)
+	}
+	return nil
+}
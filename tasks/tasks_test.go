@@ -1,19 +1,26 @@
 package tasks
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"image"
+	"image/png"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"letryapi/dbhelper"
 	"letryapi/models"
 	"letryapi/services"
 	"letryapi/test"
 
+	"github.com/hibiken/asynq"
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
 )
 
 func stringPtr(s string) *string {
@@ -98,3 +105,493 @@ func TestTryOnGeneratingTask(t *testing.T) {
 	// assert.Equal(t, int64(4), questionCount)
 	// assert.NoError(t, err)
 }
+
+func TestTryOnGeneratingTaskCancelled(t *testing.T) {
+	db := dbhelper.SetupTestDB()
+	cleaner := dbhelper.SetupCleaner(db)
+	defer cleaner()
+	user := test.FakeUser(db, nil)
+
+	var tryOn models.ClothingTryonGeneration = models.ClothingTryonGeneration{
+		Status:        "cancelled",
+		UserAccountID: user.ID,
+		CompanyID:     user.Memberships[0].CompanyID,
+	}
+	db.Create(&tryOn)
+
+	fakeTask, err := NewTryOnGenerationTask(user.ID, tryOn.ID)
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	// the processor is never reached for a cancelled try-on
+	err = HandleTryOnGenerationTask(context.Background(), fakeTask, db, &services.GoogleLLMProcessor{}, &test.AWSProviderMock{})
+	assert.NoError(t, err)
+
+	var updatedTryOn models.ClothingTryonGeneration
+	db.First(&updatedTryOn, tryOn.ID)
+	assert.Equal(t, "cancelled", updatedTryOn.Status)
+	assert.Nil(t, updatedTryOn.TryOnPreviewImageURL)
+}
+
+func TestTaskErrorMapping(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		message   string
+		skipRetry bool
+	}{
+		{"content blocked", fmt.Errorf("%w: nudity", services.ErrContentBlocked), "Sorry, it seems that this image contains violated content that we cannot process.", true},
+		{"no person", fmt.Errorf("%w: NO_PERSON", services.ErrNoPersonDetected), "No person detected in the image, please try to upload new avatar", true},
+		{"asset missing", fmt.Errorf("%w: object gone", services.ErrAssetMissing), "The uploaded image could not be found, please upload it again", true},
+		{"unsupported format", &services.UnsupportedImageFormatError{Format: "heic"}, "This photo format is not supported, please upload a JPEG, PNG, WebP or HEIC photo", true},
+		{"parse failure", &services.StructuredOutputError{Operation: "identify", Reason: "invalid json"}, "fallback", true},
+		{"deleted row", gorm.ErrRecordNotFound, "fallback", true},
+		{"transient upstream", fmt.Errorf("%w: 503", services.ErrTransientUpstream), "fallback", false},
+		{"unknown", errors.New("connection reset"), "fallback", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.message, taskFailMessage(tt.err, "fallback"))
+			err := taskError(tt.err)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.skipRetry, errors.Is(err, asynq.SkipRetry))
+		})
+	}
+}
+
+func TestCompanyLLMChain(t *testing.T) {
+	// Seedream has no backend here, so it is left out of the image chains
+	registry := services.NewLLMProviderRegistry(nil)
+	for _, model := range []services.LLMModelName{services.Pro25, services.Flash25, services.Flash25Image} {
+		registry.Register(model, &services.OfflineLLMProcessor{})
+	}
+	enforced := int32(services.Flash25)
+	tests := []struct {
+		name      string
+		company   models.Company
+		operation string
+		chain     []services.LLMModelName
+	}{
+		{"global chain", models.Company{}, services.LLMOperationIdentifyClothing, []services.LLMModelName{services.Pro25, services.Flash25}},
+		{"unregistered fallback", models.Company{}, services.LLMOperationTryOn, []services.LLMModelName{services.Flash25Image}},
+		{"enforced model first", models.Company{EnforcedLLMModel: &enforced}, services.LLMOperationIdentifyClothing, []services.LLMModelName{services.Flash25, services.Pro25}},
+		{"enforced text model for images", models.Company{EnforcedLLMModel: &enforced}, services.LLMOperationTryOn, []services.LLMModelName{services.Flash25Image}},
+		{"company chain", models.Company{LLMFallbackChains: map[string][]int32{
+			services.LLMOperationPersonCharacteristics: {int32(services.Flash25), int32(services.FlashLite25), int32(services.Pro25)},
+		}}, services.LLMOperationPersonCharacteristics, []services.LLMModelName{services.Flash25, services.Pro25}},
+		{"no usable model", models.Company{LLMFallbackChains: map[string][]int32{
+			services.LLMOperationTryOn: {int32(services.Seedream40)},
+		}}, services.LLMOperationTryOn, []services.LLMModelName{services.Flash25Image}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.chain, companyLLMChain(nil, registry, tt.company, tt.operation, "test"))
+		})
+	}
+}
+
+func TestRegenerateUntilQualityPasses(t *testing.T) {
+	goodImage, err := os.ReadFile("../input.png")
+	if err != nil {
+		t.Fatalf("Failed to open test image: %v", err)
+	}
+	// a tiny flat image fails the resolution check
+	var badImage bytes.Buffer
+	png.Encode(&badImage, image.NewGray(image.Rect(0, 0, 90, 160)))
+
+	options := services.ImageQualityOptions{AspectRatio: services.AspectRatio9x16, WhiteBackground: true}
+	ctx := context.Background()
+	calls := 0
+	response, model, regenerations, failReason, err := regenerateUntilQualityPasses(ctx, "Test", &services.LLMResponse{Images: [][]byte{badImage.Bytes()}}, services.Flash25Image, options,
+		func() (*services.LLMResponse, services.LLMModelName, error) {
+			calls++
+			return &services.LLMResponse{Images: [][]byte{goodImage}}, services.Seedream40, nil
+		},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 1, regenerations)
+	assert.Equal(t, goodImage, response.Images[0])
+	// the model of the kept image, the regeneration fell back to another one
+	assert.Equal(t, services.Seedream40, model)
+	// the kept image passed, the first failure is not its reason
+	assert.Nil(t, failReason)
+
+	// regeneration stops after the bound even when every image fails
+	calls = 0
+	response, _, regenerations, failReason, err = regenerateUntilQualityPasses(ctx, "Test", &services.LLMResponse{Images: [][]byte{badImage.Bytes()}}, services.Flash25Image, options,
+		func() (*services.LLMResponse, services.LLMModelName, error) {
+			calls++
+			return &services.LLMResponse{Images: [][]byte{badImage.Bytes()}}, services.Flash25Image, nil
+		},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, maxQualityRegenerations, calls)
+	assert.Equal(t, maxQualityRegenerations, regenerations)
+	if assert.NotNil(t, failReason) {
+		assert.Contains(t, *failReason, services.QualityLowResolution)
+	}
+	assert.Equal(t, badImage.Bytes(), response.Images[0])
+
+	// a failed regeneration keeps the previous image
+	_, _, _, failReason, err = regenerateUntilQualityPasses(ctx, "Test", &services.LLMResponse{Images: [][]byte{badImage.Bytes()}}, services.Flash25Image, options,
+		func() (*services.LLMResponse, services.LLMModelName, error) {
+			return nil, services.Seedream40, services.ErrNoImageGenerated
+		},
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, failReason)
+
+	// without a model to call or with the task cancelled the task is queued again instead of shipping the image
+	_, _, _, _, err = regenerateUntilQualityPasses(ctx, "Test", &services.LLMResponse{Images: [][]byte{badImage.Bytes()}}, services.Flash25Image, options,
+		func() (*services.LLMResponse, services.LLMModelName, error) {
+			return nil, services.Seedream40, fmt.Errorf("%w: circuit open", services.ErrLLMUnavailable)
+		},
+	)
+	assert.ErrorIs(t, err, services.ErrLLMUnavailable)
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, _, _, _, err = regenerateUntilQualityPasses(cancelledCtx, "Test", &services.LLMResponse{Images: [][]byte{badImage.Bytes()}}, services.Flash25Image, options,
+		func() (*services.LLMResponse, services.LLMModelName, error) {
+			return nil, services.Flash25Image, cancelledCtx.Err()
+		},
+	)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestFetchTryOnAssets(t *testing.T) {
+	// the assets are normalized before they are written, so the test serves a real image
+	var served bytes.Buffer
+	png.Encode(&served, image.NewGray(image.Rect(0, 0, 30, 40)))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(served.Bytes())
+	}))
+	defer server.Close()
+	awsService := &test.AWSProviderMock{MockUrl: server.URL + "/file.png"}
+
+	var topPath, avatarPath string
+	tempFiles, err := fetchTryOnAssets(context.Background(), awsService, []tryOnAsset{
+		{label: "top clothing", key: stringPtr("clothing/top.png"), path: &topPath},
+		{label: "user avatar", key: stringPtr("avatar/full.png"), path: &avatarPath},
+	}, "TryOnGen-test")
+	defer removeTempFiles(tempFiles, "test")
+	assert.NoError(t, err)
+	assert.Len(t, tempFiles, 2)
+	for _, path := range []string{topPath, avatarPath} {
+		content, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		written, _, err := image.Decode(bytes.NewReader(content))
+		if assert.NoError(t, err) {
+			assert.Equal(t, image.Rect(0, 0, 30, 40), written.Bounds())
+		}
+	}
+
+	// a missing key fails the whole fetch but still reports the files that were written
+	var shoesPath string
+	tempFiles, err = fetchTryOnAssets(context.Background(), awsService, []tryOnAsset{
+		{label: "top clothing", key: stringPtr("clothing/top.png"), path: &topPath},
+		{label: "shoes clothing", key: nil, path: &shoesPath},
+	}, "TryOnGen-test")
+	assert.ErrorContains(t, err, "shoes clothing")
+	assert.Empty(t, shoesPath)
+	removeTempFiles(tempFiles, "test")
+	for _, path := range tempFiles {
+		_, statErr := os.Stat(path)
+		assert.True(t, os.IsNotExist(statErr))
+	}
+}
+
+func TestExpireUploadsTask(t *testing.T) {
+	db := dbhelper.SetupTestDB()
+	cleaner := dbhelper.SetupCleaner(db)
+	defer cleaner()
+	user := test.FakeUser(db, nil)
+
+	expiredAt := time.Now().Add(-time.Minute)
+	validUntil := time.Now().Add(UploadConfirmWindow)
+	expired := models.Clothing{
+		ClothingType:     "top",
+		ImageURL:         stringPtr("clothes/expired.jpg"),
+		OwnerID:          user.ID,
+		CompanyID:        user.Memberships[0].CompanyID,
+		ProcessingStatus: "pending",
+		ImageStatus:      "draft",
+		UploadExpiresAt:  &expiredAt,
+	}
+	db.Create(&expired)
+	waiting := models.Clothing{
+		ClothingType:     "top",
+		ImageURL:         stringPtr("clothes/waiting.jpg"),
+		OwnerID:          user.ID,
+		CompanyID:        user.Memberships[0].CompanyID,
+		ProcessingStatus: "pending",
+		ImageStatus:      "draft",
+		UploadExpiresAt:  &validUntil,
+	}
+	db.Create(&waiting)
+	avatar := models.UserAvatar{
+		UserAccountID:   user.ID,
+		SourceImageURL:  "fullbodyavatars/expired.jpg",
+		Status:          "processing",
+		IsDefault:       true,
+		ImageStatus:     "draft",
+		UploadExpiresAt: &expiredAt,
+	}
+	db.Create(&avatar)
+
+	err := ExpireUploadsTask(context.Background(), NewExpireUploadsTask(), db)
+	assert.NoError(t, err)
+
+	var updatedExpired, updatedWaiting models.Clothing
+	db.First(&updatedExpired, expired.ID)
+	db.First(&updatedWaiting, waiting.ID)
+	assert.Equal(t, "expired", updatedExpired.ImageStatus)
+	assert.Equal(t, "failed", updatedExpired.ProcessingStatus)
+	assert.Equal(t, "draft", updatedWaiting.ImageStatus)
+	assert.Equal(t, "pending", updatedWaiting.ProcessingStatus)
+
+	var updatedAvatar models.UserAvatar
+	db.First(&updatedAvatar, avatar.ID)
+	assert.Equal(t, "expired", updatedAvatar.ImageStatus)
+	assert.Equal(t, "failed", updatedAvatar.Status)
+	var updatedUser models.UserAccount
+	db.First(&updatedUser, user.ID)
+	assert.Equal(t, "failed", updatedUser.FullBodyAvatarStatus)
+}
+
+func TestExpireUploadsTaskRestoresDefaultAvatar(t *testing.T) {
+	db := dbhelper.SetupTestDB()
+	cleaner := dbhelper.SetupCleaner(db)
+	defer cleaner()
+	user := test.FakeUser(db, nil)
+
+	completed := models.UserAvatar{
+		UserAccountID:  user.ID,
+		SourceImageURL: "fullbodyavatars/summer.jpg",
+		ImageURL:       stringPtr("/user/avatars/summer.png"),
+		Status:         "completed",
+		BodyType:       stringPtr("athletic"),
+	}
+	db.Create(&completed)
+	// set-avatar made the new upload the default before it was confirmed
+	expiredAt := time.Now().Add(-time.Minute)
+	abandoned := models.UserAvatar{
+		UserAccountID:   user.ID,
+		SourceImageURL:  "fullbodyavatars/abandoned.jpg",
+		Status:          "processing",
+		IsDefault:       true,
+		ImageStatus:     "draft",
+		UploadExpiresAt: &expiredAt,
+	}
+	db.Create(&abandoned)
+	abandoned.ApplyToUser(user)
+	db.Save(user)
+
+	err := ExpireUploadsTask(context.Background(), NewExpireUploadsTask(), db)
+	assert.NoError(t, err)
+
+	var updatedAbandoned, updatedCompleted models.UserAvatar
+	db.First(&updatedAbandoned, abandoned.ID)
+	db.First(&updatedCompleted, completed.ID)
+	assert.Equal(t, "expired", updatedAbandoned.ImageStatus)
+	assert.False(t, updatedAbandoned.IsDefault)
+	assert.True(t, updatedCompleted.IsDefault)
+	var updatedUser models.UserAccount
+	db.First(&updatedUser, user.ID)
+	assert.Equal(t, "completed", updatedUser.FullBodyAvatarStatus)
+	if assert.NotNil(t, updatedUser.UserFullBodyImageURL) {
+		assert.Equal(t, "/user/avatars/summer.png", *updatedUser.UserFullBodyImageURL)
+	}
+}
+
+// characteristicsEditingLLM simulates the user entering their body type by hand while the avatar is analyzed
+type characteristicsEditingLLM struct {
+	services.OfflineLLMProcessor
+	db     *gorm.DB
+	userID uint
+}
+
+func (p *characteristicsEditingLLM) AnalyzePersonCharacteristics(ctx context.Context, imagePath string, prompt *services.RenderedPrompt, modelName services.LLMModelName) (*services.LLMResponse, error) {
+	var user models.UserAccount
+	if err := p.db.First(&user, p.userID).Error; err != nil {
+		return nil, err
+	}
+	user.BodyType = stringPtr("pear")
+	user.MarkUserCharacteristic(models.CharacteristicBodyType, time.Now())
+	user.Name = "Edited Name"
+	if err := p.db.Save(&user).Error; err != nil {
+		return nil, err
+	}
+	return p.OfflineLLMProcessor.AnalyzePersonCharacteristics(ctx, imagePath, prompt, modelName)
+}
+
+func TestProcessAvatarKeepsCharacteristicsEditedMidTask(t *testing.T) {
+	db := dbhelper.SetupTestDB()
+	cleaner := dbhelper.SetupCleaner(db)
+	defer cleaner()
+	user := test.FakeUser(db, nil)
+
+	photo, err := os.ReadFile("../input.png")
+	if err != nil {
+		t.Fatalf("Failed to open test image: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(photo)
+	}))
+	defer server.Close()
+
+	avatar := models.UserAvatar{UserAccountID: user.ID, SourceImageURL: "fullbodyavatars/photo.png", Status: "processing", IsDefault: true}
+	db.Create(&avatar)
+	task, err := NewFullBodyAvatarGenerateTask(user.ID, avatar.ID)
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	llm := &characteristicsEditingLLM{db: db, userID: user.ID}
+	err = ProcessAvatarTask(context.Background(), task, db, llm, &test.AWSProviderMock{MockUrl: server.URL + "/photo.png"}, nil)
+	assert.NoError(t, err)
+
+	var updatedUser models.UserAccount
+	db.First(&updatedUser, user.ID)
+	assert.Equal(t, "completed", updatedUser.FullBodyAvatarStatus)
+	assert.Equal(t, "Edited Name", updatedUser.Name)
+	// the hand entered value stays, the AI one is only kept as a suggestion
+	assert.Equal(t, "pear", *updatedUser.BodyType)
+	assert.Equal(t, models.CharacteristicSourceUser, updatedUser.CharacteristicsProvenance[models.CharacteristicBodyType].Source)
+	if suggestion := updatedUser.CharacteristicsProvenance[models.CharacteristicBodyType].AISuggestion; assert.NotNil(t, suggestion) {
+		assert.Equal(t, "athletic", *suggestion)
+	}
+	// characteristics the user didn't touch come from the AI
+	assert.Equal(t, "broad", *updatedUser.ShoulderType)
+}
+
+func TestIdentifyClothingTaskReplay(t *testing.T) {
+	db := dbhelper.SetupTestDB()
+	cleaner := dbhelper.SetupCleaner(db)
+	defer cleaner()
+	user := test.FakeUser(db, nil)
+
+	shirt, err := os.ReadFile("shirt.jpeg")
+	if err != nil {
+		t.Fatalf("Failed to open test image: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(shirt)
+	}))
+	defer server.Close()
+
+	clothing := models.Clothing{
+		ClothingType:   "top",
+		ImageURL:       stringPtr("clothes/shirt.jpeg"),
+		OwnerID:        user.ID,
+		CompanyID:      user.Memberships[0].CompanyID,
+		IdentifyStatus: "pending",
+	}
+	db.Create(&clothing)
+	task, err := NewIdentifyClothingTask(clothing.ID)
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	// the answer comes from testdata/llm-recordings, a changed prompt or image fails with a missing recording
+	llm, err := services.NewRecordingLLMProcessor(nil, "testdata/llm-recordings", services.LLMRecordModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = IdentifyClothingTask(context.Background(), task, db, llm, &test.AWSProviderMock{MockUrl: server.URL + "/shirt.jpeg"}, nil)
+	assert.NoError(t, err)
+
+	var updated models.Clothing
+	db.First(&updated, clothing.ID)
+	assert.Equal(t, "completed", updated.IdentifyStatus)
+	assert.Equal(t, "Black graphic T-shirt", updated.Name)
+	assert.Equal(t, "top", updated.ClothingType)
+	if assert.NotNil(t, updated.PromptVersion) {
+		assert.Equal(t, "v1", *updated.PromptVersion)
+	}
+}
+
+func TestProcessAvatarUploadRejected(t *testing.T) {
+	db := dbhelper.SetupTestDB()
+	cleaner := dbhelper.SetupCleaner(db)
+	defer cleaner()
+	user := test.FakeUser(db, nil)
+
+	photo, err := os.ReadFile("../input.png")
+	if err != nil {
+		t.Fatalf("Failed to open test image: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(photo)
+	}))
+	defer server.Close()
+
+	avatar := models.UserAvatar{UserAccountID: user.ID, SourceImageURL: "fullbodyavatars/photo.png", Status: "processing", IsDefault: true}
+	db.Create(&avatar)
+	task, err := NewFullBodyAvatarGenerateTask(user.ID, avatar.ID)
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	awsService := &test.AWSProviderMock{MockUrl: server.URL + "/photo.png", UploadStatusCode: http.StatusServiceUnavailable}
+	err = ProcessAvatarTask(context.Background(), task, db, &services.OfflineLLMProcessor{}, awsService, nil)
+	// a rejected upload is retried instead of finishing the task
+	assert.ErrorIs(t, err, services.ErrTransientUpstream)
+
+	var updatedAvatar models.UserAvatar
+	db.First(&updatedAvatar, avatar.ID)
+	assert.Equal(t, "processing", updatedAvatar.Status)
+	assert.Nil(t, updatedAvatar.ImageURL)
+	assert.Equal(t, 1, updatedAvatar.ProcessRetryTimes)
+}
+
+func TestUploadTransparentVariantRejected(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	awsService := &test.AWSProviderMock{UploadStatusCode: http.StatusForbidden}
+	err := uploadTransparentVariant(context.Background(), awsService, img.Bytes(), "/tryon/1/transparent.png")
+	assert.ErrorIs(t, err, services.ErrTransientUpstream)
+	assert.ErrorContains(t, err, "status code: 403")
+}
+
+func TestProcessClothingTaskStoresVariants(t *testing.T) {
+	db := dbhelper.SetupTestDB()
+	cleaner := dbhelper.SetupCleaner(db)
+	defer cleaner()
+	user := test.FakeUser(db, nil)
+
+	shirt, err := os.ReadFile("shirt.jpeg")
+	if err != nil {
+		t.Fatalf("Failed to open test image: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(shirt)
+	}))
+	defer server.Close()
+
+	clothing := models.Clothing{
+		ClothingType:     "top",
+		ImageURL:         stringPtr("clothes/shirt.jpeg"),
+		OwnerID:          user.ID,
+		CompanyID:        user.Memberships[0].CompanyID,
+		ProcessingStatus: "pending",
+	}
+	db.Create(&clothing)
+	task, err := NewClothingProcessingTask(clothing.ID)
+	if err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	// the variants don't depend on the model, the Google processor would fail without a key
+	err = ProcessClothingTask(context.Background(), task, db, &services.GoogleLLMProcessor{}, &test.AWSProviderMock{MockUrl: server.URL + "/shirt.jpeg"}, nil)
+	assert.NoError(t, err)
+
+	var updated models.Clothing
+	db.First(&updated, clothing.ID)
+	assert.Equal(t, "completed", updated.ProcessingStatus)
+	assert.Equal(t, "in_closet", updated.Status)
+	if assert.NotNil(t, updated.WhiteImageURL) {
+		assert.Equal(t, fmt.Sprintf("/clothes/%v/white.png", clothing.ID), *updated.WhiteImageURL)
+	}
+	if assert.NotNil(t, updated.TransparentImageURL) {
+		assert.Equal(t, fmt.Sprintf("/clothes/%v/transparent.png", clothing.ID), *updated.TransparentImageURL)
+	}
+}
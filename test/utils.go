@@ -320,6 +320,10 @@ func (gsm GoogleServiceMock) GetUserSubscriptionStatus(ctx context.Context, appU
 
 type AWSProviderMock struct {
 	MockUrl string
+	// keys passed to DeleteR2Object, when set
+	DeletedKeys *[]string
+	// UploadStatusCode is answered by UploadToPresignedURL, 204 when zero
+	UploadStatusCode int
 }
 
 func (awsService AWSProviderMock) InitPresignClient(ctx context.Context) error {
@@ -335,16 +339,30 @@ func (awsService AWSProviderMock) GetPresignedR2FileReadURL(ctx context.Context,
 	return awsService.MockUrl, nil
 }
 
+func (awsService AWSProviderMock) HeadR2Object(ctx context.Context, bucketName, fileKey string) (*services.R2ObjectInfo, error) {
+	return &services.R2ObjectInfo{Size: 1024, ContentType: "image/png"}, nil
+}
+
+func (awsService AWSProviderMock) DeleteR2Object(ctx context.Context, bucketName, fileKey string) error {
+	if awsService.DeletedKeys != nil {
+		*awsService.DeletedKeys = append(*awsService.DeletedKeys, fileKey)
+	}
+	return nil
+}
+
 func (awsService AWSProviderMock) UploadToPresignedURL(ctx context.Context, bucketName, url string, fileContent []byte) (string, int, error) {
 	// Simulate a successful upload
 	// In a real implementation, you would use the AWS SDK to upload the file to S3
 	// and return the URL of the uploaded file.
+	if awsService.UploadStatusCode != 0 {
+		return url, awsService.UploadStatusCode, nil
+	}
 	return url, 204, nil
 }
 
 type MockGoogleTranscriber struct{}
 
-func (m MockGoogleTranscriber) GenerateTryOn(personAvatarPath string, filePaths []string, modelName services.LLMModelName) (*services.LLMResponse, error) {
+func (m MockGoogleTranscriber) GenerateTryOn(ctx context.Context, personAvatarPath string, filePaths []string, options services.TryOnOptions, prompt *services.RenderedPrompt, modelName services.LLMModelName) (*services.LLMResponse, error) {
 	return &services.LLMResponse{Response: `{
 		"md_summary": "Audio summary here.",
 		"name": "Audio name",
@@ -372,25 +390,9 @@ func (m MockGoogleTranscriber) GenerateTryOn(personAvatarPath string, filePaths
 	}, nil
 }
 
-func (m MockGoogleTranscriber) ProcessClothing(filePath string, modelName services.LLMModelName) (*services.LLMResponse, error) {
-	return &services.LLMResponse{Response: `{
-		"md_summary": "Document summary here.",
-		"name": "Document name here",
-		"quiz_json": [
-			{
-			"answer": "Список команд",
-			"options": [
-				"Набор файлов",
-				"Список команд",
-				"Графическое изображение",
-				"Системная настройка"
-			],
-			"question": "Что понимается под меню в операционной системе Windows согласно тексту?"
-			}
-		],
-		"transcription": "Hello there",
-		"language": "ru"
-		}`,
+func (m MockGoogleTranscriber) ProcessAvatarTaskWithCharacteristics(ctx context.Context, personAvatarPath string, prompt *services.RenderedPrompt, modelName services.LLMModelName) (*services.LLMResponse, error) {
+	return &services.LLMResponse{
+		Images:             [][]byte{[]byte{1, 2}},
 		InputTokenCount:    10,
 		TotalTokenCount:    11,
 		ThoughtsTokenCount: 12,
@@ -398,6 +400,16 @@ func (m MockGoogleTranscriber) ProcessClothing(filePath string, modelName servic
 	}, nil
 }
 
+func (m MockGoogleTranscriber) AnalyzePersonCharacteristics(ctx context.Context, imagePath string, prompt *services.RenderedPrompt, modelName services.LLMModelName) (*services.LLMResponse, error) {
+	return services.NewOfflineLLMProcessor().AnalyzePersonCharacteristics(ctx, imagePath, prompt, modelName)
+}
+
+func (m MockGoogleTranscriber) IdentifyClothing(ctx context.Context, clothingImagePath string, prompt *services.RenderedPrompt, modelName services.LLMModelName) (*services.LLMResponse, error) {
+	return services.NewOfflineLLMProcessor().IdentifyClothing(ctx, clothingImagePath, prompt, modelName)
+}
+
+var _ services.LLMProcessor = MockGoogleTranscriber{}
+
 type URLCacheMock struct {
 	MockUrl string
 }